@@ -6,23 +6,73 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/butlerdotdev/butler-runner/internal/callback"
 	"github.com/butlerdotdev/butler-runner/internal/runner"
+	"github.com/butlerdotdev/butler-runner/internal/terraform"
 	"github.com/spf13/cobra"
 )
 
 var (
-	butlerURL  string
-	runID      string
-	token      string
-	localMode  bool
-	workingDir string
-	operation  string
-	tfVersion  string
+	butlerURL            string
+	runID                string
+	token                string
+	signingSecret        string
+	checkConnection      bool
+	junitReport          string
+	localMode            bool
+	workingDir           string
+	operation            string
+	tfVersion            string
+	tfDistribution       string
+	idleTimeout          time.Duration
+	planFile             string
+	destroyPlan          bool
+	approvedPlanDigest   string
+	allowOutputErrors    bool
+	attempt              int
+	lockPlatforms        []string
+	strictWarnings       bool
+	suppressWarnings     []string
+	targets              []string
+	isolate              bool
+	isolationRoot        string
+	workspace            string
+	gracePeriod          time.Duration
+	timeout              time.Duration
+	lockTimeout          time.Duration
+	logFormat            string
+	protectTypes         []string
+	allowDestroys        []string
+	largePlanThreshold   int
+	blockLargePlans      bool
+	detectSchemaNoise    bool
+	varFiles             []string
+	logLevel             string
+	pluginCacheDir       string
+	registryTimeout      time.Duration
+	registryRetries      int
+	pluginCacheMinFreeMB int
+	skipBackend          bool
+	initStallTimeout     time.Duration
+	dataDir              string
+	dataDirClean         []string
+	upgradeLockMismatch  bool
+	emitEvents           bool
+	exitWithParent       bool
+	eventsNATSURL        string
+	eventsNATSCreds      string
+	eventsNATSCA         string
+	eventsSubject        string
 )
 
 func Execute() error {
@@ -55,19 +105,64 @@ Local mode:
 func init() {
 	rootCmd.AddCommand(execCmd)
 
+	execCmd.Flags().StringVar(&logFormat, "log-format", "text", "Log output format (text/json)")
+	execCmd.Flags().StringVar(&logLevel, "log-level", "info", "Minimum log level (debug/info/warn/error)")
 	execCmd.Flags().StringVar(&butlerURL, "butler-url", os.Getenv("BUTLER_URL"), "Butler API base URL")
 	execCmd.Flags().StringVar(&runID, "run-id", os.Getenv("BUTLER_RUN_ID"), "Butler run ID")
 	execCmd.Flags().StringVar(&token, "token", os.Getenv("BUTLER_TOKEN"), "Butler callback token")
+	execCmd.Flags().StringVar(&signingSecret, "signing-secret", os.Getenv("BUTLER_SIGNING_SECRET"), "Shared secret for signing callback payloads (empty = unsigned)")
+	execCmd.Flags().StringVar(&eventsNATSURL, "events-nats-url", os.Getenv("BUTLER_EVENTS_NATS_URL"), "Publish run events to this NATS server instead of HTTP callbacks, e.g. nats://nats:4222")
+	execCmd.Flags().StringVar(&eventsNATSCreds, "events-nats-creds", os.Getenv("BUTLER_EVENTS_NATS_CREDS"), "NATS credentials file (user JWT and NKey seed) for --events-nats-url")
+	execCmd.Flags().StringVar(&eventsNATSCA, "events-nats-ca", os.Getenv("BUTLER_EVENTS_NATS_CA"), "PEM CA bundle trusted for a tls:// --events-nats-url (default: system roots)")
+	execCmd.Flags().StringVar(&eventsSubject, "events-subject", "butler.runs", "Subject prefix for published run events; the run ID and event name are appended")
+	execCmd.Flags().BoolVar(&checkConnection, "check-connection", false, "Verify the Butler API is reachable and the token valid before starting")
+	execCmd.Flags().IntVar(&attempt, "attempt", envInt("BUTLER_RUN_ATTEMPT"), "Run attempt number (0 = use execution config)")
+	execCmd.Flags().BoolVar(&exitWithParent, "exit-with-parent", false, "Cancel the run if the supervising process exits")
 	execCmd.Flags().BoolVar(&localMode, "local", false, "Run in local mode (no Butler API)")
 	execCmd.Flags().StringVar(&workingDir, "working-dir", ".", "Working directory for local mode")
-	execCmd.Flags().StringVar(&operation, "operation", "plan", "Terraform operation (plan/apply/destroy)")
+	operation = "plan"
+	execCmd.Flags().Var((*operationValue)(&operation), "operation", "Terraform operation ("+strings.Join(terraform.Operations, "/")+")")
 	execCmd.Flags().StringVar(&tfVersion, "tf-version", "", "Terraform version (empty = use default)")
+	execCmd.Flags().StringVar(&tfDistribution, "tf-distribution", "", "IaC distribution to download (terraform/opentofu, empty = any on PATH)")
+	execCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Cancel the run if terraform produces no output for this long (0 = disabled)")
+	execCmd.Flags().StringArrayVar(&lockPlatforms, "lock-platform", nil, "Platform to hash for providers-lock, e.g. linux_amd64 (repeatable)")
+	execCmd.Flags().BoolVar(&strictWarnings, "strict-warnings", false, "Fail the run on any unsuppressed warning; apply and destroy check their plan before changing anything")
+	execCmd.Flags().StringArrayVar(&suppressWarnings, "suppress-warning", nil, "Warning summary to ignore, case-insensitive substring (repeatable)")
+	execCmd.Flags().StringArrayVar(&varFiles, "var-file", nil, "Extra variable file passed as -var-file, relative to the working dir (repeatable)")
+	execCmd.Flags().StringArrayVar(&targets, "target", nil, "Resource address to target with -target (repeatable)")
+	execCmd.Flags().StringArrayVar(&protectTypes, "protect-type", nil, "Resource type that apply/destroy must not destroy, e.g. aws_db_instance (repeatable)")
+	execCmd.Flags().StringArrayVar(&allowDestroys, "allow-destroy", nil, "Resource address exempt from --protect-type (repeatable)")
+	execCmd.Flags().IntVar(&largePlanThreshold, "large-plan-threshold", 0, "Warn when a plan changes more resources than this (0 = no limit)")
+	execCmd.Flags().BoolVar(&blockLargePlans, "block-large-plans", false, "Fail plans over --large-plan-threshold instead of warning")
+	execCmd.Flags().BoolVar(&detectSchemaNoise, "detect-schema-noise", false, "Flag plans whose changes only touch computed or defaulted attributes as likely provider upgrade noise")
+	execCmd.Flags().BoolVar(&isolate, "isolate", false, "Run terraform in its own user and mount namespace, chrooted into --isolation-root (Linux only)")
+	execCmd.Flags().StringVar(&isolationRoot, "isolation-root", "", "Prepared root to chroot terraform into when isolated; required with --isolate")
+	execCmd.Flags().StringVar(&workspace, "workspace", "", "Terraform workspace to select, created if missing (empty = default)")
+	execCmd.Flags().DurationVar(&timeout, "timeout", 0, "Fail a terraform invocation that runs longer than this, e.g. 45m (0 = no limit)")
+	execCmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, "Wait up to this long for a state lock held by another run (0 = fail immediately)")
+	execCmd.Flags().DurationVar(&gracePeriod, "grace-period", 0, "Time terraform gets to stop after an interrupt before it is killed (0 = 30s)")
+	execCmd.Flags().StringVar(&pluginCacheDir, "plugin-cache-dir", os.Getenv("TF_PLUGIN_CACHE_DIR"), "Shared provider plugin cache directory for terraform init")
+	execCmd.Flags().IntVar(&pluginCacheMinFreeMB, "plugin-cache-min-free-mb", 0, "Evict least-recently-used providers from the plugin cache when less disk than this is free (0 = never)")
+	execCmd.Flags().BoolVar(&skipBackend, "skip-backend", false, "Run terraform init with -backend=false (always on for validate)")
+	execCmd.Flags().StringVar(&dataDir, "data-dir", os.Getenv("BUTLER_DATA_DIR"), "Directory of persistent terraform data dirs, one per module, shared across runs (empty = .terraform in the working dir)")
+	execCmd.Flags().StringArrayVar(&dataDirClean, "clean-data-dir", nil, "Data dir part removed before init: modules, providers, backend, or workspace (repeatable)")
+	execCmd.Flags().BoolVar(&upgradeLockMismatch, "upgrade-on-lock-mismatch", false, "Retry init once with -upgrade if the lock file has no checksums for this platform")
+	execCmd.Flags().DurationVar(&initStallTimeout, "init-stall-timeout", 0, "Fail init if a provider download makes no progress for this long (0 = disabled)")
+	execCmd.Flags().DurationVar(&registryTimeout, "registry-timeout", 0, "Timeout for terraform registry requests during init (0 = terraform default)")
+	execCmd.Flags().IntVar(&registryRetries, "registry-discovery-retries", 0, "Retries for terraform registry discovery during init (0 = terraform default)")
+	execCmd.Flags().BoolVar(&emitEvents, "events", false, "Emit NDJSON run events on stdout and move terraform output to stderr (local mode)")
+	execCmd.Flags().StringVar(&junitReport, "junit-report", "", "Write test/validate results as JUnit XML to this path (local mode)")
+	execCmd.Flags().StringVar(&planFile, "plan-file", "", "Saved plan path: plan writes it, apply (or destroy) executes exactly it")
+	execCmd.Flags().StringVar(&approvedPlanDigest, "approved-plan-digest", "", "Refuse to apply a saved --plan-file whose digest differs from this sha256:<hex> value")
+	execCmd.Flags().BoolVar(&allowOutputErrors, "allow-output-errors", false, "Treat an apply that changed resources but failed to evaluate outputs as successful")
+	execCmd.Flags().BoolVar(&destroyPlan, "destroy-plan", false, "Make plan create a destroy plan, for a later destroy run with --plan-file")
 }
 
 func runExec(cmd *cobra.Command, args []string) error {
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger, err := newLogger(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
@@ -82,10 +177,49 @@ func runExec(cmd *cobra.Command, args []string) error {
 	}()
 
 	if localMode {
+		var events io.Writer
+		if emitEvents {
+			events = os.Stdout
+		}
 		return runner.RunLocal(ctx, logger, runner.LocalConfig{
-			WorkingDir: workingDir,
-			Operation:  operation,
-			TfVersion:  tfVersion,
+			WorkingDir:         workingDir,
+			Operation:          operation,
+			TfVersion:          tfVersion,
+			TfDistribution:     tfDistribution,
+			IdleTimeout:        idleTimeout,
+			ExitWithParent:     exitWithParent,
+			PlanFile:           planFile,
+			DestroyPlan:        destroyPlan,
+			ApprovedPlanDigest: approvedPlanDigest,
+			AllowOutputErrors:  allowOutputErrors,
+			LockPlatforms:      lockPlatforms,
+			StrictWarnings:     strictWarnings,
+			SuppressWarnings:   suppressWarnings,
+			Targets:            targets,
+			Isolate:            isolate,
+			IsolationRoot:      isolationRoot,
+			Workspace:          workspace,
+			GracePeriod:        gracePeriod,
+			Timeout:            timeout,
+			LockTimeout:        lockTimeout,
+			ProtectedTypes:     protectTypes,
+			AllowedDestroys:    allowDestroys,
+			LargePlanThreshold: largePlanThreshold,
+			BlockLargePlans:    blockLargePlans,
+			DetectSchemaNoise:  detectSchemaNoise,
+			VarFiles:           varFiles,
+			PluginCacheDir:     pluginCacheDir,
+			RegistryTimeout:    registryTimeout,
+			RegistryRetries:    registryRetries,
+			PluginCacheMinFree: int64(pluginCacheMinFreeMB) << 20,
+			SkipBackend:        skipBackend,
+			InitStallTimeout:   initStallTimeout,
+			DataDir:            dataDir,
+			DataDirClean:       dataDirClean,
+			JUnitReport:        junitReport,
+			Events:             events,
+
+			UpgradeOnLockMismatch: upgradeLockMismatch,
 		})
 	}
 
@@ -101,8 +235,57 @@ func runExec(cmd *cobra.Command, args []string) error {
 	}
 
 	return runner.RunManaged(ctx, logger, runner.ManagedConfig{
-		ButlerURL: butlerURL,
-		RunID:     runID,
-		Token:     token,
+		ButlerURL:       butlerURL,
+		RunID:           runID,
+		Token:           token,
+		SigningSecret:   signingSecret,
+		Attempt:         attempt,
+		CheckConnection: checkConnection,
+		ExitWithParent:  exitWithParent,
+		EventsNATSURL:   eventsNATSURL,
+		EventsNATS:      callback.NATSOptions{CredsFile: eventsNATSCreds, CAFile: eventsNATSCA},
+		EventsSubject:   eventsSubject,
 	})
 }
+
+// newLogger builds the runner's logger writing to w in the given format
+// ("text" or "json") at the given minimum level.
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q: use debug, info, warn, or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q: use text or json", format)
+	}
+}
+
+// operationValue is a flag value that accepts only the operations the
+// executor supports, so a typo is a usage error before any run starts.
+type operationValue string
+
+func (o *operationValue) String() string { return string(*o) }
+
+func (o *operationValue) Set(s string) error {
+	if !slices.Contains(terraform.Operations, s) {
+		return fmt.Errorf("unsupported operation (supported: %s)", strings.Join(terraform.Operations, ", "))
+	}
+	*o = operationValue(s)
+	return nil
+}
+
+func (o *operationValue) Type() string { return "operation" }
+
+// envInt returns the integer value of an environment variable, or 0 if it
+// is unset or not a number.
+func envInt(key string) int {
+	n, _ := strconv.Atoi(os.Getenv(key))
+	return n
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerJSONLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+
+	logger.Info("dropped")
+	logger.Warn("kept", "runId", "run-1")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the warning to be logged, got %q", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if record["msg"] != "kept" || record["level"] != "WARN" || record["runId"] != "run-1" {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestNewLoggerTextDebug(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "text", "debug")
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+
+	logger.Debug("flushed logs")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=\"flushed logs\"") {
+		t.Errorf("expected debug line in text format, got %q", buf.String())
+	}
+}
+
+func TestNewLoggerRejectsInvalidOptions(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "yaml", "info"); err == nil {
+		t.Error("expected error for unknown log format")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, "text", "verbose"); err == nil {
+		t.Error("expected error for unknown log level")
+	}
+}
+
+func TestExecRejectsUnknownOperation(t *testing.T) {
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs([]string{"exec", "--local", "--operation=import"})
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), `invalid argument "import" for "--operation" flag`) {
+		t.Fatalf("expected a flag error for the operation, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "supported: init, plan, apply") {
+		t.Errorf("expected the error to list supported operations, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Usage:") {
+		t.Errorf("expected usage to be printed, got %q", out.String())
+	}
+	if operation != "plan" {
+		t.Errorf("expected the operation to keep its default, got %q", operation)
+	}
+}
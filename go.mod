@@ -2,9 +2,17 @@ module github.com/butlerdotdev/butler-runner
 
 go 1.23.0
 
-require github.com/spf13/cobra v1.8.1
+require (
+	github.com/nats-io/nats.go v1.41.2
+	github.com/spf13/cobra v1.8.1
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+	golang.org/x/sys v0.32.0 // indirect
 )
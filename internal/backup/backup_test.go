@@ -0,0 +1,41 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package backup
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := Encrypt(key, []byte(`{"version":4}`))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	got, err := Decrypt(key, sealed)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != `{"version":4}` {
+		t.Errorf("unexpected plaintext %q", got)
+	}
+
+	if _, err := Decrypt(bytes.Repeat([]byte{8}, 32), sealed); err == nil {
+		t.Error("expected decryption with the wrong key to fail")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey(base64.StdEncoding.EncodeToString(make([]byte, 32))); err != nil {
+		t.Errorf("expected 32-byte key to parse: %v", err)
+	}
+	if _, err := ParseKey(base64.StdEncoding.EncodeToString(make([]byte, 16))); err == nil {
+		t.Error("expected short key to be rejected")
+	}
+	if _, err := ParseKey("not base64!"); err == nil {
+		t.Error("expected invalid base64 to be rejected")
+	}
+}
@@ -5,40 +5,251 @@ package callback
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/butlerdotdev/butler-runner/internal/config"
 )
 
 // StatusDetails contains details for a status update.
 type StatusDetails struct {
-	ExitCode           int    `json:"exit_code,omitempty"`
-	ResourcesToAdd     int    `json:"resources_to_add,omitempty"`
-	ResourcesToChange  int    `json:"resources_to_change,omitempty"`
-	ResourcesToDestroy int    `json:"resources_to_destroy,omitempty"`
-	PlanJSON           string `json:"plan_json,omitempty"`
-	PlanText           string `json:"plan_text,omitempty"`
+	ExitCode           int          `json:"exit_code,omitempty"`
+	ResourcesToAdd     int          `json:"resources_to_add,omitempty"`
+	ResourcesToChange  int          `json:"resources_to_change,omitempty"`
+	ResourcesToDestroy int          `json:"resources_to_destroy,omitempty"`
+	ResourcesToReplace int          `json:"resources_to_replace,omitempty"`
+	ResourcesToRead    int          `json:"resources_to_read,omitempty"`
+	PlanJSON           string       `json:"plan_json,omitempty"`
+	PlanText           string       `json:"plan_text,omitempty"`
+	SourceDurationMs   int64        `json:"source_duration_ms,omitempty"`
+	SourceBytes        int64        `json:"source_bytes,omitempty"`
+	SourceCloneMs      int64        `json:"source_clone_ms,omitempty"`
+	SourceCheckoutMs   int64        `json:"source_checkout_ms,omitempty"`
+	UpgradeBlockers    []Diagnostic `json:"upgrade_blockers,omitempty"`
+	LockFile           string       `json:"lock_file,omitempty"`
+	Warnings           []Diagnostic `json:"warnings,omitempty"`
+	Diagnostics        []Diagnostic `json:"diagnostics,omitempty"`
+	// State resource counts are pointers so an empty state (zero) is still
+	// reported; nil means the count was not taken.
+	StateResourceCountBefore *int `json:"state_resource_count_before,omitempty"`
+	StateResourceCount       *int `json:"state_resource_count,omitempty"`
+	// FailureReason classifies a failure, e.g. "timeout"; empty for an
+	// ordinary non-zero exit.
+	FailureReason string `json:"failure_reason,omitempty"`
+	// Backend names the state backend involved in a backend_auth_failed
+	// failure.
+	Backend string `json:"backend,omitempty"`
+	// Commands are the terraform command lines run, secrets masked.
+	Commands []string `json:"commands,omitempty"`
+	// EstimatedApplySeconds is a rough estimate of how long applying the
+	// plan will take; zero when not estimated.
+	EstimatedApplySeconds int `json:"estimated_apply_seconds,omitempty"`
+	// PlanDigest identifies the saved plan file, so an approval can be
+	// matched to the plan that is later applied.
+	PlanDigest string `json:"plan_digest,omitempty"`
+	// LikelyProviderUpgradeNoise flags a plan whose changes look like
+	// spurious updates from a provider schema change.
+	LikelyProviderUpgradeNoise bool `json:"likely_provider_upgrade_noise,omitempty"`
+	// PlanCountMismatch describes how the plan's text summary disagrees
+	// with the resource counts taken from the plan JSON, which are reported.
+	PlanCountMismatch string `json:"plan_count_mismatch,omitempty"`
+	// InitUpgraded is set when init was retried with -upgrade after a lock
+	// file checksum mismatch.
+	InitUpgraded bool `json:"init_upgraded,omitempty"`
+	// LockFileChanged is set when init modified .terraform.lock.hcl;
+	// LockFileProviders are the providers and hashes it then records.
+	LockFileChanged   bool       `json:"lockfile_changed,omitempty"`
+	LockFileProviders []Provider `json:"lockfile_providers,omitempty"`
+	// Providers are the providers installed by an init-only run.
+	Providers []Provider `json:"providers,omitempty"`
+	// BinarySource says whether terraform came from PATH, the binary cache,
+	// or a fresh download; BinaryCacheDir is the cache used, if any.
+	BinarySource   string `json:"binary_source,omitempty"`
+	BinaryCacheDir string `json:"binary_cache_dir,omitempty"`
+	// Manifest lists the working directory files and their hashes.
+	Manifest []ManifestEntry `json:"manifest,omitempty"`
+	// LogPhases maps each phase to the log sequence numbers it produced.
+	LogPhases []LogPhase `json:"log_phases,omitempty"`
+	// Retries counts the HTTP and git retries consumed during the run.
+	Retries *RetryStats `json:"retries,omitempty"`
 }
 
+// RetryStats counts retries consumed per operation, to help debug flaky
+// connectivity.
+type RetryStats struct {
+	ConfigFetch int `json:"config_fetch"`
+	Callback    int `json:"callback"`
+	Clone       int `json:"clone"`
+}
+
+// LogPhase is the inclusive range of log sequence numbers emitted during a
+// phase. LastSequence < FirstSequence means the phase logged nothing.
+type LogPhase struct {
+	Phase         string `json:"phase"`
+	FirstSequence int    `json:"first_sequence"`
+	LastSequence  int    `json:"last_sequence"`
+}
+
+// Provider is a terraform provider and its locked version.
+type Provider struct {
+	Address string   `json:"address"`
+	Version string   `json:"version"`
+	Hashes  []string `json:"hashes,omitempty"`
+}
+
+// ManifestEntry is a working directory file and its SHA-256 digest.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Diagnostic is a terraform warning or error reported to Butler.
+type Diagnostic struct {
+	Severity string           `json:"severity"`
+	Summary  string           `json:"summary"`
+	Detail   string           `json:"detail,omitempty"`
+	Range    *DiagnosticRange `json:"range,omitempty"`
+}
+
+// DiagnosticRange locates a diagnostic in the module source, so Butler can
+// link it to the offending lines. Lines and columns are 1-based.
+type DiagnosticRange struct {
+	Filename    string `json:"filename"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+// Default retry policy for callback POSTs.
+const (
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = 500 * time.Millisecond
+)
+
+// defaultCompressThreshold is the payload size above which POST bodies are
+// gzipped. Large plans otherwise trip the API's request size limit.
+const defaultCompressThreshold = 256 << 10
+
 // Client posts results back to Butler API via callback URLs.
 type Client struct {
-	baseURL   string
-	token     string
-	callbacks config.CallbackURLs
-	client    *http.Client
+	baseURL     string
+	token       string
+	callbacks   config.CallbackURLs
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	attempt     int    // run attempt number; 0 = not reported
+	fingerprint string // stable run fingerprint; empty = not reported
+
+	compressThreshold int    // gzip bodies larger than this; <= 0 = never
+	signingSecret     []byte // HMAC key for SignatureHeader; empty = unsigned
+
+	publisher     Publisher // optional: replaces HTTP callbacks
+	subjectPrefix string    // events go to subjectPrefix + "." + event
+
+	redactor Redactor // optional: masks secrets in plans and diagnostics
+
+	retries atomic.Int64 // POST attempts repeated after a transient failure
 }
 
 // NewClient creates a new callback client.
 func NewClient(baseURL, token string, callbacks config.CallbackURLs) *Client {
 	return &Client{
-		baseURL:   baseURL,
-		token:     token,
-		callbacks: callbacks,
-		client:    &http.Client{},
+		baseURL:     baseURL,
+		token:       token,
+		callbacks:   callbacks,
+		client:      &http.Client{},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+
+		compressThreshold: defaultCompressThreshold,
+	}
+}
+
+// SignatureHeader carries the hex HMAC-SHA256 of a request body, prefixed
+// with "sha256=", when a signing secret is set.
+const SignatureHeader = "X-Butler-Signature"
+
+// SetSigningSecret makes the client sign every request body with an
+// HMAC-SHA256 keyed by secret, so Butler can verify payloads came from the
+// runner. The signature covers the body as sent, i.e. after any gzip
+// encoding. An empty secret disables signing.
+func (c *Client) SetSigningSecret(secret string) {
+	c.signingSecret = []byte(secret)
+}
+
+// SetCompressThreshold sets the body size in bytes above which POSTs are
+// sent gzip-encoded. Zero or negative disables compression.
+func (c *Client) SetCompressThreshold(bytes int) {
+	c.compressThreshold = bytes
+}
+
+// SetRetryPolicy sets how many times a POST is attempted and the initial
+// backoff delay, which doubles (plus jitter) after each failed attempt.
+func (c *Client) SetRetryPolicy(maxAttempts int, baseDelay time.Duration) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	c.maxAttempts = maxAttempts
+	c.baseDelay = baseDelay
+}
+
+// Retries returns how many POST attempts have been repeated after a
+// transient failure since the client was created.
+func (c *Client) Retries() int {
+	return int(c.retries.Load())
+}
+
+// SetAttempt sets the run attempt number included in status updates.
+func (c *Client) SetAttempt(attempt int) {
+	c.attempt = attempt
+}
+
+// SetFingerprint sets the run fingerprint included in status updates so
+// Butler can recognise duplicate dispatches.
+func (c *Client) SetFingerprint(fingerprint string) {
+	c.fingerprint = fingerprint
+}
+
+// Redactor masks secret values in text. logstream.Redactor implements it.
+type Redactor interface {
+	Redact(text string) string
+}
+
+// SetRedactor masks the redactor's secrets in the plans, diagnostics and
+// command lines sent by ReportStatus and ReportPlan, as the log writers do
+// for log lines.
+func (c *Client) SetRedactor(r Redactor) {
+	c.redactor = r
+}
+
+// redact masks secrets in text if a redactor is set.
+func (c *Client) redact(text string) string {
+	if c.redactor == nil {
+		return text
+	}
+	return c.redactor.Redact(text)
+}
+
+// redactDiagnostics returns diags with secrets masked in their text.
+func (c *Client) redactDiagnostics(diags []Diagnostic) []Diagnostic {
+	out := make([]Diagnostic, len(diags))
+	for i, d := range diags {
+		d.Summary = c.redact(d.Summary)
+		d.Detail = c.redact(d.Detail)
+		out[i] = d
 	}
+	return out
 }
 
 // ReportStatus posts a status update.
@@ -46,27 +257,115 @@ func (c *Client) ReportStatus(ctx context.Context, status string, details *Statu
 	body := map[string]interface{}{
 		"status": status,
 	}
+	if c.attempt > 0 {
+		body["attempt"] = c.attempt
+	}
+	if c.fingerprint != "" {
+		body["fingerprint"] = c.fingerprint
+	}
 	if details != nil {
 		body["exit_code"] = details.ExitCode
 		body["resources_to_add"] = details.ResourcesToAdd
 		body["resources_to_change"] = details.ResourcesToChange
 		body["resources_to_destroy"] = details.ResourcesToDestroy
+		body["resources_to_replace"] = details.ResourcesToReplace
+		body["resources_to_read"] = details.ResourcesToRead
 		if details.PlanJSON != "" {
-			body["plan_json"] = details.PlanJSON
+			body["plan_json"] = c.redact(details.PlanJSON)
 		}
 		if details.PlanText != "" {
-			body["plan_text"] = details.PlanText
+			body["plan_text"] = c.redact(details.PlanText)
+		}
+		if details.SourceDurationMs != 0 {
+			body["source_duration_ms"] = details.SourceDurationMs
+			body["source_bytes"] = details.SourceBytes
+		}
+		if details.SourceCloneMs != 0 {
+			body["source_clone_ms"] = details.SourceCloneMs
+		}
+		if details.SourceCheckoutMs != 0 {
+			body["source_checkout_ms"] = details.SourceCheckoutMs
+		}
+		if len(details.UpgradeBlockers) > 0 {
+			body["upgrade_blockers"] = c.redactDiagnostics(details.UpgradeBlockers)
+		}
+		if details.LockFile != "" {
+			body["lock_file"] = details.LockFile
+		}
+		if len(details.Warnings) > 0 {
+			body["warnings"] = c.redactDiagnostics(details.Warnings)
+		}
+		if len(details.Diagnostics) > 0 {
+			body["diagnostics"] = c.redactDiagnostics(details.Diagnostics)
+		}
+		if details.StateResourceCountBefore != nil {
+			body["state_resource_count_before"] = *details.StateResourceCountBefore
+		}
+		if details.StateResourceCount != nil {
+			body["state_resource_count"] = *details.StateResourceCount
+		}
+		if details.FailureReason != "" {
+			body["failure_reason"] = details.FailureReason
+		}
+		if details.Backend != "" {
+			body["backend"] = details.Backend
+		}
+		if len(details.Commands) > 0 {
+			commands := make([]string, len(details.Commands))
+			for i, cmd := range details.Commands {
+				commands[i] = c.redact(cmd)
+			}
+			body["commands"] = commands
+		}
+		if len(details.LogPhases) > 0 {
+			body["log_phases"] = details.LogPhases
+		}
+		if details.Retries != nil {
+			body["retries"] = details.Retries
+		}
+		if details.BinarySource != "" {
+			body["binary_source"] = details.BinarySource
+		}
+		if details.BinaryCacheDir != "" {
+			body["binary_cache_dir"] = details.BinaryCacheDir
+		}
+		if len(details.Manifest) > 0 {
+			body["manifest"] = details.Manifest
+		}
+		if len(details.Providers) > 0 {
+			body["providers"] = details.Providers
+		}
+		if details.EstimatedApplySeconds > 0 {
+			body["estimated_apply_seconds"] = details.EstimatedApplySeconds
+		}
+		if details.PlanDigest != "" {
+			body["plan_digest"] = details.PlanDigest
+		}
+		if details.InitUpgraded {
+			body["init_upgraded"] = true
+		}
+		if details.LockFileChanged {
+			body["lockfile_changed"] = true
+			body["lockfile_providers"] = details.LockFileProviders
+		}
+		if details.LikelyProviderUpgradeNoise {
+			body["likely_provider_upgrade_noise"] = true
+		}
+		if details.PlanCountMismatch != "" {
+			body["plan_count_mismatch"] = details.PlanCountMismatch
 		}
 	}
 
-	return c.post(ctx, c.callbacks.StatusURL, body)
+	return c.deliver(ctx, EventStatus, c.callbacks.StatusURL, body)
 }
 
 // LogEntry is a single log line sent to the portal.
 type LogEntry struct {
-	Sequence int    `json:"sequence"`
-	Stream   string `json:"stream"`
-	Content  string `json:"content"`
+	Sequence  int       `json:"sequence"`
+	Stream    string    `json:"stream"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	Phase     string    `json:"phase,omitempty"` // "init", "plan", "apply", ...
 }
 
 // SendLogs posts a batch of log entries.
@@ -74,42 +373,219 @@ func (c *Client) SendLogs(ctx context.Context, logs []LogEntry) error {
 	if len(logs) == 0 {
 		return nil
 	}
-	return c.post(ctx, c.callbacks.LogsURL, map[string]interface{}{
+	return c.deliver(ctx, EventLogs, c.callbacks.LogsURL, map[string]interface{}{
 		"logs": logs,
 	})
 }
 
+// ReportPlan posts the plan JSON and human-readable plan text.
+func (c *Client) ReportPlan(ctx context.Context, planJSON, planText string) error {
+	body := map[string]interface{}{}
+	if planJSON != "" {
+		body["plan_json"] = c.redact(planJSON)
+	}
+	if planText != "" {
+		body["plan_text"] = c.redact(planText)
+	}
+	return c.deliver(ctx, EventPlan, c.callbacks.PlanURL, body)
+}
+
 // ReportOutputs posts terraform outputs.
 func (c *Client) ReportOutputs(ctx context.Context, outputs map[string]interface{}) error {
-	return c.post(ctx, c.callbacks.OutputsURL, map[string]interface{}{
+	return c.deliver(ctx, EventOutputs, c.callbacks.OutputsURL, map[string]interface{}{
 		"outputs": outputs,
 	})
 }
 
+// SensitiveOutputValue replaces the value of sensitive outputs in the
+// output_changes summary posted by ReportOutputChanges.
+const SensitiveOutputValue = "(sensitive value)"
+
+// ReportOutputChanges posts outputs like ReportOutputs, adding an
+// "output_changes" summary that says for each output whether its value
+// differs from previous, the outputs last reported for the module. The
+// outputs themselves are posted unchanged; only the summary redacts
+// sensitive values.
+func (c *Client) ReportOutputChanges(ctx context.Context, outputs, previous map[string]interface{}) error {
+	return c.deliver(ctx, EventOutputs, c.callbacks.OutputsURL, map[string]interface{}{
+		"outputs":        outputs,
+		"output_changes": diffOutputs(outputs, previous),
+	})
+}
+
+// diffOutputs summarizes each terraform output -json entry in outputs:
+// whether its value changed from previous, and the value to display, which
+// is redacted for sensitive outputs.
+func diffOutputs(outputs, previous map[string]interface{}) map[string]interface{} {
+	diffed := make(map[string]interface{}, len(outputs))
+	for name, output := range outputs {
+		prev, existed := previous[name]
+		sensitive := false
+		if m, ok := output.(map[string]interface{}); ok {
+			sensitive, _ = m["sensitive"].(bool)
+		}
+		entry := map[string]interface{}{
+			"changed":   !existed || outputDigest(prev) != outputDigest(output),
+			"sensitive": sensitive,
+			"value":     outputValue(output),
+		}
+		if sensitive {
+			entry["value"] = SensitiveOutputValue
+		}
+		diffed[name] = entry
+	}
+	return diffed
+}
+
+// outputDigest returns the SHA-256 digest of the JSON encoding of an
+// output's value. Map keys are encoded in order, so equal values have equal
+// digests.
+func outputDigest(v interface{}) string {
+	data, err := json.Marshal(outputValue(v))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// outputValue returns the value of a terraform output -json entry, or v
+// itself if it is a bare value.
+func outputValue(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		if value, ok := m["value"]; ok {
+			return value
+		}
+	}
+	return v
+}
+
+// post sends body as JSON to path. Connection errors and 5xx responses are
+// retried with exponential backoff; 4xx responses fail immediately. All
+// callback endpoints are idempotent, so retrying a POST is safe.
 func (c *Client) post(ctx context.Context, path string, body interface{}) error {
-	url := c.baseURL + path
+	data, gzipped, err := c.encode(body)
+	if err != nil {
+		return err
+	}
+	return c.retry(ctx, "posting to "+path, func() (bool, error) {
+		return c.postOnce(ctx, path, data, gzipped)
+	})
+}
 
+// encode marshals body as JSON, gzipping it above the compression
+// threshold.
+func (c *Client) encode(body interface{}) ([]byte, bool, error) {
 	data, err := json.Marshal(body)
 	if err != nil {
-		return fmt.Errorf("marshaling body: %w", err)
+		return nil, false, fmt.Errorf("marshaling body: %w", err)
 	}
+	if c.compressThreshold > 0 && len(data) > c.compressThreshold {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("compressing body: %w", err)
+		}
+		return compressed, true, nil
+	}
+	return data, false, nil
+}
+
+// retry calls attempt until it succeeds, reports a failure not worth
+// retrying, or maxAttempts is reached, backing off between attempts. what
+// describes the operation for the error when ctx ends first.
+func (c *Client) retry(ctx context.Context, what string, attempt func() (bool, error)) error {
+	var lastErr error
+	for i := 0; i < c.maxAttempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%s: %w (last error: %v)", what, ctx.Err(), lastErr)
+			case <-time.After(c.backoff(i)):
+			}
+			c.retries.Add(1)
+		}
+
+		retryable, err := attempt()
+		if err == nil {
+			return nil
+		}
+		if !retryable {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// postOnce makes a single POST attempt and reports whether a failure is
+// worth retrying.
+func (c *Client) postOnce(ctx context.Context, path string, data []byte, gzipped bool) (bool, error) {
+	url := c.baseURL + path
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return false, fmt.Errorf("creating request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header = c.headers(data, gzipped)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("posting to %s: %w", path, err)
+		return ctx.Err() == nil, fmt.Errorf("posting to %s: %w", path, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode >= 500 {
+		return true, fmt.Errorf("callback %s returned %d", path, resp.StatusCode)
+	}
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("callback %s returned %d", path, resp.StatusCode)
+		return false, fmt.Errorf("callback %s returned %d", path, resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// headers returns the headers describing an encoded body: its content
+// type and encoding, the bearer token, and the signature if a signing
+// secret is set.
+func (c *Client) headers(data []byte, gzipped bool) http.Header {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if gzipped {
+		header.Set("Content-Encoding", "gzip")
 	}
+	header.Set("Authorization", "Bearer "+c.token)
+	if len(c.signingSecret) > 0 {
+		header.Set(SignatureHeader, sign(c.signingSecret, data))
+	}
+	return header
+}
 
-	return nil
+// sign returns the SignatureHeader value for body.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// backoff returns the delay before the given retry attempt (1-based):
+// baseDelay doubled per attempt plus up to 50% random jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.baseDelay << (attempt - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
 }
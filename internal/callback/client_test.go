@@ -4,11 +4,20 @@
 package callback
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/butlerdotdev/butler-runner/internal/config"
 )
@@ -77,6 +86,7 @@ func TestReportStatusError(t *testing.T) {
 	client := NewClient(server.URL, "test-token", config.CallbackURLs{
 		StatusURL: "/v1/ci/module-runs/run-1/status",
 	})
+	client.SetRetryPolicy(2, time.Millisecond)
 
 	err := client.ReportStatus(context.Background(), "running", nil)
 	if err == nil {
@@ -84,6 +94,204 @@ func TestReportStatusError(t *testing.T) {
 	}
 }
 
+func TestReportStatusRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+	client.SetRetryPolicy(5, time.Millisecond)
+
+	if err := client.ReportStatus(context.Background(), "succeeded", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+	if client.Retries() != 2 {
+		t.Errorf("expected 2 retries, got %d", client.Retries())
+	}
+}
+
+func TestReportStatusDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+	client.SetRetryPolicy(5, time.Millisecond)
+
+	if err := client.ReportStatus(context.Background(), "running", nil); err == nil {
+		t.Error("expected error for 401 response")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls.Load())
+	}
+}
+
+func TestReportPlan(t *testing.T) {
+	var receivedBody map[string]interface{}
+	var receivedAuth, receivedPath string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedAuth = r.Header.Get("Authorization")
+		receivedPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+		PlanURL:   "/v1/ci/module-runs/run-1/plan",
+	})
+
+	err := client.ReportPlan(context.Background(), `{"format_version":"1.2"}`, "Plan: 1 to add")
+	if err != nil {
+		t.Fatalf("ReportPlan failed: %v", err)
+	}
+
+	if receivedPath != "/v1/ci/module-runs/run-1/plan" {
+		t.Errorf("expected plan endpoint, got %q", receivedPath)
+	}
+	if receivedAuth != "Bearer test-token" {
+		t.Errorf("expected auth header 'Bearer test-token', got %q", receivedAuth)
+	}
+	if receivedBody["plan_json"] != `{"format_version":"1.2"}` {
+		t.Errorf("unexpected plan_json: %v", receivedBody["plan_json"])
+	}
+	if receivedBody["plan_text"] != "Plan: 1 to add" {
+		t.Errorf("unexpected plan_text: %v", receivedBody["plan_text"])
+	}
+}
+
+// redactFunc adapts a function to the Redactor interface.
+type redactFunc func(string) string
+
+func (f redactFunc) Redact(text string) string { return f(text) }
+
+func TestReportsAreRedacted(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+		PlanURL:   "/v1/ci/module-runs/run-1/plan",
+	})
+	client.SetRedactor(redactFunc(func(text string) string {
+		return strings.ReplaceAll(text, "hunter2", "***")
+	}))
+
+	err := client.ReportStatus(context.Background(), "failed", &StatusDetails{
+		PlanText:    `+ password = "hunter2"`,
+		PlanJSON:    `{"after":{"password":"hunter2"}}`,
+		Warnings:    []Diagnostic{{Severity: "warning", Summary: "Deprecated", Detail: "password hunter2 is weak"}},
+		Diagnostics: []Diagnostic{{Severity: "error", Summary: "Invalid value hunter2"}},
+		Commands:    []string{"terraform plan -var password=hunter2"},
+	})
+	if err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if err := client.ReportPlan(context.Background(), `{"password":"hunter2"}`, `password = "hunter2"`); err != nil {
+		t.Fatalf("ReportPlan failed: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(bodies))
+	}
+	for _, body := range bodies {
+		if strings.Contains(body, "hunter2") {
+			t.Errorf("payload leaks a secret: %s", body)
+		}
+		if !strings.Contains(body, "***") {
+			t.Errorf("expected masked values in payload: %s", body)
+		}
+	}
+}
+
+func TestReportStatusCompressesLargePlan(t *testing.T) {
+	var encoding string
+	var receivedBody map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(zr).Decode(&receivedBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+
+	var sb strings.Builder
+	sb.WriteString(`{"resource_changes":[`)
+	for i := 0; i < 20000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `{"address":"aws_instance.web[%d]","change":{"actions":["create"]}}`, i)
+	}
+	sb.WriteString("]}")
+	planJSON := sb.String()
+
+	err := client.ReportStatus(context.Background(), "succeeded", &StatusDetails{PlanJSON: planJSON})
+	if err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+
+	if encoding != "gzip" {
+		t.Errorf("expected gzip Content-Encoding, got %q", encoding)
+	}
+	if receivedBody["plan_json"] != planJSON {
+		t.Error("decompressed plan_json does not match the original")
+	}
+}
+
+func TestReportStatusSmallPayloadUncompressed(t *testing.T) {
+	var encoding string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+
+	if err := client.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if encoding != "" {
+		t.Errorf("expected small payload to be sent uncompressed, got Content-Encoding %q", encoding)
+	}
+}
+
 func TestReportOutputs(t *testing.T) {
 	var receivedBody map[string]interface{}
 
@@ -109,3 +317,103 @@ func TestReportOutputs(t *testing.T) {
 		t.Error("expected outputs in body")
 	}
 }
+
+func TestReportOutputChanges(t *testing.T) {
+	var receivedBody struct {
+		Outputs map[string]map[string]interface{} `json:"outputs"`
+		Changes map[string]map[string]interface{} `json:"output_changes"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		OutputsURL: "/v1/ci/module-runs/run-1/outputs",
+	})
+
+	output := func(value interface{}, sensitive bool) map[string]interface{} {
+		return map[string]interface{}{"value": value, "type": "string", "sensitive": sensitive}
+	}
+	previous := map[string]interface{}{
+		"vpc_id":      output("vpc-abc123", false),
+		"subnet_id":   output("subnet-old", false),
+		"db_password": output("hunter2", true),
+		"api_key":     output("key-1", true),
+	}
+	outputs := map[string]interface{}{
+		"vpc_id":      output("vpc-abc123", false),
+		"subnet_id":   output("subnet-new", false),
+		"db_password": output("hunter2", true),
+		"api_key":     output("key-2", true),
+		"new_output":  output("fresh", false),
+	}
+	if err := client.ReportOutputChanges(context.Background(), outputs, previous); err != nil {
+		t.Fatalf("ReportOutputChanges failed: %v", err)
+	}
+
+	want := map[string]struct {
+		changed bool
+		value   string
+	}{
+		"vpc_id":      {false, "vpc-abc123"},
+		"subnet_id":   {true, "subnet-new"},
+		"db_password": {false, SensitiveOutputValue},
+		"api_key":     {true, SensitiveOutputValue},
+		"new_output":  {true, "fresh"},
+	}
+	if len(receivedBody.Changes) != len(want) {
+		t.Fatalf("expected %d output changes, got %+v", len(want), receivedBody.Changes)
+	}
+	for name, w := range want {
+		got := receivedBody.Changes[name]
+		if got["changed"] != w.changed {
+			t.Errorf("%s: changed = %v, want %v", name, got["changed"], w.changed)
+		}
+		if got["value"] != w.value {
+			t.Errorf("%s: value = %v, want %v", name, got["value"], w.value)
+		}
+	}
+
+	// The stored outputs keep their real values for downstream modules.
+	for name, output := range outputs {
+		want := output.(map[string]interface{})["value"]
+		if got := receivedBody.Outputs[name]["value"]; got != want {
+			t.Errorf("%s: stored value = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSignedPayloads(t *testing.T) {
+	const secret = "shared-secret"
+	var body []byte
+	var signature string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+	if err := client.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if signature != "" {
+		t.Errorf("expected no signature without a secret, got %q", signature)
+	}
+
+	client.SetSigningSecret(secret)
+	if err := client.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("expected signature %q, got %q", want, signature)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package callback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Event names, appended to the subject prefix when publishing.
+const (
+	EventStatus  = "status"
+	EventLogs    = "logs"
+	EventPlan    = "plan"
+	EventOutputs = "outputs"
+)
+
+// Publisher delivers run events to a message queue.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, header http.Header, data []byte) error
+}
+
+// ErrPublishRejected marks a publish the server refused and would refuse
+// again, such as one the credentials may not publish to; it is not
+// retried.
+var ErrPublishRejected = errors.New("publish rejected")
+
+// SetPublisher makes the client publish status, log, plan, and output
+// events to p instead of posting them to the callback URLs. Each event is
+// the body that would have been posted, encoded and signed the same way
+// with the matching headers, sent on the subject subjectPrefix + "." +
+// event name.
+func (c *Client) SetPublisher(p Publisher, subjectPrefix string) {
+	c.publisher = p
+	c.subjectPrefix = subjectPrefix
+}
+
+// deliver sends an event to the publisher if one is set, and otherwise
+// posts it to path. Failed publishes are retried like posts.
+func (c *Client) deliver(ctx context.Context, event, path string, body interface{}) error {
+	if c.publisher == nil {
+		return c.post(ctx, path, body)
+	}
+	data, gzipped, err := c.encode(body)
+	if err != nil {
+		return err
+	}
+	header := c.headers(data, gzipped)
+	header.Del("Authorization")
+	subject := c.subjectPrefix + "." + event
+	return c.retry(ctx, "publishing to "+subject, func() (bool, error) {
+		if err := c.publisher.Publish(ctx, subject, header, data); err != nil {
+			return ctx.Err() == nil && !errors.Is(err, ErrPublishRejected), fmt.Errorf("publishing to %s: %w", subject, err)
+		}
+		return false, nil
+	})
+}
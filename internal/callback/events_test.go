@@ -0,0 +1,145 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package callback
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// fakePublisher records every published event and its headers. The first
+// failures publishes fail with err.
+type fakePublisher struct {
+	mu       sync.Mutex
+	events   map[string][]byte
+	headers  map[string]http.Header
+	attempts int
+	failures int
+	err      error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, subject string, header http.Header, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts++
+	if p.attempts <= p.failures {
+		return p.err
+	}
+	p.events[subject] = data
+	if p.headers != nil {
+		p.headers[subject] = header
+	}
+	return nil
+}
+
+func TestPublisherReplacesHTTPCallbacks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected HTTP callback to %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-token", config.CallbackURLs{
+		StatusURL:  "/status",
+		LogsURL:    "/logs",
+		OutputsURL: "/outputs",
+	})
+	pub := &fakePublisher{events: map[string][]byte{}}
+	client.SetPublisher(pub, "butler.runs.run-1")
+
+	ctx := context.Background()
+	if err := client.ReportStatus(ctx, "succeeded", &StatusDetails{ExitCode: 0}); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if err := client.SendLogs(ctx, []LogEntry{{Sequence: 1, Stream: "stdout", Content: "hello"}}); err != nil {
+		t.Fatalf("SendLogs failed: %v", err)
+	}
+	if err := client.ReportOutputs(ctx, map[string]interface{}{"vpc_id": "vpc-abc123"}); err != nil {
+		t.Fatalf("ReportOutputs failed: %v", err)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(pub.events["butler.runs.run-1.status"], &status); err != nil || status.Status != "succeeded" {
+		t.Errorf("expected status event, got %s (%v)", pub.events["butler.runs.run-1.status"], err)
+	}
+	var logs struct {
+		Logs []LogEntry `json:"logs"`
+	}
+	if err := json.Unmarshal(pub.events["butler.runs.run-1.logs"], &logs); err != nil || len(logs.Logs) != 1 || logs.Logs[0].Content != "hello" {
+		t.Errorf("expected logs event, got %s (%v)", pub.events["butler.runs.run-1.logs"], err)
+	}
+	var outputs struct {
+		Outputs map[string]interface{} `json:"outputs"`
+	}
+	if err := json.Unmarshal(pub.events["butler.runs.run-1.outputs"], &outputs); err != nil || outputs.Outputs["vpc_id"] != "vpc-abc123" {
+		t.Errorf("expected outputs event, got %s (%v)", pub.events["butler.runs.run-1.outputs"], err)
+	}
+}
+
+func TestPublisherSignsAndCompressesEvents(t *testing.T) {
+	client := NewClient("http://butler.invalid", "test-token", config.CallbackURLs{LogsURL: "/logs"})
+	client.SetSigningSecret("s3cret")
+	client.SetCompressThreshold(10)
+	pub := &fakePublisher{events: map[string][]byte{}, headers: map[string]http.Header{}}
+	client.SetPublisher(pub, "butler.runs.run-1")
+
+	if err := client.SendLogs(context.Background(), []LogEntry{{Sequence: 1, Stream: "stdout", Content: "hello"}}); err != nil {
+		t.Fatalf("SendLogs failed: %v", err)
+	}
+	data, header := pub.events["butler.runs.run-1.logs"], pub.headers["butler.runs.run-1.logs"]
+	if got := header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("expected gzip content encoding, got %q", got)
+	}
+	if got, want := header.Get(SignatureHeader), sign([]byte("s3cret"), data); got != want {
+		t.Errorf("expected signature %q over the event as sent, got %q", want, got)
+	}
+	if got := header.Get("Authorization"); got != "" {
+		t.Errorf("expected no bearer token in event headers, got %q", got)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("event is not gzipped: %v", err)
+	}
+	var logs struct {
+		Logs []LogEntry `json:"logs"`
+	}
+	if err := json.NewDecoder(zr).Decode(&logs); err != nil || len(logs.Logs) != 1 {
+		t.Errorf("expected logs event, got %v (%v)", logs, err)
+	}
+}
+
+func TestPublisherRetries(t *testing.T) {
+	client := NewClient("http://butler.invalid", "test-token", config.CallbackURLs{StatusURL: "/status"})
+	client.SetRetryPolicy(3, time.Millisecond)
+
+	pub := &fakePublisher{events: map[string][]byte{}, failures: 2, err: errors.New("nats: timeout")}
+	client.SetPublisher(pub, "butler.runs.run-1")
+	if err := client.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("expected publish to succeed after retries, got %v", err)
+	}
+	if pub.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", pub.attempts)
+	}
+
+	rejected := &fakePublisher{events: map[string][]byte{}, failures: 3, err: fmt.Errorf("%w: permissions violation", ErrPublishRejected)}
+	client.SetPublisher(rejected, "butler.runs.run-1")
+	if err := client.ReportStatus(context.Background(), "running", nil); !errors.Is(err, ErrPublishRejected) {
+		t.Fatalf("expected rejected publish error, got %v", err)
+	}
+	if rejected.attempts != 1 {
+		t.Errorf("expected a rejected publish not to be retried, got %d attempts", rejected.attempts)
+	}
+}
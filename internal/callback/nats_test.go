@@ -0,0 +1,190 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package callback
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeNATSServer accepts clients, answers PINGs with PONG, and sends each
+// published message on msgs. Subjects named "forbidden" are rejected,
+// "stall" is never answered, and "drop" closes the connection.
+func fakeNATSServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	msgs := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeNATS(conn, msgs)
+		}
+	}()
+	return "nats://" + ln.Addr().String(), msgs
+}
+
+func serveFakeNATS(conn net.Conn, msgs chan<- string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"headers\":true,\"max_payload\":64}\r\n")
+	stalled := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PING":
+			if !stalled {
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		case strings.HasPrefix(line, "PUB "), strings.HasPrefix(line, "HPUB "):
+			var subject string
+			var headerSize, size int
+			if strings.HasPrefix(line, "HPUB ") {
+				fmt.Sscanf(line, "HPUB %s %d %d", &subject, &headerSize, &size)
+			} else {
+				fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			headers, payload := payload[:headerSize], payload[headerSize:size]
+			switch subject {
+			case "forbidden":
+				fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to forbidden'\r\n")
+				continue
+			case "stall":
+				stalled = true
+				continue
+			case "drop":
+				return
+			}
+			if len(headers) > 0 {
+				msgs <- subject + " " + strings.TrimSpace(string(headers)) + " " + string(payload)
+				continue
+			}
+			msgs <- subject + " " + string(payload)
+		}
+	}
+}
+
+func TestNATSPublisher(t *testing.T) {
+	url, msgs := fakeNATSServer(t)
+	pub, err := DialNATS(url, NATSOptions{})
+	if err != nil {
+		t.Fatalf("DialNATS failed: %v", err)
+	}
+	defer pub.Close()
+
+	header := http.Header{SignatureHeader: {"sha256=abc"}}
+	if err := pub.Publish(context.Background(), "butler.runs.run-1.status", header, []byte(`{"status":"running"}`)); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if got, want := <-msgs, "butler.runs.run-1.status NATS/1.0\r\nX-Butler-Signature: sha256=abc "+`{"status":"running"}`; got != want {
+		t.Errorf("published %q, want %q", got, want)
+	}
+
+	err = pub.Publish(context.Background(), "forbidden", nil, []byte(`{}`))
+	if !errors.Is(err, ErrPublishRejected) || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("expected rejected publish, got %v", err)
+	}
+	if err := pub.Publish(context.Background(), "allowed", nil, []byte(`{}`)); err != nil {
+		t.Fatalf("Publish after a rejected publish failed: %v", err)
+	}
+	if got := <-msgs; got != "allowed {}" {
+		t.Errorf("published %q, want %q", got, "allowed {}")
+	}
+}
+
+func TestNATSPublishHonoursCancellation(t *testing.T) {
+	url, _ := fakeNATSServer(t)
+	pub, err := DialNATS(url, NATSOptions{})
+	if err != nil {
+		t.Fatalf("DialNATS failed: %v", err)
+	}
+	defer pub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() { done <- pub.Publish(ctx, "stall", nil, []byte(`{}`)) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish did not return after the context was cancelled")
+	}
+}
+
+func TestNATSPublishRefusesOversizedMessage(t *testing.T) {
+	url, msgs := fakeNATSServer(t)
+	pub, err := DialNATS(url, NATSOptions{})
+	if err != nil {
+		t.Fatalf("DialNATS failed: %v", err)
+	}
+	defer pub.Close()
+
+	err = pub.Publish(context.Background(), "big", nil, []byte(strings.Repeat("x", 65)))
+	if !errors.Is(err, ErrPublishRejected) || !errors.Is(err, nats.ErrMaxPayload) {
+		t.Errorf("expected payload size error, got %v", err)
+	}
+	if err := pub.Publish(context.Background(), "small", nil, []byte(`{}`)); err != nil {
+		t.Fatalf("Publish after oversized message failed: %v", err)
+	}
+	if got := <-msgs; got != "small {}" {
+		t.Errorf("published %q, want %q", got, "small {}")
+	}
+}
+
+func TestNATSPublishReconnects(t *testing.T) {
+	url, msgs := fakeNATSServer(t)
+	pub, err := DialNATS(url, NATSOptions{})
+	if err != nil {
+		t.Fatalf("DialNATS failed: %v", err)
+	}
+	defer pub.Close()
+
+	if err := pub.Publish(context.Background(), "drop", nil, []byte(`{}`)); err == nil {
+		t.Fatal("expected an error when the server closed the connection")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := pub.Publish(ctx, "after", nil, []byte(`{}`)); err != nil {
+		t.Fatalf("Publish after the connection dropped failed: %v", err)
+	}
+	if got := <-msgs; got != "after {}" {
+		t.Errorf("published %q, want %q", got, "after {}")
+	}
+}
+
+func TestDialNATSRejectsMissingCreds(t *testing.T) {
+	url, _ := fakeNATSServer(t)
+	if _, err := DialNATS(url, NATSOptions{CredsFile: filepath.Join(t.TempDir(), "missing.creds")}); err == nil {
+		t.Fatal("expected an error for a missing credentials file")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cancel
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// IdleWatcher cancels a run that has produced no output for a configured
+// duration. It implements io.Writer so it can be teed alongside the log
+// streams; every write counts as activity and resets the idle clock.
+type IdleWatcher struct {
+	timeout time.Duration
+	logger  *slog.Logger
+	mu      sync.Mutex
+	last    time.Time
+}
+
+// NewIdleWatcher creates a new idle watcher with the given timeout.
+func NewIdleWatcher(timeout time.Duration, logger *slog.Logger) *IdleWatcher {
+	return &IdleWatcher{
+		timeout: timeout,
+		logger:  logger,
+		last:    time.Now(),
+	}
+}
+
+// Write implements io.Writer and records activity.
+func (w *IdleWatcher) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.mu.Lock()
+		w.last = time.Now()
+		w.mu.Unlock()
+	}
+	return len(p), nil
+}
+
+// Start waits for the idle timeout to elapse without activity. When it does,
+// calls cancelFunc.
+func (w *IdleWatcher) Start(ctx context.Context, cancelFunc context.CancelFunc) {
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			idle := time.Since(w.lastActivity())
+			if idle >= w.timeout {
+				w.logger.Info("no output within idle timeout, initiating shutdown",
+					"idleTimeout", w.timeout,
+				)
+				cancelFunc()
+				return
+			}
+			timer.Reset(w.timeout - idle)
+		}
+	}
+}
+
+func (w *IdleWatcher) lastActivity() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cancel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeExecutor writes a line to out every interval until stop is closed.
+func fakeExecutor(out io.Writer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, _ = fmt.Fprintf(out, "line %d\n", i)
+		}
+	}
+}
+
+func TestIdleWatcherFiresWhenOutputStops(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	watcher := NewIdleWatcher(100*time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fired := make(chan struct{})
+	go watcher.Start(ctx, func() { close(fired) })
+
+	// Produce output briefly, then go silent.
+	stop := make(chan struct{})
+	go fakeExecutor(watcher, 10*time.Millisecond, stop)
+	time.Sleep(150 * time.Millisecond)
+	close(stop)
+
+	select {
+	case <-fired:
+		// Idle timeout fired as expected
+	case <-time.After(2 * time.Second):
+		t.Error("idle watcher did not fire after output stopped")
+	}
+}
+
+func TestIdleWatcherDoesNotFireWhileActive(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	watcher := NewIdleWatcher(100*time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	fired := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watcher.Start(ctx, func() { close(fired) })
+		close(done)
+	}()
+
+	stop := make(chan struct{})
+	go fakeExecutor(watcher, 10*time.Millisecond, stop)
+
+	select {
+	case <-fired:
+		t.Error("idle watcher fired while output was being produced")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	close(stop)
+	cancel()
+	<-done
+}
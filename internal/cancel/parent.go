@@ -0,0 +1,49 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cancel
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// parentPollInterval is how often ParentWatcher checks the parent process.
+var parentPollInterval = time.Second
+
+// getppid is a variable so tests can simulate the parent exiting.
+var getppid = os.Getppid
+
+// ParentWatcher cancels a run when the process that started the runner
+// exits. An orphaned process is reparented, so a change of parent PID
+// means the supervisor is gone and nothing will collect the result.
+type ParentWatcher struct {
+	logger *slog.Logger
+	ppid   int
+}
+
+// NewParentWatcher creates a watcher for the current parent process.
+func NewParentWatcher(logger *slog.Logger) *ParentWatcher {
+	return &ParentWatcher{logger: logger, ppid: getppid()}
+}
+
+// Start polls the parent PID. When it changes, calls cancelFunc.
+func (w *ParentWatcher) Start(ctx context.Context, cancelFunc context.CancelFunc) {
+	ticker := time.NewTicker(parentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ppid := getppid(); ppid != w.ppid {
+				w.logger.Warn("parent process exited, cancelling run", "parentPid", w.ppid)
+				cancelFunc()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cancel
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParentWatcherFiresWhenParentExits(t *testing.T) {
+	var ppid atomic.Int64
+	ppid.Store(4242)
+	origGetppid, origInterval := getppid, parentPollInterval
+	getppid = func() int { return int(ppid.Load()) }
+	parentPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { getppid, parentPollInterval = origGetppid, origInterval })
+
+	watcher := NewParentWatcher(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fired := make(chan struct{})
+	go watcher.Start(ctx, func() { close(fired) })
+
+	select {
+	case <-fired:
+		t.Fatal("watcher fired while the parent was still alive")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The orphaned runner is reparented, e.g. to init.
+	ppid.Store(1)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("expected watcher to fire after the parent exited")
+	}
+}
@@ -5,31 +5,148 @@ package config
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 )
 
 // ExecutionConfig is the full execution config fetched from Butler API.
 type ExecutionConfig struct {
-	RunID            string                 `json:"runId"`
-	Operation        string                 `json:"operation"`
-	TerraformVersion string                 `json:"terraformVersion"`
-	Source           SourceConfig           `json:"source"`
-	Variables        map[string]Variable    `json:"variables"`
-	EnvVars          map[string]Variable    `json:"envVars"`
-	UpstreamOutputs  map[string]interface{} `json:"upstreamOutputs"`
-	StateBackend     *StateBackendConfig    `json:"stateBackend"`
-	Callbacks        CallbackURLs           `json:"callbacks"`
+	RunID                 string                 `json:"runId"`
+	Attempt               int                    `json:"attempt"` // 1-based; 0 = unknown
+	Operation             string                 `json:"operation"`
+	TerraformVersion      string                 `json:"terraformVersion"`
+	TerraformDistribution string                 `json:"terraformDistribution"` // "terraform" or "opentofu"
+	Source                SourceConfig           `json:"source"`
+	Variables             map[string]Variable    `json:"variables"`
+	EnvVars               map[string]Variable    `json:"envVars"`
+	UpstreamOutputs       map[string]interface{} `json:"upstreamOutputs"`
+	StateBackend          *StateBackendConfig    `json:"stateBackend"`
+	Callbacks             CallbackURLs           `json:"callbacks"`
+	IdleTimeoutSeconds    int                    `json:"idleTimeoutSeconds"`  // 0 = disabled
+	SecureDeletePasses    int                    `json:"secureDeletePasses"`  // 0 = one pass
+	SecureDeletePattern   string                 `json:"secureDeletePattern"` // "zeros" (default) or "random"
+	SecureDeleteAlways    bool                   `json:"secureDeleteAlways"`  // secure-delete tfvars even without sensitive values
+	CheckUpgradeBlockers  bool                   `json:"checkUpgradeBlockers"`
+	UpgradeTargetVersion  string                 `json:"upgradeTargetVersion"` // empty = any future version
+	PlanFile              string                 `json:"planFile"`             // saved plan shared by plan and apply runs; absolute
+	DestroyPlan           bool                   `json:"destroyPlan"`          // plan saves a destroy plan for a later destroy run
+	ApprovedPlanDigest    string                 `json:"approvedPlanDigest"`   // apply refuses a saved plan with another digest
+	LockPlatforms         []string               `json:"lockPlatforms"`        // for providers-lock, e.g. "linux_amd64"
+	StrictWarnings        bool                   `json:"strictWarnings"`       // fail the run on any unsuppressed warning
+	SuppressWarnings      []string               `json:"suppressWarnings"`     // warning summaries to ignore (substring match)
+	Targets               []string               `json:"targets"`              // resource addresses passed as -target
+	Isolate               bool                   `json:"isolate"`              // Linux only: run terraform in its own namespaces
+	IsolationRoot         string                 `json:"isolationRoot"`        // chroot for isolated runs; required with isolate
+	Workspace             string                 `json:"workspace"`            // empty = "default"
+	GracePeriodSeconds    int                    `json:"gracePeriodSeconds"`   // SIGINT to SIGKILL on cancel; 0 = default
+	TimeoutSeconds        int                    `json:"timeoutSeconds"`       // per terraform invocation; 0 = none
+	LockTimeoutSeconds    int                    `json:"lockTimeoutSeconds"`   // wait for a held state lock; 0 = fail fast
+
+	// ProtectedResourceTypes lists resource types apply and destroy must not
+	// destroy or replace, unless the address is in AllowedDestroys.
+	ProtectedResourceTypes []string `json:"protectedResourceTypes"`
+	AllowedDestroys        []string `json:"allowedDestroys"`
+
+	// LargePlanThreshold flags plans changing more resources than this;
+	// with BlockLargePlans they fail instead. 0 = no limit.
+	LargePlanThreshold int  `json:"largePlanThreshold"`
+	BlockLargePlans    bool `json:"blockLargePlans"`
+
+	// DetectSchemaNoise flags plans whose changes are all updates to
+	// computed or newly defaulted attributes, a common symptom of a
+	// provider upgrade. The flag is informational, never a warning.
+	DetectSchemaNoise bool `json:"detectSchemaNoise"`
+
+	StateBackup *StateBackupConfig `json:"stateBackup"` // optional
+
+	// RedactEnvVars names environment variables whose values are masked in
+	// streamed logs, in addition to well-known credential variables. A
+	// trailing "*" matches a prefix.
+	RedactEnvVars []string `json:"redactEnvVars"`
+
+	// LogFlushRetries is how many times a log batch that failed to send
+	// is resent before it is dropped; nil = default, 0 = never.
+	LogFlushRetries *int `json:"logFlushRetries"`
+
+	// ReportManifest reports the path and SHA-256 of every file in the
+	// working directory, so the code that ran can be attested.
+	ReportManifest bool `json:"reportManifest"`
+
+	// AllowOutputErrors reports an apply that changed resources but failed
+	// to evaluate outputs as "succeeded_with_output_errors" rather than
+	// failed.
+	AllowOutputErrors bool `json:"allowOutputErrors"`
+
+	// ReportOutputChanges adds a summary to the outputs reported after
+	// apply flagging each as changed or not, by comparing it with
+	// PreviousOutputs, the outputs Butler last received for this module.
+	ReportOutputChanges bool                   `json:"reportOutputChanges"`
+	PreviousOutputs     map[string]interface{} `json:"previousOutputs"`
+
+	// VarFiles are extra -var-file paths, relative to the working directory.
+	// Variables still override them.
+	VarFiles []string `json:"varFiles"`
+
+	// ApplyTimingSeconds are historical create durations per resource type,
+	// used to refine the estimated apply time reported after a plan.
+	ApplyTimingSeconds map[string]float64 `json:"applyTimingSeconds"`
+
+	// Provider download tuning for terraform init; zero values keep
+	// terraform's defaults.
+	PluginCacheDir           string `json:"pluginCacheDir"`
+	RegistryTimeoutSeconds   int    `json:"registryTimeoutSeconds"`
+	RegistryDiscoveryRetries int    `json:"registryDiscoveryRetries"`
+	// PluginCacheMinFreeMB prunes least-recently-used providers from the
+	// plugin cache when less disk than this is free; 0 = never prune.
+	PluginCacheMinFreeMB int `json:"pluginCacheMinFreeMB"`
+	// InitStallTimeoutSeconds fails init if a provider or module download
+	// makes no progress for this long; 0 = disabled.
+	InitStallTimeoutSeconds int `json:"initStallTimeoutSeconds"`
+	// UpgradeOnLockMismatch retries init once with -upgrade when the lock
+	// file has no checksums for this platform. Off by default so runs stay
+	// reproducible.
+	UpgradeOnLockMismatch bool `json:"upgradeOnLockMismatch"`
+	// DataDir holds a persistent TF_DATA_DIR per module, shared across its
+	// runs and locked by each; DataDirClean names the parts of it removed
+	// before init ("modules", "providers", "backend", "workspace"). The
+	// backend configuration is always removed.
+	DataDir      string   `json:"dataDir"`
+	DataDirClean []string `json:"dataDirClean"`
+	// SkipBackend runs init with -backend=false. Validate always skips
+	// the backend.
+	SkipBackend bool `json:"skipBackend"`
+
+	// FetchRetries is set by FetchConfig to the number of retries it took
+	// to fetch this config; it is not part of the API payload.
+	FetchRetries int `json:"-"`
 }
 
 type SourceConfig struct {
-	Type             string `json:"type"` // "git"
+	Type             string `json:"type"` // "git", "archive", or "local"
 	GitRepo          string `json:"gitRepo"`
 	GitRef           string `json:"gitRef"`
+	GitToken         string `json:"gitToken"`   // optional, for private HTTPS repos
+	ArchiveURL       string `json:"archiveUrl"` // .tar.gz or .zip, for "archive"
+	LocalPath        string `json:"localPath"`  // existing directory, for "local"
 	WorkingDirectory string `json:"workingDirectory"`
+
+	// RefNotFoundRetries is how many times to retry a git clone whose ref
+	// does not exist yet, bounded by CloneTimeoutSeconds (0 = no limit).
+	RefNotFoundRetries  int `json:"refNotFoundRetries"`
+	CloneTimeoutSeconds int `json:"cloneTimeoutSeconds"`
+
+	// AllowModuleEscape skips checking that the working directory and
+	// local module sources stay within the source tree.
+	AllowModuleEscape bool `json:"allowModuleEscape"`
 }
 
 type Variable struct {
@@ -37,6 +154,13 @@ type Variable struct {
 	Sensitive bool        `json:"sensitive"`
 }
 
+// StateBackupConfig says where to store an encrypted copy of the state
+// before apply, destroy, or refresh changes it.
+type StateBackupConfig struct {
+	UploadURL     string `json:"uploadUrl"`     // PUT destination, e.g. a presigned URL
+	EncryptionKey string `json:"encryptionKey"` // base64 AES-256 key
+}
+
 type StateBackendConfig struct {
 	Type   string                 `json:"type"`
 	Config map[string]interface{} `json:"config"`
@@ -49,43 +173,217 @@ type CallbackURLs struct {
 	OutputsURL string `json:"outputsUrl"`
 }
 
-// FetchConfig retrieves the execution config from Butler API.
-func FetchConfig(ctx context.Context, logger *slog.Logger, butlerURL, runID, token string) (*ExecutionConfig, error) {
-	url := fmt.Sprintf("%s/v1/ci/module-runs/%s/config", butlerURL, runID)
+// connectionCheckTimeout bounds CheckConnection so an unreachable API fails
+// fast rather than at the first real request.
+const connectionCheckTimeout = 10 * time.Second
+
+// CheckConnection verifies that the Butler API is reachable and accepts
+// token by making an authenticated GET of the run's status endpoint. The
+// endpoint only takes POSTs, so any response but 401 or 403 shows the API
+// is up and the token was accepted.
+func CheckConnection(ctx context.Context, butlerURL, runID, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, connectionCheckTimeout)
+	defer cancel()
 
+	url := fmt.Sprintf("%s/v1/ci/module-runs/%s/status", butlerURL, runID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating config request: %w", err)
+		return fmt.Errorf("creating connection check request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	logger.Info("fetching execution config", "url", url, "runId", runID)
-
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching config: %w", err)
+		return fmt.Errorf("cannot reach Butler API at %s: %w", butlerURL, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("config endpoint returned %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("invalid token: Butler API at %s returned %d", butlerURL, resp.StatusCode)
 	}
+	return nil
+}
 
-	var cfg ExecutionConfig
-	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("decoding config: %w", err)
+// Retry policy for fetching the execution config, the same as the callback
+// client's. The delay doubles after each failed attempt; tests shorten it.
+const fetchMaxAttempts = 5
+
+var fetchBaseDelay = 500 * time.Millisecond
+
+// FetchConfig retrieves the execution config from Butler API. Connection
+// errors and 5xx responses are retried with backoff; the number of retries
+// is recorded in FetchRetries.
+func FetchConfig(ctx context.Context, logger *slog.Logger, butlerURL, runID, token string) (*ExecutionConfig, error) {
+	url := fmt.Sprintf("%s/v1/ci/module-runs/%s/config", butlerURL, runID)
+
+	logger.Info("fetching execution config", "url", url, "runId", runID)
+
+	var cfg *ExecutionConfig
+	retries := 0
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		var err error
+		cfg, retryable, err = fetchConfigOnce(ctx, url, token)
+		if err == nil {
+			break
+		}
+		if !retryable || attempt+1 >= fetchMaxAttempts {
+			return nil, err
+		}
+		delay := fetchBaseDelay << attempt
+		logger.Warn("fetching config failed, retrying", "error", err, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fetching config: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		retries++
 	}
+	cfg.FetchRetries = retries
 
 	// Log config metadata only — NEVER log variables/secrets
 	logger.Info("execution config received",
 		"runId", cfg.RunID,
+		"attempt", cfg.Attempt,
 		"operation", cfg.Operation,
 		"terraformVersion", cfg.TerraformVersion,
+		"terraformDistribution", cfg.TerraformDistribution,
 		"sourceType", cfg.Source.Type,
 		"variableCount", len(cfg.Variables),
 		"envVarCount", len(cfg.EnvVars),
 	)
 
-	return &cfg, nil
+	return cfg, nil
+}
+
+// fetchConfigOnce makes a single config request and reports whether a
+// failure is worth retrying.
+func fetchConfigOnce(ctx context.Context, url, token string) (*ExecutionConfig, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating config request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, fmt.Errorf("fetching config: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, resp.StatusCode >= 500, fmt.Errorf("config endpoint returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var cfg ExecutionConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return nil, false, fmt.Errorf("decoding config: %w", err)
+	}
+	return &cfg, false, nil
+}
+
+// workDirVarRe matches ${name} references in a working directory.
+var workDirVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_-]*)\}`)
+
+// ExpandWorkingDirectory substitutes ${name} references in the working
+// directory with the values of the named variables, so one config can serve
+// several environments (e.g. "modules/${env}/vpc"). Every referenced variable
+// must exist and hold a non-sensitive string, number, or bool.
+func ExpandWorkingDirectory(workingDirectory string, variables map[string]Variable) (string, error) {
+	var missing, invalid []string
+	expanded := workDirVarRe.ReplaceAllStringFunc(workingDirectory, func(ref string) string {
+		name := workDirVarRe.FindStringSubmatch(ref)[1]
+		v, ok := variables[name]
+		if !ok {
+			missing = append(missing, name)
+			return ref
+		}
+		switch v.Value.(type) {
+		case string, float64, int, bool:
+		default:
+			invalid = append(invalid, name)
+			return ref
+		}
+		if v.Sensitive {
+			invalid = append(invalid, name)
+			return ref
+		}
+		return fmt.Sprint(v.Value)
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("working directory %q references undefined variable(s): %s", workingDirectory, strings.Join(missing, ", "))
+	}
+	if len(invalid) > 0 {
+		return "", fmt.Errorf("working directory %q references sensitive or non-scalar variable(s): %s", workingDirectory, strings.Join(invalid, ", "))
+	}
+	return expanded, nil
+}
+
+// Fingerprint returns a stable hash identifying what the run will do: its
+// source, operation, terraform version, targets, and inputs. Butler uses it
+// to drop duplicate dispatches. Sensitive values and upstream outputs, which
+// may hold secrets, contribute only their names: a plain digest of a
+// low-entropy secret could be brute-forced.
+func (c *ExecutionConfig) Fingerprint() string {
+	h := sha256.New()
+	field := func(name, value string) {
+		fmt.Fprintf(h, "%s=%d:%s\n", name, len(value), value)
+	}
+	list := func(name string, values []string) {
+		for i, v := range values {
+			field(fmt.Sprintf("%s[%d]", name, i), v)
+		}
+	}
+	variables := func(prefix string, vars map[string]Variable) {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if vars[name].Sensitive {
+				field(prefix+name, "(sensitive)")
+				continue
+			}
+			// encoding/json sorts map keys, so equal values encode identically.
+			value, err := json.Marshal(vars[name].Value)
+			if err != nil {
+				value = []byte(fmt.Sprintf("%#v", vars[name].Value))
+			}
+			field(prefix+name, string(value))
+		}
+	}
+
+	field("source.type", c.Source.Type)
+	field("source.gitRepo", c.Source.GitRepo)
+	field("source.gitRef", c.Source.GitRef)
+	field("source.archiveUrl", c.Source.ArchiveURL)
+	field("source.localPath", c.Source.LocalPath)
+	field("source.workingDirectory", c.Source.WorkingDirectory)
+	field("operation", c.Operation)
+	field("workspace", c.Workspace)
+	field("terraformVersion", c.TerraformVersion)
+	field("terraformDistribution", c.TerraformDistribution)
+	field("planFile", c.PlanFile)
+	field("destroyPlan", fmt.Sprint(c.DestroyPlan))
+	field("approvedPlanDigest", c.ApprovedPlanDigest)
+	list("targets", c.Targets)
+	list("varFiles", c.VarFiles)
+	if c.StateBackend != nil {
+		field("stateBackend.type", c.StateBackend.Type)
+	}
+
+	variables("var.", c.Variables)
+	variables("env.", c.EnvVars)
+
+	outputs := make([]string, 0, len(c.UpstreamOutputs))
+	for name := range c.UpstreamOutputs {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+	list("upstreamOutputs", outputs)
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
 }
@@ -0,0 +1,181 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchConfigRetriesServerErrors(t *testing.T) {
+	fetchBaseDelay = time.Millisecond
+	defer func() { fetchBaseDelay = 500 * time.Millisecond }()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"runId": "run-1", "operation": "plan"}`))
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg, err := FetchConfig(context.Background(), logger, server.URL, "run-1", "token")
+	if err != nil {
+		t.Fatalf("FetchConfig failed: %v", err)
+	}
+	if cfg.RunID != "run-1" {
+		t.Errorf("expected run-1, got %q", cfg.RunID)
+	}
+	if cfg.FetchRetries != 2 {
+		t.Errorf("expected 2 retries, got %d", cfg.FetchRetries)
+	}
+}
+
+func TestFetchConfigDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := FetchConfig(context.Background(), logger, server.URL, "run-1", "token"); err == nil {
+		t.Fatal("expected error for 404 response")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls.Load())
+	}
+}
+
+func TestExpandWorkingDirectory(t *testing.T) {
+	vars := map[string]Variable{
+		"env":    {Value: "staging"},
+		"region": {Value: "us-east-1"},
+	}
+
+	got, err := ExpandWorkingDirectory("modules/${env}/${region}/vpc", vars)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "modules/staging/us-east-1/vpc" {
+		t.Errorf("unexpected working directory %q", got)
+	}
+
+	got, err = ExpandWorkingDirectory("modules/vpc", nil)
+	if err != nil || got != "modules/vpc" {
+		t.Errorf("expected plain path unchanged, got %q, %v", got, err)
+	}
+}
+
+func TestExpandWorkingDirectoryMissingVar(t *testing.T) {
+	_, err := ExpandWorkingDirectory("modules/${env}/${tier}", map[string]Variable{"env": {Value: "prod"}})
+	if err == nil || !strings.Contains(err.Error(), "tier") {
+		t.Errorf("expected undefined variable error naming tier, got %v", err)
+	}
+}
+
+func TestExpandWorkingDirectoryRejectsSensitive(t *testing.T) {
+	_, err := ExpandWorkingDirectory("modules/${secret}", map[string]Variable{"secret": {Value: "x", Sensitive: true}})
+	if err == nil {
+		t.Error("expected error for sensitive variable")
+	}
+}
+
+func TestFingerprintStable(t *testing.T) {
+	newConfig := func() *ExecutionConfig {
+		return &ExecutionConfig{
+			Operation: "apply",
+			Source:    SourceConfig{Type: "git", GitRepo: "https://example.com/infra.git", GitRef: "main"},
+			Variables: map[string]Variable{
+				"region":   {Value: "us-east-1"},
+				"tags":     {Value: map[string]interface{}{"team": "platform", "env": "prod"}},
+				"password": {Value: "hunter2", Sensitive: true},
+			},
+		}
+	}
+
+	a, b := newConfig(), newConfig()
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("identical configs produced different fingerprints: %s vs %s", a.Fingerprint(), b.Fingerprint())
+	}
+	if strings.Contains(a.Fingerprint(), "hunter2") {
+		t.Error("fingerprint exposes a sensitive value")
+	}
+
+	b.Variables["region"] = Variable{Value: "eu-west-1"}
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("changing a variable did not change the fingerprint")
+	}
+
+	// A digest of a low-entropy secret could be brute-forced, so sensitive
+	// values must not contribute to it.
+	b = newConfig()
+	b.Variables["password"] = Variable{Value: "hunter3", Sensitive: true}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("fingerprint depends on a sensitive value")
+	}
+
+	b.Targets = []string{"aws_instance.web"}
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("changing the targets did not change the fingerprint")
+	}
+
+	b = newConfig()
+	b.UpstreamOutputs = map[string]interface{}{"vpc_id": "vpc-123"}
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("adding upstream outputs did not change the fingerprint")
+	}
+
+	c := newConfig()
+	c.Operation = "destroy"
+	if a.Fingerprint() == c.Fingerprint() {
+		t.Error("changing the operation did not change the fingerprint")
+	}
+}
+
+func TestCheckConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "method not allowed", status: http.StatusMethodNotAllowed},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized, wantErr: "invalid token"},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: "invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := CheckConnection(context.Background(), server.URL, "run-1", "token")
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("expected reachable API to pass, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected %q error, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.Close()
+	if err := CheckConnection(context.Background(), server.URL, "run-1", "token"); err == nil {
+		t.Error("expected an unreachable API to fail")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logstream
+
+import (
+	"sync"
+
+	"github.com/butlerdotdev/butler-runner/internal/callback"
+)
+
+// PhaseTracker switches the phase on a set of writers and records the range
+// of sequence numbers each phase's lines received, so Butler can link a
+// phase to its logs.
+type PhaseTracker struct {
+	seq     *Sequencer
+	writers []*Writer
+	mu      sync.Mutex
+	phases  []callback.LogPhase
+}
+
+// NewPhaseTracker creates a tracker for writers sharing seq.
+func NewPhaseTracker(seq *Sequencer, writers ...*Writer) *PhaseTracker {
+	return &PhaseTracker{seq: seq, writers: writers}
+}
+
+// Start ends the current phase and begins a new one. Terraform output for
+// the previous phase must have been written before Start is called.
+func (t *PhaseTracker) Start(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.seq.Current()
+	if n := len(t.phases); n > 0 {
+		t.phases[n-1].LastSequence = current
+	}
+	t.phases = append(t.phases, callback.LogPhase{
+		Phase:         phase,
+		FirstSequence: current + 1,
+		LastSequence:  current,
+	})
+	for _, w := range t.writers {
+		w.SetPhase(phase)
+	}
+}
+
+// Phases returns the recorded phases in order, with the current phase
+// ending at the latest sequence number. A phase that produced no lines has
+// LastSequence < FirstSequence.
+func (t *PhaseTracker) Phases() []callback.LogPhase {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.phases); n > 0 {
+		t.phases[n-1].LastSequence = t.seq.Current()
+	}
+	return append([]callback.LogPhase(nil), t.phases...)
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logstream
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/callback"
+)
+
+func TestPhaseTrackerRanges(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	seq := NewSequencer(0)
+	stdout := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, seq)
+	stderr := NewWriter(context.Background(), cb, "stderr", logger, time.Hour, seq)
+	phases := NewPhaseTracker(seq, stdout, stderr)
+
+	phases.Start("init")
+	_, _ = stdout.Write([]byte("Initializing the backend...\nInitializing provider plugins...\n"))
+	_, _ = stderr.Write([]byte("Warning: deprecated\n"))
+	phases.Start("workspace")
+	phases.Start("plan")
+	_, _ = stdout.Write([]byte("Plan: 1 to add, 0 to change, 0 to destroy.\n"))
+
+	got := phases.Phases()
+	stdout.Close()
+	stderr.Close()
+
+	want := []callback.LogPhase{
+		{Phase: "init", FirstSequence: 1, LastSequence: 3},
+		{Phase: "workspace", FirstSequence: 4, LastSequence: 3},
+		{Phase: "plan", FirstSequence: 4, LastSequence: 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d phases, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("phase %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	// Every line must fall inside the range of the phase it was tagged with.
+	ranges := map[string]callback.LogPhase{}
+	for _, p := range got {
+		ranges[p.Phase] = p
+	}
+	for _, e := range sink.entries {
+		r := ranges[e.Phase]
+		if e.Sequence < r.FirstSequence || e.Sequence > r.LastSequence {
+			t.Errorf("line %d (%q) tagged %s falls outside %+v", e.Sequence, e.Content, e.Phase, r)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logstream
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultSecretEnvVars are well-known environment variables holding
+// credentials. A trailing "*" matches any name with that prefix.
+var DefaultSecretEnvVars = []string{
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"ARM_CLIENT_SECRET",
+	"ARM_ACCESS_KEY",
+	"ARM_SAS_TOKEN",
+	"GOOGLE_CREDENTIALS",
+	"GOOGLE_OAUTH_ACCESS_TOKEN",
+	"DIGITALOCEAN_TOKEN",
+	"CLOUDFLARE_API_TOKEN",
+	"GITHUB_TOKEN",
+	"GITLAB_TOKEN",
+	"VAULT_TOKEN",
+	"BUTLER_TOKEN",
+	"BUTLER_GIT_TOKEN",
+	"TF_TOKEN_*",
+}
+
+// redactedMask replaces secret values in log lines.
+const redactedMask = "***"
+
+// minSecretLen is the shortest value redacted; shorter values (e.g. "1" or
+// "true") would mangle unrelated output.
+const minSecretLen = 4
+
+// A single line of a multi-line secret is only redacted on its own if it
+// is at least minLineSecretLen bytes with at least minLineEntropy bits of
+// entropy per byte, like the base64 body of a private key. Structural
+// lines such as "-----END PRIVATE KEY-----", "}" or a JSON field holding a
+// URL would otherwise be masked throughout unrelated output.
+const (
+	minLineSecretLen = 16
+	minLineEntropy   = 4.5
+)
+
+// Redactor masks known secret values in log lines.
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string // longest first, so overlapping secrets mask fully
+}
+
+// NewRedactor creates an empty redactor.
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// Add registers secret values to mask. Values shorter than four bytes are
+// ignored. Log lines are redacted one at a time, so each line of a
+// multi-line value (such as GOOGLE_CREDENTIALS JSON) that looks random
+// enough to be secret is registered as a secret of its own; so is a
+// value's JSON-escaped form, as it appears in plan JSON.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		r.add(v)
+		if escaped, err := json.Marshal(v); err == nil {
+			r.add(string(escaped[1 : len(escaped)-1]))
+		}
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				if line = strings.TrimSpace(line); len(line) >= minLineSecretLen && entropy(line) >= minLineEntropy {
+					r.add(line)
+				}
+			}
+		}
+	}
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// add registers a single secret; r.mu is held.
+func (r *Redactor) add(secret string) {
+	if len(secret) >= minSecretLen && !slices.Contains(r.secrets, secret) {
+		r.secrets = append(r.secrets, secret)
+	}
+}
+
+// entropy returns the Shannon entropy of s in bits per byte.
+func entropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// AddEnv registers the values of the named environment variables. A name
+// ending in "*" matches every variable with that prefix.
+func (r *Redactor) AddEnv(names []string) {
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		for _, name := range names {
+			if prefix, ok := strings.CutSuffix(name, "*"); (ok && strings.HasPrefix(key, prefix)) || key == name {
+				r.Add(value)
+				break
+			}
+		}
+	}
+}
+
+// Redact returns text with every registered secret replaced by "***".
+func (r *Redactor) Redact(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, s := range r.secrets {
+		text = strings.ReplaceAll(text, s, redactedMask)
+	}
+	return text
+}
@@ -0,0 +1,30 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logstream
+
+import "sync/atomic"
+
+// Sequencer hands out globally unique, increasing sequence numbers. Writers
+// for different streams share one Sequencer so their entries can be merged
+// back into a single ordered log.
+type Sequencer struct {
+	n atomic.Int64
+}
+
+// NewSequencer creates a sequencer whose first Next call returns start+1.
+func NewSequencer(start int) *Sequencer {
+	s := &Sequencer{}
+	s.n.Store(int64(start))
+	return s
+}
+
+// Next returns the next sequence number.
+func (s *Sequencer) Next() int {
+	return int(s.n.Add(1))
+}
+
+// Current returns the most recently issued sequence number.
+func (s *Sequencer) Current() int {
+	return int(s.n.Load())
+}
@@ -4,13 +4,13 @@
 package logstream
 
 import (
-	"bufio"
+	"bytes"
 	"context"
-	"io"
 	"log/slog"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/butlerdotdev/butler-runner/internal/callback"
 )
@@ -24,68 +24,153 @@ type Writer struct {
 	logger    *slog.Logger
 	mu        sync.Mutex
 	buf       []callback.LogEntry
-	seq       int
+	partial   []byte // trailing bytes not yet terminated by a newline
+	phase     string
+	seq       *Sequencer
+	redactor  *Redactor // optional: masks secrets before buffering
 	flushTick *time.Ticker
 	done      chan struct{}
-	pr        *io.PipeReader
-	pw        *io.PipeWriter
+	closeOnce sync.Once
+
+	failed     []failedBatch // batches to resend on the next flush
+	maxRetries int           // resends of a failed batch before dropping it
+	dropped    int           // lines dropped after maxRetries
+}
+
+// failedBatch is a chunk of log entries whose send failed.
+type failedBatch struct {
+	entries  []callback.LogEntry
+	attempts int
 }
 
+// maxLineBytes is the longest line sent; longer lines are truncated.
+const maxLineBytes = 4096
+
+// DefaultMaxFlushRetries is how many times a failed batch is resent before
+// it is dropped.
+const DefaultMaxFlushRetries = 5
+
+// closeRetryDelay is the pause between the final flushes in Close, giving a
+// failing sink time to recover. It is a variable so tests can shorten it.
+var closeRetryDelay = time.Second
+
 // NewWriter creates a log writer that streams to the callback API.
-// It starts a background goroutine that reads lines and flushes every interval.
-func NewWriter(ctx context.Context, cb *callback.Client, stream string, logger *slog.Logger, flushInterval time.Duration, startSeq int) *Writer {
-	pr, pw := io.Pipe()
+// Sequence numbers are drawn from seq, which may be shared with writers for
+// other streams. It starts a background goroutine that flushes every interval.
+func NewWriter(ctx context.Context, cb *callback.Client, stream string, logger *slog.Logger, flushInterval time.Duration, seq *Sequencer) *Writer {
 	w := &Writer{
 		ctx:       ctx,
 		cb:        cb,
 		stream:    stream,
 		logger:    logger,
-		seq:       startSeq,
+		seq:       seq,
 		flushTick: time.NewTicker(flushInterval),
 		done:      make(chan struct{}),
-		pr:        pr,
-		pw:        pw,
+
+		maxRetries: DefaultMaxFlushRetries,
 	}
-	go w.readLines()
 	go w.flushLoop()
 	return w
 }
 
-// Write implements io.Writer.
+// Write implements io.Writer. Complete lines are buffered immediately and
+// stamped with the phase that is current at the time of the write.
 func (w *Writer) Write(p []byte) (int, error) {
-	return w.pw.Write(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.appendLine(bytes.TrimSuffix(w.partial[:i], []byte("\r")))
+		w.partial = w.partial[i+1:]
+	}
+	// Output without newlines (e.g. a progress bar) must not grow the
+	// buffer without bound. Keep one byte past the limit so flush still
+	// marks the line as truncated.
+	if len(w.partial) > maxLineBytes+1 {
+		w.partial = w.partial[:maxLineBytes+1]
+	}
+	return len(p), nil
 }
 
-// Sequence returns the current sequence number (for chaining stdout → stderr).
-func (w *Writer) Sequence() int {
+// SetRedactor masks the redactor's secrets in subsequently written lines.
+func (w *Writer) SetRedactor(r *Redactor) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.seq
+	w.redactor = r
 }
 
-// Close flushes remaining logs and stops the background goroutines.
+// SetMaxRetries sets how many times a batch that failed to send is resent
+// on later flushes before it is dropped. Zero drops failed batches at once.
+func (w *Writer) SetMaxRetries(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.maxRetries = n
+}
+
+// Dropped returns the number of log lines dropped after their batch
+// exhausted its retries.
+func (w *Writer) Dropped() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// SetPhase sets the phase (e.g. "init", "plan", "apply") recorded on
+// subsequently written lines.
+func (w *Writer) SetPhase(phase string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.phase = phase
+}
+
+// Sequence returns the most recently issued sequence number.
+func (w *Writer) Sequence() int {
+	return w.seq.Current()
+}
+
+// Close flushes remaining logs and stops the background goroutine.
 func (w *Writer) Close() {
-	_ = w.pw.Close()
-	<-w.done // wait for readLines to finish
-	w.flushTick.Stop()
-	w.flush() // final flush
-}
-
-func (w *Writer) readLines() {
-	defer close(w.done)
-	scanner := bufio.NewScanner(w.pr)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-	for scanner.Scan() {
-		line := scanner.Text()
+	w.closeOnce.Do(func() {
 		w.mu.Lock()
-		w.seq++
-		w.buf = append(w.buf, callback.LogEntry{
-			Sequence: w.seq,
-			Stream:   w.stream,
-			Content:  line,
-		})
+		if len(w.partial) > 0 {
+			w.appendLine(w.partial)
+			w.partial = nil
+		}
 		w.mu.Unlock()
+
+		close(w.done)
+		w.flushTick.Stop()
+		// Final flush. Every pass resends or drops each failed batch, so
+		// this terminates even if the sink never recovers.
+		for w.flush() {
+			select {
+			case <-w.ctx.Done():
+				w.dropFailed(w.ctx.Err())
+				return
+			case <-time.After(closeRetryDelay):
+			}
+		}
+	})
+}
+
+// appendLine buffers a single log line. Callers must hold w.mu.
+func (w *Writer) appendLine(line []byte) {
+	content := sanitize(line)
+	if w.redactor != nil {
+		content = w.redactor.Redact(content)
 	}
+	w.buf = append(w.buf, callback.LogEntry{
+		Sequence:  w.seq.Next(),
+		Stream:    w.stream,
+		Content:   content,
+		Timestamp: time.Now().UTC(),
+		Phase:     w.phase,
+	})
 }
 
 func (w *Writer) flushLoop() {
@@ -99,20 +184,27 @@ func (w *Writer) flushLoop() {
 	}
 }
 
-func (w *Writer) flush() {
+// flush resends failed batches, then sends buffered lines. Batches that
+// fail are kept for the next flush until they exceed the retry limit. It
+// reports whether any failed batches remain.
+func (w *Writer) flush() bool {
 	w.mu.Lock()
-	if len(w.buf) == 0 {
-		w.mu.Unlock()
-		return
-	}
+	retries := w.failed
 	batch := w.buf
-	w.buf = nil
+	w.failed, w.buf = nil, nil
 	w.mu.Unlock()
 
+	// Resend earlier failures first so lines arrive roughly in order
+	for _, f := range retries {
+		if err := w.cb.SendLogs(w.ctx, f.entries); err != nil {
+			w.requeue(f, err)
+		}
+	}
+
 	// Truncate very long lines to avoid huge payloads
 	for i := range batch {
-		if len(batch[i].Content) > 4096 {
-			batch[i].Content = batch[i].Content[:4096] + "... (truncated)"
+		if len(batch[i].Content) > maxLineBytes {
+			batch[i].Content = truncate(batch[i].Content, maxLineBytes) + "... (truncated)"
 		}
 	}
 
@@ -123,15 +215,11 @@ func (w *Writer) flush() {
 			end = len(batch)
 		}
 		if err := w.cb.SendLogs(w.ctx, batch[i:end]); err != nil {
-			w.logger.Warn("failed to send logs",
-				"stream", w.stream,
-				"count", end-i,
-				"error", err,
-			)
+			w.requeue(failedBatch{entries: batch[i:end]}, err)
 		}
 	}
 
-	if w.logger.Enabled(w.ctx, slog.LevelDebug) {
+	if len(batch) > 0 && w.logger.Enabled(w.ctx, slog.LevelDebug) {
 		lines := make([]string, len(batch))
 		for i, e := range batch {
 			lines[i] = e.Content
@@ -142,4 +230,67 @@ func (w *Writer) flush() {
 			"preview", strings.Join(lines[:min(len(lines), 3)], " | "),
 		)
 	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.failed) > 0
+}
+
+// requeue keeps a batch that failed to send for the next flush, or drops it
+// once it has been retried maxRetries times.
+func (w *Writer) requeue(f failedBatch, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if f.attempts >= w.maxRetries {
+		w.dropped += len(f.entries)
+		w.logger.Warn("dropping logs after repeated send failures",
+			"stream", w.stream,
+			"count", len(f.entries),
+			"attempts", f.attempts+1,
+			"error", err,
+		)
+		return
+	}
+	f.attempts++
+	w.logger.Warn("failed to send logs, will retry",
+		"stream", w.stream,
+		"count", len(f.entries),
+		"error", err,
+	)
+	w.failed = append(w.failed, f)
+}
+
+// dropFailed drops every batch awaiting a resend.
+func (w *Writer) dropFailed(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, f := range w.failed {
+		w.dropped += len(f.entries)
+		w.logger.Warn("dropping logs after repeated send failures",
+			"stream", w.stream,
+			"count", len(f.entries),
+			"attempts", f.attempts,
+			"error", err,
+		)
+	}
+	w.failed = nil
+}
+
+// sanitize converts a raw output line to valid UTF-8 so callbacks never
+// carry broken text: byte order marks are dropped and invalid sequences are
+// replaced with U+FFFD.
+func sanitize(line []byte) string {
+	s := strings.ToValidUTF8(string(line), "\uFFFD")
+	return strings.ReplaceAll(s, "\uFEFF", "")
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
 }
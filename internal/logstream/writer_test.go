@@ -0,0 +1,320 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logstream
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/butlerdotdev/butler-runner/internal/callback"
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// logSink is a fake Butler logs endpoint that records every entry it receives.
+type logSink struct {
+	mu      sync.Mutex
+	entries []callback.LogEntry
+}
+
+func (s *logSink) handler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Logs []callback.LogEntry `json:"logs"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	s.mu.Lock()
+	s.entries = append(s.entries, body.Logs...)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func newTestClient(t *testing.T, sink *logSink) *callback.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(sink.handler))
+	t.Cleanup(server.Close)
+	return callback.NewClient(server.URL, "test-token", config.CallbackURLs{
+		LogsURL: "/v1/ci/module-runs/run-1/logs",
+	})
+}
+
+func TestWriterTagsPhase(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	w.SetPhase("init")
+	_, _ = w.Write([]byte("Initializing the backend...\nInitializing provider plugins...\n"))
+	w.SetPhase("plan")
+	_, _ = w.Write([]byte("Plan: 1 to add, 0 to change, 0 to destroy.\n"))
+	w.Close()
+
+	want := []string{"init", "init", "plan"}
+	if len(sink.entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(sink.entries))
+	}
+	for i, e := range sink.entries {
+		if e.Phase != want[i] {
+			t.Errorf("entry %d (%q): expected phase %q, got %q", i, e.Content, want[i], e.Phase)
+		}
+		if e.Timestamp.IsZero() {
+			t.Errorf("entry %d: expected timestamp to be set", i)
+		}
+	}
+}
+
+func TestWriterFlushesPartialLineOnClose(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	_, _ = w.Write([]byte("first\r\nno trailing newline"))
+	w.Close()
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(sink.entries))
+	}
+	if sink.entries[0].Content != "first" {
+		t.Errorf("expected carriage return to be trimmed, got %q", sink.entries[0].Content)
+	}
+	if sink.entries[1].Content != "no trailing newline" {
+		t.Errorf("expected partial line to be flushed, got %q", sink.entries[1].Content)
+	}
+}
+
+func TestWriterCapsUnterminatedLine(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	chunk := []byte(strings.Repeat("=", 1000))
+	for i := 0; i < 100; i++ {
+		_, _ = w.Write(chunk)
+	}
+	if len(w.partial) > maxLineBytes+1 {
+		t.Errorf("expected partial line capped at %d bytes, got %d", maxLineBytes+1, len(w.partial))
+	}
+	_, _ = w.Write([]byte(" done\nnext\n"))
+	w.Close()
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(sink.entries))
+	}
+	if !strings.HasSuffix(sink.entries[0].Content, "... (truncated)") {
+		t.Errorf("expected long line to be marked truncated, got %d bytes", len(sink.entries[0].Content))
+	}
+	if sink.entries[1].Content != "next" {
+		t.Errorf("expected following line intact, got %q", sink.entries[1].Content)
+	}
+}
+
+func TestWritersShareSequence(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	seq := NewSequencer(0)
+	stdout := NewWriter(context.Background(), cb, "stdout", logger, 10*time.Millisecond, seq)
+	stderr := NewWriter(context.Background(), cb, "stderr", logger, 10*time.Millisecond, seq)
+
+	const lines = 200
+	var wg sync.WaitGroup
+	for _, w := range []*Writer{stdout, stderr} {
+		wg.Add(1)
+		go func(w *Writer) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				_, _ = w.Write([]byte("line\n"))
+			}
+		}(w)
+	}
+	wg.Wait()
+	stdout.Close()
+	stderr.Close()
+
+	if len(sink.entries) != 2*lines {
+		t.Fatalf("expected %d entries, got %d", 2*lines, len(sink.entries))
+	}
+	seen := make(map[int]string)
+	for _, e := range sink.entries {
+		if prev, ok := seen[e.Sequence]; ok {
+			t.Fatalf("sequence %d emitted on both %s and %s", e.Sequence, prev, e.Stream)
+		}
+		seen[e.Sequence] = e.Stream
+	}
+	for i := 1; i <= 2*lines; i++ {
+		if _, ok := seen[i]; !ok {
+			t.Errorf("sequence %d missing", i)
+		}
+	}
+}
+
+func TestWriterSanitizesEncoding(t *testing.T) {
+	sink := &logSink{}
+	cb := newTestClient(t, sink)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	_, _ = w.Write([]byte("\xef\xbb\xbfInitializing...\n"))
+	_, _ = w.Write([]byte("bad \xff\xfe bytes\n"))
+	_, _ = w.Write([]byte(strings.Repeat("a", 4095) + "é\n"))
+
+	w.mu.Lock()
+	buffered := append([]callback.LogEntry(nil), w.buf...)
+	w.mu.Unlock()
+
+	if len(buffered) != 3 {
+		t.Fatalf("expected 3 buffered lines, got %d", len(buffered))
+	}
+	for _, e := range buffered {
+		if !utf8.ValidString(e.Content) {
+			t.Errorf("buffered invalid UTF-8: %q", e.Content)
+		}
+	}
+	if buffered[0].Content != "Initializing..." {
+		t.Errorf("expected BOM to be stripped, got %q", buffered[0].Content)
+	}
+	if buffered[1].Content != "bad \uFFFD bytes" {
+		t.Errorf("expected invalid bytes replaced, got %q", buffered[1].Content)
+	}
+
+	// Truncation must not split the multi-byte rune straddling the limit.
+	w.Close()
+	if last := sink.entries[len(sink.entries)-1].Content; strings.ContainsRune(last, utf8.RuneError) {
+		t.Errorf("truncation split a multi-byte rune: %q", last[len(last)-30:])
+	}
+}
+
+func TestWriterRetriesFailedBatch(t *testing.T) {
+	sink := &logSink{}
+	var mu sync.Mutex
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sink.handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	cb := callback.NewClient(server.URL, "test-token", config.CallbackURLs{
+		LogsURL: "/v1/ci/module-runs/run-1/logs",
+	})
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	_, _ = w.Write([]byte("first\nsecond\n"))
+	w.Close()
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("expected the failed batch to be resent, got %d entries", len(sink.entries))
+	}
+	if w.Dropped() != 0 {
+		t.Errorf("expected nothing dropped, got %d", w.Dropped())
+	}
+}
+
+func TestWriterDropsBatchAfterMaxRetries(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+	cb := callback.NewClient(server.URL, "test-token", config.CallbackURLs{
+		LogsURL: "/v1/ci/module-runs/run-1/logs",
+	})
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	closeRetryDelay = time.Millisecond
+	t.Cleanup(func() { closeRetryDelay = time.Second })
+
+	w := NewWriter(context.Background(), cb, "stdout", logger, time.Hour, NewSequencer(0))
+	w.SetMaxRetries(3)
+	_, _ = w.Write([]byte("one\ntwo\nthree\n"))
+
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return with a permanently failing sink")
+	}
+
+	if w.Dropped() != 3 {
+		t.Errorf("expected 3 lines dropped, got %d", w.Dropped())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 4 {
+		t.Errorf("expected 1 send and 3 retries, got %d requests", requests)
+	}
+}
+
+func TestWriterCloseBacksOffAndStopsWhenCancelled(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+	cb := callback.NewClient(server.URL, "test-token", config.CallbackURLs{
+		LogsURL: "/v1/ci/module-runs/run-1/logs",
+	})
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	closeRetryDelay = 50 * time.Millisecond
+	t.Cleanup(func() { closeRetryDelay = time.Second })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	w := NewWriter(ctx, cb, "stdout", logger, time.Hour, NewSequencer(0))
+	w.SetMaxRetries(1000)
+	_, _ = w.Write([]byte("one\ntwo\n"))
+
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close kept retrying after the context was done")
+	}
+
+	if w.Dropped() != 2 {
+		t.Errorf("expected 2 lines dropped, got %d", w.Dropped())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(sent); i++ {
+		if gap := sent[i].Sub(sent[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("resent after %s, expected a pause between passes", gap)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package runner
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// eventWriter emits local-mode run events as newline-delimited JSON, one
+// object per event with "time" and "event" fields plus event-specific
+// fields. A nil eventWriter discards events.
+type eventWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newEventWriter returns an eventWriter for w, or nil if w is nil.
+func newEventWriter(w io.Writer) *eventWriter {
+	if w == nil {
+		return nil
+	}
+	return &eventWriter{w: w}
+}
+
+// emit writes one event. Write errors are ignored: events are a side
+// channel and must not fail the run.
+func (e *eventWriter) emit(event string, fields map[string]interface{}) {
+	if e == nil {
+		return
+	}
+	obj := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"event": event,
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(append(data, '\n'))
+}
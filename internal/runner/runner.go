@@ -5,12 +5,17 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/butlerdotdev/butler-runner/internal/backup"
 	"github.com/butlerdotdev/butler-runner/internal/callback"
 	"github.com/butlerdotdev/butler-runner/internal/cancel"
 	"github.com/butlerdotdev/butler-runner/internal/config"
@@ -20,19 +25,85 @@ import (
 )
 
 type ManagedConfig struct {
-	ButlerURL string
-	RunID     string
-	Token     string
+	ButlerURL     string
+	RunID         string
+	Token         string
+	SigningSecret string // optional: HMAC-sign callback payloads
+	Attempt       int    // overrides the attempt number from the execution config
+
+	// CheckConnection verifies the API is reachable and the token valid
+	// before fetching config.
+	CheckConnection bool
+
+	// ExitWithParent cancels the run if the process that started the
+	// runner exits, and interrupts terraform if the runner itself dies.
+	ExitWithParent bool
+
+	// EventsNATSURL, if set, publishes status, log, plan, and output events
+	// to this NATS server instead of posting them to the callback URLs,
+	// on subjects EventsSubject.<run ID>.<event>. EventsNATS holds the
+	// credentials and CAs for the connection.
+	EventsNATSURL string
+	EventsNATS    callback.NATSOptions
+	EventsSubject string
 }
 
 type LocalConfig struct {
-	WorkingDir string
-	Operation  string
-	TfVersion  string
+	WorkingDir         string
+	Operation          string
+	TfVersion          string
+	TfDistribution     string
+	IdleTimeout        time.Duration
+	ExitWithParent     bool // cancel if the parent exits; interrupt terraform if the runner dies
+	PlanFile           string
+	DestroyPlan        bool   // plan saves a destroy plan for a later destroy run
+	AllowOutputErrors  bool   // apply that only failed on outputs is not an error
+	ApprovedPlanDigest string // apply refuses a saved plan with another digest
+	LockPlatforms      []string
+	StrictWarnings     bool
+	SuppressWarnings   []string
+	Targets            []string
+	Isolate            bool
+	IsolationRoot      string
+	Workspace          string
+	GracePeriod        time.Duration // SIGINT to SIGKILL on cancel; 0 = default
+	Timeout            time.Duration // per terraform invocation; 0 = none
+	LockTimeout        time.Duration // wait for a held state lock; 0 = fail fast
+	ProtectedTypes     []string      // resource types that must not be destroyed
+	AllowedDestroys    []string      // addresses exempt from ProtectedTypes
+	LargePlanThreshold int           // total changes that flag a plan; 0 = no limit
+	BlockLargePlans    bool          // fail plans over LargePlanThreshold
+	DetectSchemaNoise  bool          // flag plans that look like provider upgrade noise
+	VarFiles           []string      // extra -var-file paths
+	PluginCacheDir     string
+	RegistryTimeout    time.Duration
+	RegistryRetries    int
+	PluginCacheMinFree int64         // bytes; prune the plugin cache below this
+	SkipBackend        bool          // init with -backend=false; implied by validate
+	InitStallTimeout   time.Duration // fail a download stalled this long; 0 = off
+	DataDir            string        // parent of persistent per-module TF_DATA_DIRs; empty = .terraform
+	DataDirClean       []string      // data dir parts removed before init
+	JUnitReport        string        // optional JUnit XML path for test/validate
+
+	// UpgradeOnLockMismatch retries init once with -upgrade when the lock
+	// file has no checksums for this platform.
+	UpgradeOnLockMismatch bool
+
+	// Events, if set, receives NDJSON events for phase transitions and the
+	// run's outcome, and terraform's own output moves to stderr.
+	Events io.Writer
 }
 
 // RunManaged executes a Butler-managed run.
 func RunManaged(ctx context.Context, logger *slog.Logger, cfg ManagedConfig) error {
+	// 0. Fail fast if Butler is unreachable or the token is rejected
+	if cfg.CheckConnection {
+		if err := config.CheckConnection(ctx, cfg.ButlerURL, cfg.RunID, cfg.Token); err != nil {
+			return fmt.Errorf("checking Butler connection: %w", err)
+		}
+		logger.Info("Butler API connection verified")
+	}
+
 	// 1. Fetch execution config
 	execCfg, err := config.FetchConfig(ctx, logger, cfg.ButlerURL, cfg.RunID, cfg.Token)
 	if err != nil {
@@ -41,26 +112,74 @@ func RunManaged(ctx context.Context, logger *slog.Logger, cfg ManagedConfig) err
 
 	// 2. Create callback client
 	cb := callback.NewClient(cfg.ButlerURL, cfg.Token, execCfg.Callbacks)
+	cb.SetSigningSecret(cfg.SigningSecret)
+	if cfg.EventsNATSURL != "" {
+		pub, err := callback.DialNATS(cfg.EventsNATSURL, cfg.EventsNATS)
+		if err != nil {
+			return fmt.Errorf("connecting event publisher: %w", err)
+		}
+		defer func() { _ = pub.Close() }()
+		cb.SetPublisher(pub, cfg.EventsSubject+"."+cfg.RunID)
+	}
+
+	attempt := cfg.Attempt
+	if attempt == 0 {
+		attempt = execCfg.Attempt
+	}
+	logger = withAttempt(logger, cb, attempt)
+	fingerprint := execCfg.Fingerprint()
+	cb.SetFingerprint(fingerprint)
+	logger.Info("run fingerprint computed", "fingerprint", fingerprint)
 
 	// Report running status
 	if err := cb.ReportStatus(ctx, "running", nil); err != nil {
 		logger.Warn("failed to report running status", "error", err)
 	}
 
+	// A saved plan is shared with a later run, so it cannot live in this
+	// run's temporary source directory.
+	if execCfg.PlanFile != "" && !filepath.IsAbs(execCfg.PlanFile) {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+		return fmt.Errorf("plan file %q must be an absolute path in managed mode", execCfg.PlanFile)
+	}
+
 	// 3. Resolve terraform version
-	tfPath, err := terraform.ResolveVersion(ctx, logger, execCfg.TerraformVersion)
+	binary, err := terraform.ResolveVersion(ctx, logger, execCfg.TerraformVersion, execCfg.TerraformDistribution)
 	if err != nil {
 		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
 		return fmt.Errorf("resolving terraform version: %w", err)
 	}
 
 	// 4. Clone/download source
-	workDir, err := source.Prepare(ctx, logger, execCfg.Source)
+	execCfg.Source.WorkingDirectory, err = config.ExpandWorkingDirectory(execCfg.Source.WorkingDirectory, execCfg.Variables)
 	if err != nil {
 		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+		return fmt.Errorf("expanding working directory: %w", err)
+	}
+	src, err := source.Prepare(ctx, logger, execCfg.Source)
+	if err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{
+			ExitCode:      1,
+			FailureReason: "source_" + string(source.ErrorKindOf(err)),
+		})
 		return fmt.Errorf("preparing source: %w", err)
 	}
-	defer func() { _ = os.RemoveAll(filepath.Dir(workDir)) }()
+	workDir := src.WorkDir
+	defer src.Cleanup()
+
+	// Hash the source before the runner adds its own (secret-bearing) files.
+	var manifest []callback.ManifestEntry
+	if execCfg.ReportManifest {
+		entries, err := source.Manifest(workDir)
+		if err != nil {
+			logger.Warn("failed to build working directory manifest", "error", err)
+		} else {
+			for _, e := range entries {
+				manifest = append(manifest, callback.ManifestEntry{Path: e.Path, SHA256: e.SHA256})
+			}
+			logger.Info("working directory manifest built", "files", len(manifest))
+		}
+	}
 
 	// 5. Set cloud integration / variable set env vars
 	var envVarKeys []string
@@ -86,25 +205,29 @@ func RunManaged(ctx context.Context, logger *slog.Logger, cfg ManagedConfig) err
 	}()
 
 	// 6. Write terraform.tfvars.json
+	if err := terraform.ValidateSecureDeletePattern(execCfg.SecureDeletePattern); err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("configuring secure delete: %w", err)
+	}
 	tfvarsPath, err := terraform.WriteTfvars(workDir, execCfg.Variables, execCfg.UpstreamOutputs)
 	if err != nil {
-		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
 		return fmt.Errorf("writing tfvars: %w", err)
 	}
-	defer terraform.SecureDelete(tfvarsPath)
+	defer removeTfvars(tfvarsPath, execCfg)
 
 	// 6b. Write backend override if configured
 	if execCfg.StateBackend != nil {
 		logger.Info("state backend configured", "type", execCfg.StateBackend.Type)
 		if err := terraform.WriteBackendOverride(workDir, execCfg.StateBackend); err != nil {
-			_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+			_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
 			return fmt.Errorf("writing backend config: %w", err)
 		}
 	}
 
 	// 6c. Write provider overrides if needed (e.g. azurerm requires features {})
 	if err := terraform.WriteProviderOverrides(workDir, envVarKeys); err != nil {
-		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
 		return fmt.Errorf("writing provider overrides: %w", err)
 	}
 
@@ -113,61 +236,309 @@ func RunManaged(ctx context.Context, logger *slog.Logger, cfg ManagedConfig) err
 	defer cancelFunc()
 	watcher := cancel.NewWatcher(cfg.ButlerURL, cfg.RunID, cfg.Token, logger)
 	go watcher.Start(cancelCtx, cancelFunc)
+	if cfg.ExitWithParent {
+		go cancel.NewParentWatcher(logger).Start(cancelCtx, cancelFunc)
+	}
 
 	// 8. Set up log streaming
-	stdoutLog := logstream.NewWriter(ctx, cb, "stdout", logger, 2*time.Second, 0)
-	stderrLog := logstream.NewWriter(ctx, cb, "stderr", logger, 2*time.Second, stdoutLog.Sequence())
+	seq := logstream.NewSequencer(0)
+	stdoutLog := logstream.NewWriter(ctx, cb, "stdout", logger, 2*time.Second, seq)
+	stderrLog := logstream.NewWriter(ctx, cb, "stderr", logger, 2*time.Second, seq)
 	defer stderrLog.Close()
 	defer stdoutLog.Close()
+	redactor := logRedactor(execCfg)
+	stdoutLog.SetRedactor(redactor)
+	stderrLog.SetRedactor(redactor)
+	cb.SetRedactor(redactor)
+	if execCfg.LogFlushRetries != nil {
+		stdoutLog.SetMaxRetries(*execCfg.LogFlushRetries)
+		stderrLog.SetMaxRetries(*execCfg.LogFlushRetries)
+	}
+
+	// 8b. Cancel the run if it stops producing output
+	var stdoutW, stderrW io.Writer = stdoutLog, stderrLog
+	if execCfg.IdleTimeoutSeconds > 0 {
+		idle := cancel.NewIdleWatcher(time.Duration(execCfg.IdleTimeoutSeconds)*time.Second, logger)
+		go idle.Start(cancelCtx, cancelFunc)
+		stdoutW = io.MultiWriter(stdoutLog, idle)
+		stderrW = io.MultiWriter(stderrLog, idle)
+	}
+
+	// 8c. Tell Butler when terraform is queued behind another run's state
+	// lock, so the run does not look stuck
+	var lockWatcher *terraform.LockWaitWatcher
+	if execCfg.LockTimeoutSeconds > 0 {
+		lockWatcher = terraform.NewLockWaitWatcher(func(waiting bool) {
+			status := "running"
+			if waiting {
+				status = "waiting_for_lock"
+			}
+			logger.Info("state lock status changed", "status", status)
+			if err := cb.ReportStatus(ctx, status, nil); err != nil {
+				logger.Warn("failed to report lock wait status", "status", status, "error", err)
+			}
+		})
+		defer lockWatcher.Stop()
+		// terraform writes its -json events to stdout
+		stdoutW = io.MultiWriter(stdoutW, lockWatcher)
+	}
 
 	// 9. Run terraform
-	exec := terraform.NewExecutor(tfPath, workDir, logger)
-	exec.SetLogWriters(stdoutLog, stderrLog)
+	exec := terraform.NewExecutor(binary.Path, workDir, logger)
+	skipBackend := execCfg.SkipBackend || !terraform.NeedsBackend(execCfg.Operation)
+	exec.SetLogWriters(stdoutW, stderrW)
+	exec.SetExitWithParent(cfg.ExitWithParent)
+	exec.SetPlanFile(execCfg.PlanFile)
+	exec.SetDestroyPlan(execCfg.DestroyPlan)
+	exec.SetApprovedPlanDigest(execCfg.ApprovedPlanDigest)
+	exec.SetLockPlatforms(execCfg.LockPlatforms)
+	exec.SetGracePeriod(time.Duration(execCfg.GracePeriodSeconds) * time.Second)
+	exec.SetTimeout(time.Duration(execCfg.TimeoutSeconds) * time.Second)
+	exec.SetLockTimeout(time.Duration(execCfg.LockTimeoutSeconds) * time.Second)
+	exec.SetDestroyProtection(execCfg.ProtectedResourceTypes, execCfg.AllowedDestroys)
+	exec.SetLargePlanLimit(execCfg.LargePlanThreshold, execCfg.BlockLargePlans)
+	exec.SetStrictWarnings(execCfg.StrictWarnings, execCfg.SuppressWarnings)
+	exec.SetDetectSchemaNoise(execCfg.DetectSchemaNoise)
+	if execCfg.StateBackend != nil {
+		exec.SetBackendType(execCfg.StateBackend.Type)
+	}
+	exec.SetInitOptions(terraform.InitOptions{
+		PluginCacheDir:     execCfg.PluginCacheDir,
+		RegistryTimeout:    time.Duration(execCfg.RegistryTimeoutSeconds) * time.Second,
+		DiscoveryRetries:   execCfg.RegistryDiscoveryRetries,
+		PluginCacheMinFree: int64(execCfg.PluginCacheMinFreeMB) << 20,
+		SkipBackend:        skipBackend,
+		StallTimeout:       time.Duration(execCfg.InitStallTimeoutSeconds) * time.Second,
+
+		UpgradeOnLockMismatch: execCfg.UpgradeOnLockMismatch,
+	})
+	if err := exec.SetTargets(execCfg.Targets); err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("configuring targets: %w", err)
+	}
+	if err := exec.SetDataDir(execCfg.DataDir, dataDirKey(execCfg.Source), execCfg.DataDirClean); err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("configuring data dir: %w", err)
+	}
+	exec.SetTfvarsFile(tfvarsPath)
+	if err := exec.SetVarFiles(execCfg.VarFiles); err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("configuring var files: %w", err)
+	}
+	if err := exec.SetIsolation(execCfg.Isolate, execCfg.IsolationRoot); err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("configuring isolation: %w", err)
+	}
+
+	unlock, err := exec.Lock(cancelCtx)
+	if err != nil {
+		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1, Manifest: manifest})
+		return fmt.Errorf("locking shared directories: %w", err)
+	}
+	defer unlock()
+
+	phases := logstream.NewPhaseTracker(seq, stdoutLog, stderrLog)
 
 	// Init
 	logger.Info("running terraform init")
+	phases.Start("init")
 	if err := exec.Init(cancelCtx); err != nil {
-		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{ExitCode: 1})
+		details := &callback.StatusDetails{
+			ExitCode:      1,
+			FailureReason: failureReason(err),
+			Manifest:      manifest,
+			Commands:      exec.Commands(),
+			LogPhases:     phases.Phases(),
+			InitUpgraded:  exec.InitUpgraded(),
+		}
+		var authErr *terraform.BackendAuthError
+		if errors.As(err, &authErr) {
+			details.Backend = authErr.Backend
+		}
+		_ = cb.ReportStatus(ctx, "failed", details)
 		return fmt.Errorf("terraform init: %w", err)
 	}
+	// An init-only run just warms the provider cache; selecting (and
+	// possibly creating) a workspace would touch the backend needlessly.
+	if execCfg.Workspace != "" && execCfg.Operation != "init" && !skipBackend {
+		if err := exec.SelectWorkspace(cancelCtx, execCfg.Workspace); err != nil {
+			_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{
+				ExitCode:      1,
+				FailureReason: failureReason(err),
+				Manifest:      manifest,
+				Commands:      exec.Commands(),
+				LogPhases:     phases.Phases(),
+			})
+			return fmt.Errorf("selecting workspace: %w", err)
+		}
+	}
+	logger.Info("terraform workspace active", "workspace", exec.Workspace())
+	countBefore := stateResourceCount(cancelCtx, logger, exec, execCfg.Operation)
+
+	// Flag warnings about features removed in the upgrade target
+	var upgradeBlockers []callback.Diagnostic
+	if execCfg.CheckUpgradeBlockers {
+		blockers, err := exec.CheckUpgradeBlockers(cancelCtx, execCfg.UpgradeTargetVersion)
+		if err != nil {
+			logger.Warn("failed to check upgrade blockers", "error", err)
+		}
+		upgradeBlockers = toCallbackDiagnostics(blockers)
+		if len(upgradeBlockers) > 0 {
+			logger.Warn("configuration uses features removed in a future version",
+				"count", len(upgradeBlockers),
+				"targetVersion", execCfg.UpgradeTargetVersion,
+			)
+		}
+	}
+
+	// Back up state before it changes
+	if execCfg.StateBackup != nil && changesState(execCfg.Operation) {
+		phases.Start("state-backup")
+		opts := terraform.SecureDeleteOptions{
+			Passes:  execCfg.SecureDeletePasses,
+			Pattern: execCfg.SecureDeletePattern,
+		}
+		if err := backupState(cancelCtx, exec, workDir, execCfg.StateBackup, opts); err != nil {
+			_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{
+				ExitCode:      1,
+				FailureReason: "state_backup_failed",
+				Manifest:      manifest,
+				Commands:      exec.Commands(),
+				LogPhases:     phases.Phases(),
+			})
+			return fmt.Errorf("backing up state: %w", err)
+		}
+		logger.Info("state backed up before run")
+	}
 
 	// Execute operation
+	phases.Start(execCfg.Operation)
 	result, err := exec.Run(cancelCtx, execCfg.Operation)
+	if lockWatcher != nil {
+		// Report any last lock status before the final one.
+		lockWatcher.Stop()
+	}
 	if err != nil {
-		exitCode := 1
+		details := &callback.StatusDetails{
+			ExitCode:         1,
+			SourceDurationMs: src.Metrics.Duration.Milliseconds(),
+			SourceBytes:      src.Metrics.Bytes,
+			SourceCloneMs:    src.Metrics.CloneDuration.Milliseconds(),
+			SourceCheckoutMs: src.Metrics.CheckoutDuration.Milliseconds(),
+			UpgradeBlockers:  upgradeBlockers,
+			FailureReason:    failureReason(err),
+			BinarySource:     binary.Source,
+			BinaryCacheDir:   binary.CacheDir,
+			Manifest:         manifest,
+			Commands:         exec.Commands(),
+			LogPhases:        phases.Phases(),
+			Retries:          retryStats(execCfg, cb, src),
+			InitUpgraded:     exec.InitUpgraded(),
+		}
+		setLockFileChange(details, exec)
 		if result != nil {
-			exitCode = result.ExitCode
+			details.ExitCode = result.ExitCode
+			details.ResourcesToAdd = result.ResourcesToAdd
+			details.ResourcesToChange = result.ResourcesToChange
+			details.ResourcesToDestroy = result.ResourcesToDestroy
+			details.ResourcesToReplace = result.ResourcesToReplace
+			details.ResourcesToRead = result.ResourcesToRead
+			details.Diagnostics = toCallbackDiagnostics(result.Diagnostics)
 		}
-		_ = cb.ReportStatus(ctx, "failed", &callback.StatusDetails{
-			ExitCode:           exitCode,
-			ResourcesToAdd:     result.ResourcesToAdd,
-			ResourcesToChange:  result.ResourcesToChange,
-			ResourcesToDestroy: result.ResourcesToDestroy,
-		})
+		if execCfg.AllowOutputErrors && errors.Is(err, terraform.ErrOutputErrors) {
+			// The infrastructure changed; only outputs are missing.
+			logger.Warn("apply succeeded but outputs failed to evaluate", "error", err)
+			if err := cb.ReportStatus(ctx, "succeeded_with_output_errors", details); err != nil {
+				logger.Warn("failed to report status", "error", err)
+			}
+			if result.Outputs != nil {
+				if err := cb.ReportOutputs(ctx, result.Outputs); err != nil {
+					logger.Warn("failed to report outputs", "error", err)
+				}
+			}
+			return nil
+		}
+		_ = cb.ReportStatus(ctx, "failed", details)
 		return fmt.Errorf("terraform %s: %w", execCfg.Operation, err)
 	}
 
 	// 10. Report success
+	warnings := terraform.FilterWarnings(result.Warnings, execCfg.SuppressWarnings)
+	countAfter := stateResourceCount(cancelCtx, logger, exec, execCfg.Operation)
 	details := &callback.StatusDetails{
-		ExitCode:           result.ExitCode,
-		ResourcesToAdd:     result.ResourcesToAdd,
-		ResourcesToChange:  result.ResourcesToChange,
-		ResourcesToDestroy: result.ResourcesToDestroy,
+		ExitCode:                 result.ExitCode,
+		ResourcesToAdd:           result.ResourcesToAdd,
+		ResourcesToChange:        result.ResourcesToChange,
+		ResourcesToDestroy:       result.ResourcesToDestroy,
+		ResourcesToReplace:       result.ResourcesToReplace,
+		ResourcesToRead:          result.ResourcesToRead,
+		SourceDurationMs:         src.Metrics.Duration.Milliseconds(),
+		SourceBytes:              src.Metrics.Bytes,
+		SourceCloneMs:            src.Metrics.CloneDuration.Milliseconds(),
+		SourceCheckoutMs:         src.Metrics.CheckoutDuration.Milliseconds(),
+		UpgradeBlockers:          upgradeBlockers,
+		LockFile:                 result.LockFile,
+		Warnings:                 toCallbackDiagnostics(warnings),
+		Diagnostics:              toCallbackDiagnostics(result.Diagnostics),
+		StateResourceCountBefore: countBefore,
+		StateResourceCount:       countAfter,
+		Providers:                toCallbackProviders(result.Providers),
+		BinarySource:             binary.Source,
+		BinaryCacheDir:           binary.CacheDir,
+		Manifest:                 manifest,
+		PlanDigest:               result.PlanDigest,
+		Commands:                 exec.Commands(),
+		LogPhases:                phases.Phases(),
+	}
+
+	details.LikelyProviderUpgradeNoise = result.LikelySchemaNoise
+	details.PlanCountMismatch = result.CountMismatch
+	details.InitUpgraded = exec.InitUpgraded()
+	setLockFileChange(details, exec)
+	if execCfg.Operation == "plan" && result.PlanJSON != "" {
+		details.EstimatedApplySeconds = estimateApplySeconds(logger, result.PlanJSON, execCfg.ApplyTimingSeconds)
+	}
+
+	// Apply and destroy checked their plan's warnings before changing
+	// anything; failing them now would not undo the changes.
+	if execCfg.StrictWarnings && len(warnings) > 0 && !changesInfrastructure(execCfg.Operation) {
+		details.ExitCode = 1
+		_ = cb.ReportStatus(ctx, "failed", details)
+		return fmt.Errorf("terraform %s: %d warning(s) with strict warnings enabled", execCfg.Operation, len(warnings))
 	}
-	if result.PlanJSON != "" {
-		details.PlanJSON = result.PlanJSON
+	// Prefer the dedicated plan endpoint; older Butler versions without one
+	// expect the plan inline in the status payload.
+	planReported := false
+	if execCfg.Callbacks.PlanURL != "" && (result.PlanJSON != "" || result.PlanText != "") {
+		if err := cb.ReportPlan(ctx, result.PlanJSON, result.PlanText); err != nil {
+			logger.Warn("failed to report plan, including it in status", "error", err)
+		} else {
+			planReported = true
+		}
 	}
-	if result.PlanText != "" {
-		details.PlanText = result.PlanText
+	if !planReported {
+		if result.PlanJSON != "" {
+			details.PlanJSON = result.PlanJSON
+		}
+		if result.PlanText != "" {
+			details.PlanText = result.PlanText
+		}
 	}
 
+	details.Retries = retryStats(execCfg, cb, src)
 	if err := cb.ReportStatus(ctx, "succeeded", details); err != nil {
 		logger.Warn("failed to report success status", "error", err)
 	}
 
 	// 11. Report outputs if apply
 	if result.Outputs != nil {
-		if err := cb.ReportOutputs(ctx, result.Outputs); err != nil {
+		var err error
+		if execCfg.ReportOutputChanges {
+			err = cb.ReportOutputChanges(ctx, result.Outputs, execCfg.PreviousOutputs)
+		} else {
+			err = cb.ReportOutputs(ctx, result.Outputs)
+		}
+		if err != nil {
 			logger.Warn("failed to report outputs", "error", err)
 		}
 	}
@@ -180,15 +551,234 @@ func RunManaged(ctx context.Context, logger *slog.Logger, cfg ManagedConfig) err
 	return nil
 }
 
+// dataDirKey identifies the module a managed run executes, so its runs
+// share a data dir and other modules get their own.
+func dataDirKey(src config.SourceConfig) string {
+	return strings.Join([]string{src.Type, src.GitRepo, src.ArchiveURL, src.LocalPath, src.WorkingDirectory}, "\x00")
+}
+
+// retryStats collects the retries consumed so far by the config fetch,
+// callbacks, and source clone.
+func retryStats(execCfg *config.ExecutionConfig, cb *callback.Client, src *source.Result) *callback.RetryStats {
+	return &callback.RetryStats{
+		ConfigFetch: execCfg.FetchRetries,
+		Callback:    cb.Retries(),
+		Clone:       src.Metrics.Retries,
+	}
+}
+
+// changesState reports whether operation may modify state.
+func changesState(operation string) bool {
+	switch operation {
+	case "apply", "destroy", "refresh":
+		return true
+	default:
+		return false
+	}
+}
+
+// backupState pulls the current state into workDir, uploads an encrypted
+// copy, and securely deletes the local file whether or not the upload
+// succeeded.
+func backupState(ctx context.Context, exec *terraform.Executor, workDir string, cfg *config.StateBackupConfig, opts terraform.SecureDeleteOptions) error {
+	key, err := backup.ParseKey(cfg.EncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(workDir, ".butler-state-backup.tfstate")
+	defer terraform.SecureDeleteWith(path, opts)
+
+	if err := exec.PullState(ctx, path); err != nil {
+		return err
+	}
+	return backup.UploadFile(ctx, cfg.UploadURL, key, path)
+}
+
+// stateResourceCount counts the resources in state for operations that read
+// or change it. It returns nil when the count is not applicable or fails;
+// counting is best effort and never fails the run.
+func stateResourceCount(ctx context.Context, logger *slog.Logger, exec *terraform.Executor, operation string) *int {
+	switch operation {
+	case "plan", "apply", "destroy", "refresh":
+	default:
+		return nil
+	}
+	n, err := exec.StateResourceCount(ctx)
+	if err != nil {
+		logger.Warn("failed to count state resources", "error", err)
+		return nil
+	}
+	return &n
+}
+
+// logRedactor masks sensitive variable values and the values of secret
+// environment variables in streamed logs, in case terraform echoes them.
+func logRedactor(execCfg *config.ExecutionConfig) *logstream.Redactor {
+	r := logstream.NewRedactor()
+	for _, vars := range []map[string]config.Variable{execCfg.Variables, execCfg.EnvVars} {
+		for _, v := range vars {
+			if s, ok := v.Value.(string); ok && v.Sensitive {
+				r.Add(s)
+			}
+		}
+	}
+	r.AddEnv(append(slices.Clone(logstream.DefaultSecretEnvVars), execCfg.RedactEnvVars...))
+	return r
+}
+
+// estimateApplySeconds estimates the apply time of a plan in whole seconds,
+// returning 0 if the plan cannot be read.
+func estimateApplySeconds(logger *slog.Logger, planJSON string, timingSeconds map[string]float64) int {
+	timings := make(map[string]time.Duration, len(timingSeconds))
+	for t, secs := range timingSeconds {
+		timings[t] = time.Duration(secs * float64(time.Second))
+	}
+	d, err := terraform.EstimateApplyDuration([]byte(planJSON), timings)
+	if err != nil {
+		logger.Warn("failed to estimate apply time", "error", err)
+		return 0
+	}
+	return int(d.Round(time.Second) / time.Second)
+}
+
+// toCallbackProviders converts installed providers for reporting.
+func toCallbackProviders(providers []terraform.Provider) []callback.Provider {
+	var out []callback.Provider
+	for _, p := range providers {
+		out = append(out, callback.Provider{Address: p.Address, Version: p.Version, Hashes: p.Hashes})
+	}
+	return out
+}
+
+// setLockFileChange reports whether init changed the lock file, and the
+// providers it then records.
+func setLockFileChange(details *callback.StatusDetails, exec *terraform.Executor) {
+	changed, providers := exec.LockFileChanged()
+	if !changed {
+		return
+	}
+	details.LockFileChanged = true
+	details.LockFileProviders = toCallbackProviders(providers)
+}
+
+// secureDelete and plainDelete remove the tfvars file; tests replace them.
+var (
+	secureDelete = terraform.SecureDeleteWith
+	plainDelete  = os.Remove
+)
+
+// removeTfvars deletes the tfvars file, overwriting it first only when it
+// may hold sensitive data. Upstream outputs carry no sensitivity flag, so
+// any upstream output is treated as sensitive.
+func removeTfvars(path string, execCfg *config.ExecutionConfig) {
+	if execCfg.SecureDeleteAlways || len(execCfg.UpstreamOutputs) > 0 || hasSensitiveVariable(execCfg.Variables) {
+		secureDelete(path, terraform.SecureDeleteOptions{
+			Passes:  execCfg.SecureDeletePasses,
+			Pattern: execCfg.SecureDeletePattern,
+		})
+		return
+	}
+	_ = plainDelete(path)
+}
+
+// hasSensitiveVariable reports whether any variable is marked sensitive.
+func hasSensitiveVariable(vars map[string]config.Variable) bool {
+	for _, v := range vars {
+		if v.Sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// toCallbackDiagnostics converts terraform diagnostics for reporting.
+func toCallbackDiagnostics(diags []terraform.Diagnostic) []callback.Diagnostic {
+	var out []callback.Diagnostic
+	for _, d := range diags {
+		cd := callback.Diagnostic{
+			Severity: d.Severity,
+			Summary:  d.Summary,
+			Detail:   d.Detail,
+		}
+		if r := d.Range; r != nil {
+			cd.Range = &callback.DiagnosticRange{
+				Filename:    r.Filename,
+				StartLine:   r.Start.Line,
+				StartColumn: r.Start.Column,
+				EndLine:     r.End.Line,
+				EndColumn:   r.End.Column,
+			}
+		}
+		out = append(out, cd)
+	}
+	return out
+}
+
+// changesInfrastructure reports whether operation applies changes.
+func changesInfrastructure(operation string) bool {
+	return operation == "apply" || operation == "destroy"
+}
+
+// failureReason classifies a terraform error for the status callback.
+func failureReason(err error) string {
+	var authErr *terraform.BackendAuthError
+	switch {
+	case errors.As(err, &authErr):
+		return "backend_auth_failed"
+	case errors.Is(err, terraform.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, terraform.ErrProtectedDestroy):
+		return "protected_destroy"
+	case errors.Is(err, terraform.ErrNotDestroyPlan):
+		return "not_destroy_plan"
+	case errors.Is(err, terraform.ErrLargePlan):
+		return "large_plan"
+	case errors.Is(err, terraform.ErrStrictWarnings):
+		return "strict_warnings"
+	case errors.Is(err, terraform.ErrDownloadStalled):
+		return "provider_download_stalled"
+	case errors.Is(err, terraform.ErrOutputErrors):
+		return "output_errors"
+	case errors.Is(err, terraform.ErrPlanDigestMismatch):
+		return "plan_digest_mismatch"
+	default:
+		return ""
+	}
+}
+
+// withAttempt tags status callbacks and log records with the run attempt
+// number so retried runs can be told apart.
+func withAttempt(logger *slog.Logger, cb *callback.Client, attempt int) *slog.Logger {
+	if attempt <= 0 {
+		return logger
+	}
+	cb.SetAttempt(attempt)
+	return logger.With("attempt", attempt)
+}
+
 // RunLocal executes a local terraform run without Butler API.
-func RunLocal(ctx context.Context, logger *slog.Logger, cfg LocalConfig) error {
+func RunLocal(ctx context.Context, logger *slog.Logger, cfg LocalConfig) (err error) {
 	logger.Info("running in local mode",
 		"workingDir", cfg.WorkingDir,
 		"operation", cfg.Operation,
 	)
+	events := newEventWriter(cfg.Events)
+	events.emit("run_started", map[string]interface{}{
+		"operation":  cfg.Operation,
+		"workingDir": cfg.WorkingDir,
+	})
+	defer func() {
+		if err != nil {
+			events.emit("run_failed", map[string]interface{}{
+				"operation": cfg.Operation,
+				"error":     err.Error(),
+			})
+		}
+	}()
 
 	// Resolve terraform version
-	tfPath, err := terraform.ResolveVersion(ctx, logger, cfg.TfVersion)
+	binary, err := terraform.ResolveVersion(ctx, logger, cfg.TfVersion, cfg.TfDistribution)
 	if err != nil {
 		return fmt.Errorf("resolving terraform version: %w", err)
 	}
@@ -198,26 +788,154 @@ func RunLocal(ctx context.Context, logger *slog.Logger, cfg LocalConfig) error {
 		return fmt.Errorf("resolving working directory: %w", err)
 	}
 
-	exec := terraform.NewExecutor(tfPath, absDir, logger)
+	exec := terraform.NewExecutor(binary.Path, absDir, logger)
+	skipBackend := cfg.SkipBackend || !terraform.NeedsBackend(cfg.Operation)
+	exec.SetPlanFile(cfg.PlanFile)
+	exec.SetDestroyPlan(cfg.DestroyPlan)
+	exec.SetApprovedPlanDigest(cfg.ApprovedPlanDigest)
+	exec.SetLockPlatforms(cfg.LockPlatforms)
+	exec.SetGracePeriod(cfg.GracePeriod)
+	exec.SetTimeout(cfg.Timeout)
+	exec.SetLockTimeout(cfg.LockTimeout)
+	exec.SetDestroyProtection(cfg.ProtectedTypes, cfg.AllowedDestroys)
+	exec.SetLargePlanLimit(cfg.LargePlanThreshold, cfg.BlockLargePlans)
+	exec.SetStrictWarnings(cfg.StrictWarnings, cfg.SuppressWarnings)
+	exec.SetDetectSchemaNoise(cfg.DetectSchemaNoise)
+	exec.SetInitOptions(terraform.InitOptions{
+		PluginCacheDir:     cfg.PluginCacheDir,
+		RegistryTimeout:    cfg.RegistryTimeout,
+		DiscoveryRetries:   cfg.RegistryRetries,
+		PluginCacheMinFree: cfg.PluginCacheMinFree,
+		SkipBackend:        skipBackend,
+		StallTimeout:       cfg.InitStallTimeout,
+
+		UpgradeOnLockMismatch: cfg.UpgradeOnLockMismatch,
+	})
+	if err := exec.SetTargets(cfg.Targets); err != nil {
+		return fmt.Errorf("configuring targets: %w", err)
+	}
+	if err := exec.SetDataDir(cfg.DataDir, absDir, cfg.DataDirClean); err != nil {
+		return fmt.Errorf("configuring data dir: %w", err)
+	}
+	if err := exec.SetVarFiles(cfg.VarFiles); err != nil {
+		return fmt.Errorf("configuring var files: %w", err)
+	}
+	if err := exec.SetIsolation(cfg.Isolate, cfg.IsolationRoot); err != nil {
+		return fmt.Errorf("configuring isolation: %w", err)
+	}
+	exec.SetExitWithParent(cfg.ExitWithParent)
+	if cfg.Events != nil {
+		exec.SetConsole(os.Stderr)
+	}
+
+	if cfg.ExitWithParent {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithCancel(ctx)
+		defer cancelFunc()
+		go cancel.NewParentWatcher(logger).Start(ctx, cancelFunc)
+	}
+
+	if cfg.IdleTimeout > 0 {
+		var cancelFunc context.CancelFunc
+		ctx, cancelFunc = context.WithCancel(ctx)
+		defer cancelFunc()
+		idle := cancel.NewIdleWatcher(cfg.IdleTimeout, logger)
+		go idle.Start(ctx, cancelFunc)
+		exec.SetLogWriters(idle, idle)
+	}
+
+	unlock, err := exec.Lock(ctx)
+	if err != nil {
+		return fmt.Errorf("locking shared directories: %w", err)
+	}
+	defer unlock()
 
 	// Init
 	logger.Info("running terraform init")
+	events.emit("phase_started", map[string]interface{}{"phase": "init"})
 	if err := exec.Init(ctx); err != nil {
 		return fmt.Errorf("terraform init: %w", err)
 	}
+	if exec.InitUpgraded() {
+		logger.Warn("init was retried with -upgrade after a lock file checksum mismatch")
+	}
+	if changed, _ := exec.LockFileChanged(); changed {
+		logger.Warn("init changed the dependency lock file")
+	}
+	if cfg.Workspace != "" && cfg.Operation != "init" && !skipBackend {
+		if err := exec.SelectWorkspace(ctx, cfg.Workspace); err != nil {
+			return fmt.Errorf("selecting workspace: %w", err)
+		}
+	}
+	events.emit("phase_completed", map[string]interface{}{"phase": "init"})
+	logger.Info("terraform workspace active", "workspace", exec.Workspace())
 
 	// Run
+	events.emit("phase_started", map[string]interface{}{"phase": cfg.Operation})
 	result, err := exec.Run(ctx, cfg.Operation)
+	if result != nil {
+		events.emit("phase_completed", map[string]interface{}{
+			"phase":    cfg.Operation,
+			"exitCode": result.ExitCode,
+		})
+	}
+	if cfg.JUnitReport != "" && result != nil {
+		if err := terraform.WriteJUnitReport(cfg.JUnitReport, cfg.Operation, result); err != nil {
+			logger.Warn("failed to write JUnit report", "error", err)
+		} else {
+			logger.Info("JUnit report written", "path", cfg.JUnitReport)
+		}
+	}
+	if result != nil {
+		for _, d := range result.Diagnostics {
+			if d.Severity == "error" {
+				logger.Error("terraform diagnostic", "summary", d.Summary, "detail", d.Detail)
+			}
+		}
+	}
+	if cfg.AllowOutputErrors && errors.Is(err, terraform.ErrOutputErrors) {
+		logger.Warn("apply succeeded but outputs failed to evaluate", "error", err)
+		err = nil
+	}
 	if err != nil {
 		return fmt.Errorf("terraform %s: %w", cfg.Operation, err)
 	}
 
+	warnings := terraform.FilterWarnings(result.Warnings, cfg.SuppressWarnings)
+	for _, w := range warnings {
+		logger.Warn("terraform warning", "summary", w.Summary)
+	}
+	if cfg.StrictWarnings && len(warnings) > 0 && !changesInfrastructure(cfg.Operation) {
+		return fmt.Errorf("terraform %s: %d warning(s) with strict warnings enabled", cfg.Operation, len(warnings))
+	}
+	for _, p := range result.Providers {
+		logger.Info("provider installed", "address", p.Address, "version", p.Version)
+	}
+	if result.PlanDigest != "" {
+		logger.Info("saved plan", "path", cfg.PlanFile, "digest", result.PlanDigest)
+	}
+	if result.LikelySchemaNoise {
+		logger.Info("plan looks like provider upgrade noise")
+	}
+
+	events.emit("run_completed", map[string]interface{}{
+		"operation":          cfg.Operation,
+		"exitCode":           result.ExitCode,
+		"resourcesToAdd":     result.ResourcesToAdd,
+		"resourcesToChange":  result.ResourcesToChange,
+		"resourcesToDestroy": result.ResourcesToDestroy,
+		"resourcesToReplace": result.ResourcesToReplace,
+		"resourcesToRead":    result.ResourcesToRead,
+		"warnings":           len(warnings),
+	})
 	logger.Info("local run completed",
 		"operation", cfg.Operation,
 		"exitCode", result.ExitCode,
 		"resourcesToAdd", result.ResourcesToAdd,
 		"resourcesToChange", result.ResourcesToChange,
 		"resourcesToDestroy", result.ResourcesToDestroy,
+		"resourcesToReplace", result.ResourcesToReplace,
+		"resourcesToRead", result.ResourcesToRead,
 	)
 
 	return nil
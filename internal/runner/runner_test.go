@@ -4,7 +4,29 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/backup"
+	"github.com/butlerdotdev/butler-runner/internal/callback"
+	"github.com/butlerdotdev/butler-runner/internal/config"
+	"github.com/butlerdotdev/butler-runner/internal/source"
+	"github.com/butlerdotdev/butler-runner/internal/terraform"
 )
 
 func TestLocalConfigDefaults(t *testing.T) {
@@ -36,3 +58,364 @@ func TestManagedConfigValidation(t *testing.T) {
 		t.Error("expected non-empty Token")
 	}
 }
+
+func TestAttemptInStatusAndLogs(t *testing.T) {
+	var receivedBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cb := callback.NewClient(server.URL, "token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+
+	var logBuf bytes.Buffer
+	logger := withAttempt(slog.New(slog.NewJSONHandler(&logBuf, nil)), cb, 3)
+
+	if err := cb.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+	if receivedBody["attempt"] != float64(3) {
+		t.Errorf("expected attempt 3 in status callback, got %v", receivedBody["attempt"])
+	}
+
+	logger.Info("running terraform init")
+	var record map[string]interface{}
+	if err := json.Unmarshal(logBuf.Bytes(), &record); err != nil {
+		t.Fatalf("decoding log record: %v", err)
+	}
+	if record["attempt"] != float64(3) {
+		t.Errorf("expected attempt 3 in log record, got %v", record["attempt"])
+	}
+}
+
+func TestRetryStatsReported(t *testing.T) {
+	var configCalls, statusCalls int
+	var receivedBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			configCalls++
+			if configCalls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"runId": "run-1", "operation": "plan"}`))
+			return
+		}
+		statusCalls++
+		if statusCalls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&receivedBody)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	execCfg, err := config.FetchConfig(context.Background(), logger, server.URL, "run-1", "token")
+	if err != nil {
+		t.Fatalf("FetchConfig failed: %v", err)
+	}
+	cb := callback.NewClient(server.URL, "token", config.CallbackURLs{
+		StatusURL: "/v1/ci/module-runs/run-1/status",
+	})
+	cb.SetRetryPolicy(3, time.Millisecond)
+	if err := cb.ReportStatus(context.Background(), "running", nil); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+
+	src := &source.Result{Metrics: source.Metrics{Retries: 2}}
+	details := &callback.StatusDetails{Retries: retryStats(execCfg, cb, src)}
+	if err := cb.ReportStatus(context.Background(), "succeeded", details); err != nil {
+		t.Fatalf("ReportStatus failed: %v", err)
+	}
+
+	want := map[string]interface{}{"config_fetch": float64(1), "callback": float64(1), "clone": float64(2)}
+	if !reflect.DeepEqual(receivedBody["retries"], want) {
+		t.Errorf("expected retries %v, got %v", want, receivedBody["retries"])
+	}
+}
+
+func TestBackupStateUploadsEncryptedAndDeletes(t *testing.T) {
+	const state = `{"version":4,"serial":7,"resources":[]}`
+
+	binDir := t.TempDir()
+	tfPath := filepath.Join(binDir, "terraform")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(binDir, "args") + "\necho '" + state + "'\n"
+	if err := os.WriteFile(tfPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake terraform: %v", err)
+	}
+
+	var uploaded []byte
+	var method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		uploaded, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	workDir := t.TempDir()
+	exec := terraform.NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err := backupState(context.Background(), exec, workDir, &config.StateBackupConfig{
+		UploadURL:     server.URL + "/backups/run-1.tfstate.enc",
+		EncryptionKey: base64.StdEncoding.EncodeToString(key),
+	}, terraform.SecureDeleteOptions{})
+	if err != nil {
+		t.Fatalf("backupState: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(binDir, "args"))
+	if string(args) != "state pull\n" {
+		t.Errorf("expected terraform state pull, got %q", args)
+	}
+	if method != http.MethodPut {
+		t.Errorf("expected PUT upload, got %s", method)
+	}
+	if bytes.Contains(uploaded, []byte("serial")) {
+		t.Error("uploaded backup is not encrypted")
+	}
+	plaintext, err := backup.Decrypt(key, uploaded)
+	if err != nil {
+		t.Fatalf("decrypting backup: %v", err)
+	}
+	if string(bytes.TrimSpace(plaintext)) != state {
+		t.Errorf("unexpected backup contents %q", plaintext)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, ".butler-state-backup.tfstate")); !os.IsNotExist(err) {
+		t.Error("expected the local state copy to be deleted")
+	}
+}
+
+func TestEstimateApplySeconds(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	plan := `{"resource_changes": [
+		{"type": "aws_instance", "change": {"actions": ["create"]}},
+		{"type": "aws_rds_cluster", "change": {"actions": ["create"]}}
+	]}`
+
+	if got := estimateApplySeconds(logger, plan, nil); got != 30 {
+		t.Errorf("expected 30s with default timings, got %d", got)
+	}
+	if got := estimateApplySeconds(logger, plan, map[string]float64{"aws_rds_cluster": 612.4}); got != 612 {
+		t.Errorf("expected 612s with historical timings, got %d", got)
+	}
+	if got := estimateApplySeconds(logger, "not json", nil); got != 0 {
+		t.Errorf("expected 0 for an unreadable plan, got %d", got)
+	}
+}
+
+func TestRemoveTfvarsSecureDeletesOnlySensitive(t *testing.T) {
+	var secure, plain int
+	origSecure, origPlain := secureDelete, plainDelete
+	secureDelete = func(string, terraform.SecureDeleteOptions) { secure++ }
+	plainDelete = func(string) error { plain++; return nil }
+	t.Cleanup(func() { secureDelete, plainDelete = origSecure, origPlain })
+
+	tests := []struct {
+		name       string
+		cfg        config.ExecutionConfig
+		wantSecure bool
+	}{
+		{"no sensitive", config.ExecutionConfig{Variables: map[string]config.Variable{"region": {Value: "us-east-1"}}}, false},
+		{"sensitive variable", config.ExecutionConfig{Variables: map[string]config.Variable{
+			"region":   {Value: "us-east-1"},
+			"password": {Value: "hunter2", Sensitive: true},
+		}}, true},
+		{"upstream outputs", config.ExecutionConfig{UpstreamOutputs: map[string]interface{}{"vpc_id": "vpc-1"}}, true},
+		{"always", config.ExecutionConfig{SecureDeleteAlways: true}, true},
+	}
+	for _, tt := range tests {
+		secure, plain = 0, 0
+		removeTfvars("terraform.tfvars.json", &tt.cfg)
+		if tt.wantSecure && (secure != 1 || plain != 0) {
+			t.Errorf("%s: expected secure delete, got secure=%d plain=%d", tt.name, secure, plain)
+		}
+		if !tt.wantSecure && (secure != 0 || plain != 1) {
+			t.Errorf("%s: expected plain delete, got secure=%d plain=%d", tt.name, secure, plain)
+		}
+	}
+}
+
+func TestRunManagedChecksConnectionFirst(t *testing.T) {
+	var configFetched bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/ci/module-runs/run-1/config" {
+			configFetched = true
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := RunManaged(context.Background(), logger, ManagedConfig{
+		ButlerURL:       server.URL,
+		RunID:           "run-1",
+		Token:           "expired",
+		CheckConnection: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Fatalf("expected an invalid token error, got %v", err)
+	}
+	if configFetched {
+		t.Error("expected the run to stop before fetching config")
+	}
+}
+
+func TestRunManagedRequiresAbsolutePlanFile(t *testing.T) {
+	var status string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"runId": "run-1", "operation": "apply", "planFile": "tfplan",
+				"callbacks": {"statusUrl": "/v1/ci/module-runs/run-1/status"}}`))
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		status, _ = body["status"].(string)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := RunManaged(context.Background(), logger, ManagedConfig{
+		ButlerURL: server.URL,
+		RunID:     "run-1",
+		Token:     "token",
+	})
+	if err == nil || !strings.Contains(err.Error(), "must be an absolute path") {
+		t.Fatalf("expected an absolute path error, got %v", err)
+	}
+	if status != "failed" {
+		t.Errorf("expected failed status, got %q", status)
+	}
+}
+
+func TestInitFailureReportsManifest(t *testing.T) {
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+  version) echo "Terraform v1.9.8" ;;
+  init) echo "Error: Failed to query available provider packages" >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "terraform"), []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake terraform: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "main.tf"), []byte("# empty\n"), 0o644); err != nil {
+		t.Fatalf("writing main.tf: %v", err)
+	}
+
+	var mu sync.Mutex
+	var last map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/config"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"runId":          "run-1",
+				"operation":      "plan",
+				"reportManifest": true,
+				"source":         map[string]interface{}{"type": "local", "localPath": sourceDir},
+				"callbacks":      map[string]interface{}{"statusUrl": "/v1/ci/module-runs/run-1/status"},
+			})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/status"):
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			last = body
+			mu.Unlock()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := RunManaged(context.Background(), logger, ManagedConfig{
+		ButlerURL: server.URL,
+		RunID:     "run-1",
+		Token:     "token",
+	})
+	if err == nil || !strings.Contains(err.Error(), "terraform init") {
+		t.Fatalf("expected init to fail, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if last["status"] != "failed" {
+		t.Fatalf("expected failed status, got %v", last["status"])
+	}
+	if !strings.Contains(fmt.Sprint(last), "main.tf") {
+		t.Errorf("expected the init failure status to carry the manifest, got %v", last)
+	}
+}
+
+func TestRunLocalEmitsEvents(t *testing.T) {
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+  version) echo "Terraform v1.9.8" ;;
+  init) echo "Terraform has been successfully initialized!" ;;
+  plan) touch "$PWD/tfplan"; exit 2 ;;
+  show) echo '{"resource_changes":[{"address":"aws_instance.web","type":"aws_instance","change":{"actions":["create"]}}]}' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "terraform"), []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake terraform: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var events bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	err := RunLocal(context.Background(), logger, LocalConfig{
+		WorkingDir:     t.TempDir(),
+		Operation:      "plan",
+		TfDistribution: terraform.DistributionTerraform,
+		Events:         &events,
+	})
+	if err != nil {
+		t.Fatalf("RunLocal failed: %v", err)
+	}
+
+	var got []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(events.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("event is not JSON: %q: %v", line, err)
+		}
+		if event["time"] == nil {
+			t.Errorf("event %q has no time", line)
+		}
+		delete(event, "time")
+		got = append(got, event)
+	}
+
+	// The plan has changes, so it exits 2 as with -detailed-exitcode.
+	want := []map[string]interface{}{
+		{"event": "run_started", "operation": "plan", "workingDir": got[0]["workingDir"]},
+		{"event": "phase_started", "phase": "init"},
+		{"event": "phase_completed", "phase": "init"},
+		{"event": "phase_started", "phase": "plan"},
+		{"event": "phase_completed", "phase": "plan", "exitCode": float64(2)},
+		{"event": "run_completed", "operation": "plan", "exitCode": float64(2),
+			"resourcesToAdd": float64(1), "resourcesToChange": float64(0), "resourcesToDestroy": float64(0),
+			"resourcesToReplace": float64(0), "resourcesToRead": float64(0), "warnings": float64(0)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %d: %s", len(want), len(got), events.String())
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("event %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
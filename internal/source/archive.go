@@ -0,0 +1,227 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// downloadArchive fetches a .tar.gz or .zip archive over HTTP and extracts it
+// into a temp directory.
+func downloadArchive(ctx context.Context, logger *slog.Logger, src config.SourceConfig) (*Result, error) {
+	if src.ArchiveURL == "" {
+		return nil, fmt.Errorf("archive source requires a URL")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "butler-runner-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+
+	extractDir := filepath.Join(tmpDir, "source")
+	archivePath := filepath.Join(tmpDir, "source.archive")
+
+	logger.Info("downloading archive", "url", src.ArchiveURL)
+
+	start := time.Now()
+	size, err := fetchArchive(ctx, src.ArchiveURL, archivePath)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	if err := extractArchive(archivePath, extractDir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("extracting archive: %w", err)
+	}
+	_ = os.Remove(archivePath)
+	metrics := Metrics{Duration: time.Since(start), Bytes: size}
+
+	workDir, err := resolveWorkDir(extractDir, src.WorkingDirectory)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	logger.Info("source prepared",
+		"workDir", workDir,
+		"duration", metrics.Duration,
+		"bytes", metrics.Bytes,
+	)
+	return &Result{WorkDir: workDir, Metrics: metrics, root: extractDir, tmpDir: tmpDir}, nil
+}
+
+// fetchArchive downloads url to path and returns the number of bytes written.
+func fetchArchive(ctx context.Context, url, path string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating archive request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, &Error{Kind: KindNetworkError, Err: fmt.Errorf("downloading archive: %w", err)}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		kind := KindUnknown
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			kind = KindAuthFailed
+		}
+		return 0, &Error{Kind: kind, Err: fmt.Errorf("archive download returned %d", resp.StatusCode)}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("creating archive file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return n, &Error{Kind: KindNetworkError, Err: fmt.Errorf("downloading archive: %w", err)}
+	}
+	if err := f.Close(); err != nil {
+		return n, fmt.Errorf("closing archive file: %w", err)
+	}
+	return n, nil
+}
+
+// extractArchive detects the archive format from its magic bytes and
+// extracts it into dest.
+func extractArchive(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return extractZip(path, dest)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		return extractTar(gz, dest)
+	default:
+		return fmt.Errorf("unsupported archive format (expected .tar.gz or .zip)")
+	}
+}
+
+func extractTar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		default:
+			// Links and special files are skipped so an archive cannot
+			// point outside the extraction directory.
+		}
+	}
+}
+
+func extractZip(path, dest string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zr.Close() }()
+
+	for _, zf := range zr.File {
+		target, err := safeJoin(dest, zf.Name)
+		if err != nil {
+			return err
+		}
+
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, zf.Mode().Perm())
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeJoin joins an archive entry name onto dest, rejecting entries that
+// would escape it (e.g. "../../etc/passwd" or absolute paths).
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, name)
+	if target != dest && !strings.HasPrefix(target, dest+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %q escapes extraction directory", name)
+	}
+	return target, nil
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if perm == 0 {
+		perm = 0o644
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// tarball builds an in-memory .tar.gz from name → content pairs.
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatalf("writing tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("writing tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("closing gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestPrepareArchive(t *testing.T) {
+	data := tarball(t, map[string]string{
+		"modules/vpc/main.tf": `resource "null_resource" "x" {}`,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	result, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:             "archive",
+		ArchiveURL:       server.URL + "/module.tar.gz",
+		WorkingDirectory: "modules/vpc",
+	})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer result.Cleanup()
+
+	content, err := os.ReadFile(filepath.Join(result.WorkDir, "main.tf"))
+	if err != nil {
+		t.Fatalf("reading extracted file: %v", err)
+	}
+	if !strings.Contains(string(content), "null_resource") {
+		t.Errorf("unexpected extracted content: %q", content)
+	}
+	if result.Metrics.Bytes != int64(len(data)) {
+		t.Errorf("expected %d bytes downloaded, got %d", len(data), result.Metrics.Bytes)
+	}
+}
+
+func TestPrepareArchiveRejectsPathTraversal(t *testing.T) {
+	data := tarball(t, map[string]string{
+		"../../evil.tf": "pwned",
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	_, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:       "archive",
+		ArchiveURL: server.URL + "/module.tar.gz",
+	})
+	if err == nil {
+		t.Fatal("expected error for path traversal entry")
+	}
+	if !strings.Contains(err.Error(), "escapes extraction directory") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPrepareLocal(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "vpc", ".terraform"), 0o755); err != nil {
+		t.Fatalf("creating module dir: %v", err)
+	}
+	backend := []byte(`terraform { backend "local" {} }`)
+	if err := os.WriteFile(filepath.Join(root, "vpc", "backend.tf"), backend, 0o644); err != nil {
+		t.Fatalf("writing backend.tf: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	result, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:             "local",
+		LocalPath:        root,
+		WorkingDirectory: "vpc",
+	})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	// The run works on a copy, so generated files never touch the source.
+	if strings.HasPrefix(result.WorkDir, root) {
+		t.Fatalf("expected workDir outside the local path, got %q", result.WorkDir)
+	}
+	if got, err := os.ReadFile(filepath.Join(result.WorkDir, "backend.tf")); err != nil || string(got) != string(backend) {
+		t.Errorf("expected backend.tf to be copied, got %q (%v)", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(result.WorkDir, ".terraform")); !os.IsNotExist(err) {
+		t.Errorf("expected .terraform not to be copied, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(result.WorkDir, "backend.tf"), []byte("overridden"), 0o644); err != nil {
+		t.Fatalf("overwriting copied backend.tf: %v", err)
+	}
+
+	result.Cleanup()
+	if _, err := os.Stat(result.WorkDir); !os.IsNotExist(err) {
+		t.Errorf("expected copy to be removed by cleanup, got %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "vpc", "backend.tf")); err != nil || string(got) != string(backend) {
+		t.Errorf("expected the local backend.tf to be untouched, got %q (%v)", got, err)
+	}
+}
@@ -5,29 +5,137 @@ package source
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/butlerdotdev/butler-runner/internal/config"
 )
 
-// Prepare clones/downloads source code and returns the working directory path.
-func Prepare(ctx context.Context, logger *slog.Logger, src config.SourceConfig) (string, error) {
+// Result describes a prepared source.
+type Result struct {
+	WorkDir string
+	Metrics Metrics
+	root    string // top of the cloned, extracted, or local tree
+	tmpDir  string // removed by Cleanup; empty for sources used in place
+}
+
+// Cleanup removes any temporary directory created while preparing the source.
+func (r *Result) Cleanup() {
+	if r.tmpDir != "" {
+		_ = os.RemoveAll(r.tmpDir)
+	}
+}
+
+// Metrics records how long source preparation took and how much was fetched.
+type Metrics struct {
+	Duration time.Duration
+	Bytes    int64 // size of the fetched repository data on disk
+
+	// CloneDuration and CheckoutDuration split a git fetch into time spent
+	// cloning (including a failed shallow clone) and checking out the ref
+	// after a full clone. CheckoutDuration is zero when the shallow clone
+	// of the ref succeeded.
+	CloneDuration    time.Duration
+	CheckoutDuration time.Duration
+
+	// Retries counts clones repeated because the ref was not found yet.
+	Retries int
+}
+
+// gitTokenEnv is consulted when the source config carries no token.
+const gitTokenEnv = "BUTLER_GIT_TOKEN"
+
+// refRetryBaseDelay is the first backoff delay when a ref is not found; it
+// doubles on each subsequent attempt.
+var refRetryBaseDelay = 2 * time.Second
+
+// runGit executes git with the given arguments and extra environment in dir
+// and returns its combined output. It is a variable so tests can substitute
+// a fake git.
+var runGit = func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+// lookGit locates the git binary. It is a variable so tests can simulate a
+// missing git.
+var lookGit = func() (string, error) {
+	return exec.LookPath("git")
+}
+
+// authEnv returns environment variables that make git send the token as
+// HTTP basic auth. The header is passed via GIT_CONFIG_* rather than on the
+// command line so it never shows up in process listings or logged commands.
+func authEnv(token string) []string {
+	if token == "" {
+		return nil
+	}
+	creds := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + creds,
+	}
+}
+
+// redact removes any occurrence of secret from git output.
+func redact(output []byte, secret string) string {
+	if secret == "" {
+		return string(output)
+	}
+	return strings.ReplaceAll(string(output), secret, "***")
+}
+
+// Prepare clones/downloads source code and returns the working directory
+// along with fetch metrics. Unless src.AllowModuleEscape is set, the working
+// directory and local modules must stay within the source tree.
+func Prepare(ctx context.Context, logger *slog.Logger, src config.SourceConfig) (*Result, error) {
+	var res *Result
+	var err error
 	switch src.Type {
 	case "git":
-		return cloneGit(ctx, logger, src)
+		res, err = cloneGit(ctx, logger, src)
+	case "archive":
+		res, err = downloadArchive(ctx, logger, src)
+	case "local":
+		res, err = useLocal(logger, src)
 	default:
-		return "", fmt.Errorf("unsupported source type: %s", src.Type)
+		return nil, fmt.Errorf("unsupported source type: %s", src.Type)
+	}
+	if err != nil {
+		return nil, err
 	}
+	if !src.AllowModuleEscape {
+		if err := CheckModulePaths(res.root, res.WorkDir); err != nil {
+			res.Cleanup()
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
-func cloneGit(ctx context.Context, logger *slog.Logger, src config.SourceConfig) (string, error) {
+func cloneGit(ctx context.Context, logger *slog.Logger, src config.SourceConfig) (*Result, error) {
+	if _, err := lookGit(); err != nil {
+		return nil, &Error{
+			Kind: KindGitNotInstalled,
+			Err:  fmt.Errorf("git is required for source type 'git' but was not found on PATH: %w", err),
+		}
+	}
+
 	tmpDir, err := os.MkdirTemp("", "butler-runner-*")
 	if err != nil {
-		return "", fmt.Errorf("creating temp dir: %w", err)
+		return nil, fmt.Errorf("creating temp dir: %w", err)
 	}
 
 	cloneDir := filepath.Join(tmpDir, "source")
@@ -37,36 +145,132 @@ func cloneGit(ctx context.Context, logger *slog.Logger, src config.SourceConfig)
 		"ref", src.GitRef,
 	)
 
-	cmd := exec.CommandContext(ctx, "git", "clone",
-		"--depth=1",
-		"--branch", src.GitRef,
-		src.GitRepo,
-		cloneDir,
-	)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		// If branch clone fails (ref might be a commit), try full clone + checkout
-		cmd = exec.CommandContext(ctx, "git", "clone", src.GitRepo, cloneDir)
-		if output2, err2 := cmd.CombinedOutput(); err2 != nil {
+	token := src.GitToken
+	if token == "" {
+		token = os.Getenv(gitTokenEnv)
+	}
+	env := authEnv(token)
+
+	cloneCtx := ctx
+	if src.CloneTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		cloneCtx, cancel = context.WithTimeout(ctx, time.Duration(src.CloneTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	var metrics Metrics
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := fetchRef(cloneCtx, src, cloneDir, env, token, &metrics)
+		if err == nil {
+			break
+		}
+		// The ref may not be visible yet if the run was dispatched before
+		// the push landed, so only that case is worth waiting out.
+		if ErrorKindOf(err) != KindRefNotFound || attempt >= src.RefNotFoundRetries {
 			_ = os.RemoveAll(tmpDir)
-			return "", fmt.Errorf("git clone failed: %s / %s: %w", string(output), string(output2), err2)
+			return nil, err
 		}
-		checkoutCmd := exec.CommandContext(ctx, "git", "checkout", src.GitRef)
-		checkoutCmd.Dir = cloneDir
-		if output3, err3 := checkoutCmd.CombinedOutput(); err3 != nil {
+		metrics.Retries++
+		delay := refRetryBaseDelay << attempt
+		logger.Info("git ref not found, retrying",
+			"ref", src.GitRef,
+			"attempt", attempt+1,
+			"delay", delay,
+		)
+		_ = os.RemoveAll(cloneDir)
+		select {
+		case <-cloneCtx.Done():
 			_ = os.RemoveAll(tmpDir)
-			return "", fmt.Errorf("git checkout failed: %s: %w", string(output3), err3)
+			return nil, fmt.Errorf("waiting for git ref %s: %w", src.GitRef, cloneCtx.Err())
+		case <-time.After(delay):
 		}
 	}
+	metrics.Duration = time.Since(start)
+	metrics.Bytes = dirSize(filepath.Join(cloneDir, ".git"))
 
-	workDir := cloneDir
-	if src.WorkingDirectory != "" {
-		workDir = filepath.Join(cloneDir, src.WorkingDirectory)
-		if _, err := os.Stat(workDir); err != nil {
-			_ = os.RemoveAll(tmpDir)
-			return "", fmt.Errorf("working directory %s not found in repo: %w", src.WorkingDirectory, err)
+	workDir, err := resolveWorkDir(cloneDir, src.WorkingDirectory)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	logger.Info("source prepared",
+		"workDir", workDir,
+		"duration", metrics.Duration,
+		"cloneDuration", metrics.CloneDuration,
+		"checkoutDuration", metrics.CheckoutDuration,
+		"bytes", metrics.Bytes,
+	)
+	return &Result{WorkDir: workDir, Metrics: metrics, root: cloneDir, tmpDir: tmpDir}, nil
+}
+
+// fetchRef clones src.GitRepo into cloneDir at src.GitRef, adding the time
+// spent cloning and checking out to metrics. Failures are returned as
+// *Error classified from git's output.
+func fetchRef(ctx context.Context, src config.SourceConfig, cloneDir string, env []string, token string, metrics *Metrics) error {
+	start := time.Now()
+	output, err := runGit(ctx, "", env, "clone", "--depth=1", "--branch", src.GitRef, src.GitRepo, cloneDir)
+	if err == nil {
+		metrics.CloneDuration += time.Since(start)
+		return nil
+	}
+
+	// If branch clone fails (ref might be a commit), try full clone + checkout
+	output2, err2 := runGit(ctx, "", env, "clone", src.GitRepo, cloneDir)
+	metrics.CloneDuration += time.Since(start)
+	if err2 != nil {
+		return &Error{
+			Kind: classifyGitOutput(string(output2)),
+			Err:  fmt.Errorf("git clone failed: %s / %s: %w", redact(output, token), redact(output2, token), err2),
+		}
+	}
+	start = time.Now()
+	output3, err3 := runGit(ctx, cloneDir, env, "checkout", src.GitRef)
+	metrics.CheckoutDuration += time.Since(start)
+	if err3 != nil {
+		return &Error{
+			Kind: classifyGitOutput(string(output3)),
+			Err:  fmt.Errorf("git checkout failed: %s: %w", redact(output3, token), err3),
 		}
 	}
+	return nil
+}
+
+// refNotFoundRe matches git's messages for a branch, tag, or commit that
+// does not exist in the repository.
+var refNotFoundRe = regexp.MustCompile(`(?i)(remote branch .* not found|couldn't find remote ref|did not match any file\(s\) known to git|unknown revision|reference is not a tree)`)
 
-	logger.Info("source prepared", "workDir", workDir)
+// resolveWorkDir joins the configured working directory onto the source root
+// and verifies that it exists.
+func resolveWorkDir(root, workingDirectory string) (string, error) {
+	if workingDirectory == "" {
+		return root, nil
+	}
+	workDir := filepath.Join(root, workingDirectory)
+	if _, err := os.Stat(workDir); err != nil {
+		return "", &Error{
+			Kind: KindWorkDirNotFound,
+			Err:  fmt.Errorf("working directory %s not found in source: %w", workingDirectory, err),
+		}
+	}
 	return workDir, nil
 }
+
+// dirSize returns the total size of regular files under root, or 0 if it
+// cannot be walked.
+func dirSize(root string) int64 {
+	var size int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
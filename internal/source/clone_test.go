@@ -0,0 +1,274 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// fakeGit replaces runGit for the duration of a test.
+func fakeGit(t *testing.T, fn func(ctx context.Context, dir string, env []string, args ...string) ([]byte, error)) {
+	t.Helper()
+	orig, origLook := runGit, lookGit
+	runGit = fn
+	lookGit = func() (string, error) { return "/usr/bin/git", nil }
+	t.Cleanup(func() { runGit, lookGit = orig, origLook })
+}
+
+func TestCloneGitRecordsMetrics(t *testing.T) {
+	fakeGit(t, func(_ context.Context, _ string, _ []string, args ...string) ([]byte, error) {
+		// Simulate a slow clone that fetches 1 KiB of pack data.
+		cloneDir := args[len(args)-1]
+		if err := os.MkdirAll(filepath.Join(cloneDir, ".git"), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(cloneDir, ".git", "pack"), make([]byte, 1024), 0o644); err != nil {
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	result, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:    "git",
+		GitRepo: "https://example.com/repo.git",
+		GitRef:  "main",
+	})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer result.Cleanup()
+
+	if result.Metrics.Duration < 50*time.Millisecond {
+		t.Errorf("expected clone duration >= 50ms, got %s", result.Metrics.Duration)
+	}
+	if result.Metrics.Bytes != 1024 {
+		t.Errorf("expected 1024 bytes fetched, got %d", result.Metrics.Bytes)
+	}
+}
+
+func TestCloneGitTimesCloneAndCheckout(t *testing.T) {
+	fakeGit(t, func(_ context.Context, _ string, _ []string, args ...string) ([]byte, error) {
+		switch {
+		case args[0] == "clone" && args[1] == "--depth=1":
+			// The ref is a commit, so the shallow branch clone fails.
+			return []byte("fatal: Remote branch 3f2a9c1 not found in upstream origin"), errors.New("exit status 128")
+		case args[0] == "clone":
+			time.Sleep(30 * time.Millisecond)
+			return nil, os.MkdirAll(args[len(args)-1], 0o755)
+		case args[0] == "checkout":
+			time.Sleep(20 * time.Millisecond)
+			return nil, nil
+		}
+		return nil, errors.New("unexpected git call")
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	result, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:    "git",
+		GitRepo: "https://example.com/repo.git",
+		GitRef:  "3f2a9c1",
+	})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer result.Cleanup()
+
+	m := result.Metrics
+	if m.CloneDuration < 30*time.Millisecond {
+		t.Errorf("expected clone duration >= 30ms, got %s", m.CloneDuration)
+	}
+	if m.CheckoutDuration < 20*time.Millisecond {
+		t.Errorf("expected checkout duration >= 20ms, got %s", m.CheckoutDuration)
+	}
+	if m.Duration < m.CloneDuration+m.CheckoutDuration {
+		t.Errorf("expected total %s to cover clone %s and checkout %s", m.Duration, m.CloneDuration, m.CheckoutDuration)
+	}
+}
+
+func TestCloneGitUsesTokenWithoutLeaking(t *testing.T) {
+	const token = "ghp_supersecret"
+	wantHeader := "GIT_CONFIG_VALUE_0=Authorization: Basic " +
+		base64.StdEncoding.EncodeToString([]byte("x-access-token:"+token))
+
+	var sawHeader bool
+	fakeGit(t, func(_ context.Context, _ string, env []string, args ...string) ([]byte, error) {
+		for _, kv := range env {
+			if kv == wantHeader {
+				sawHeader = true
+			}
+		}
+		for _, arg := range args {
+			if strings.Contains(arg, token) {
+				t.Errorf("token leaked into git arguments: %v", args)
+			}
+		}
+		// Simulate git echoing the credential back in its error output.
+		return []byte("fatal: could not read from https://x-access-token:" + token + "@example.com"), errors.New("exit status 128")
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	_, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:     "git",
+		GitRepo:  "https://example.com/private.git",
+		GitRef:   "main",
+		GitToken: token,
+	})
+	if err == nil {
+		t.Fatal("expected clone error")
+	}
+	if !sawHeader {
+		t.Error("expected token to be passed to git as an auth header")
+	}
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("token leaked into error: %v", err)
+	}
+}
+
+func TestCloneGitRetriesRefNotFound(t *testing.T) {
+	refRetryBaseDelay = time.Millisecond
+	defer func() { refRetryBaseDelay = 2 * time.Second }()
+
+	var attempts int
+	fakeGit(t, func(_ context.Context, _ string, _ []string, args ...string) ([]byte, error) {
+		switch {
+		case args[0] == "clone" && args[2] == "--branch":
+			attempts++
+			if attempts <= 2 {
+				return []byte("warning: Could not find remote branch feature to clone.\nfatal: Remote branch feature not found in upstream origin"), errors.New("exit status 128")
+			}
+			return nil, os.MkdirAll(args[len(args)-1], 0o755)
+		case args[0] == "clone":
+			return nil, os.MkdirAll(args[len(args)-1], 0o755)
+		default: // checkout
+			return []byte("error: pathspec 'feature' did not match any file(s) known to git"), errors.New("exit status 1")
+		}
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	result, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:               "git",
+		GitRepo:            "https://example.com/repo.git",
+		GitRef:             "feature",
+		RefNotFoundRetries: 3,
+	})
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer result.Cleanup()
+
+	if attempts != 3 {
+		t.Errorf("expected 3 clone attempts, got %d", attempts)
+	}
+	if result.Metrics.Retries != 2 {
+		t.Errorf("expected 2 retries in metrics, got %d", result.Metrics.Retries)
+	}
+}
+
+func TestCloneGitDoesNotRetryAuthFailure(t *testing.T) {
+	refRetryBaseDelay = time.Millisecond
+	defer func() { refRetryBaseDelay = 2 * time.Second }()
+
+	var calls int
+	fakeGit(t, func(_ context.Context, _ string, _ []string, _ ...string) ([]byte, error) {
+		calls++
+		return []byte("fatal: Authentication failed for 'https://example.com/repo.git/'"), errors.New("exit status 128")
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	_, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:               "git",
+		GitRepo:            "https://example.com/repo.git",
+		GitRef:             "main",
+		RefNotFoundRetries: 3,
+	})
+	if err == nil {
+		t.Fatal("expected clone error")
+	}
+	// One branch clone plus one full clone, with no retries.
+	if calls != 2 {
+		t.Errorf("expected 2 git calls, got %d", calls)
+	}
+}
+
+func TestClassifyGitOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   ErrorKind
+	}{
+		{"fatal: Authentication failed for 'https://example.com/repo.git/'", KindAuthFailed},
+		{"fatal: could not read Username for 'https://github.com': terminal prompts disabled", KindAuthFailed},
+		{"git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.", KindAuthFailed},
+		{"remote: Repository not found.\nfatal: repository 'https://github.com/acme/private.git/' not found", KindAuthFailed},
+		{"warning: Could not find remote branch feature to clone.\nfatal: Remote branch feature not found in upstream origin", KindRefNotFound},
+		{"error: pathspec 'v9.9.9' did not match any file(s) known to git", KindRefNotFound},
+		{"fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com", KindNetworkError},
+		{"fatal: unable to access 'https://example.com/repo.git/': Failed to connect to example.com port 443: Connection refused", KindNetworkError},
+		{"error: RPC failed; curl 56 GnuTLS recv error (-9)\nfatal: early EOF", KindNetworkError},
+		{"fatal: destination path 'source' already exists and is not an empty directory.", KindUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyGitOutput(tt.output); got != tt.want {
+			t.Errorf("classifyGitOutput(%q) = %s, want %s", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareReturnsTypedErrors(t *testing.T) {
+	fakeGit(t, func(_ context.Context, _ string, _ []string, _ ...string) ([]byte, error) {
+		return []byte("fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com"), errors.New("exit status 128")
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:    "git",
+		GitRepo: "https://example.com/repo.git",
+		GitRef:  "main",
+	})
+	if kind := ErrorKindOf(err); kind != KindNetworkError {
+		t.Errorf("expected %s, got %s (%v)", KindNetworkError, kind, err)
+	}
+
+	_, err = Prepare(context.Background(), logger, config.SourceConfig{
+		Type:             "local",
+		LocalPath:        t.TempDir(),
+		WorkingDirectory: "missing",
+	})
+	if kind := ErrorKindOf(err); kind != KindWorkDirNotFound {
+		t.Errorf("expected %s, got %s (%v)", KindWorkDirNotFound, kind, err)
+	}
+}
+
+func TestCloneGitRequiresGit(t *testing.T) {
+	fakeGit(t, func(_ context.Context, _ string, _ []string, _ ...string) ([]byte, error) {
+		t.Error("git should not run when it is not installed")
+		return nil, errors.New("unreachable")
+	})
+	lookGit = func() (string, error) { return "", exec.ErrNotFound }
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := Prepare(context.Background(), logger, config.SourceConfig{
+		Type:    "git",
+		GitRepo: "https://example.com/repo.git",
+		GitRef:  "main",
+	})
+	if err == nil || !strings.Contains(err.Error(), "git is required for source type 'git' but was not found on PATH") {
+		t.Fatalf("expected a clear missing-git error, got %v", err)
+	}
+	if kind := ErrorKindOf(err); kind != KindGitNotInstalled {
+		t.Errorf("expected %s, got %s", KindGitNotInstalled, kind)
+	}
+}
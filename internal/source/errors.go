@@ -0,0 +1,65 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"errors"
+	"regexp"
+)
+
+// ErrorKind classifies why source preparation failed.
+type ErrorKind string
+
+const (
+	KindAuthFailed      ErrorKind = "auth_failed"
+	KindRefNotFound     ErrorKind = "ref_not_found"
+	KindNetworkError    ErrorKind = "network_error"
+	KindWorkDirNotFound ErrorKind = "working_dir_not_found"
+	KindGitNotInstalled ErrorKind = "git_not_installed"
+	KindModuleEscape    ErrorKind = "module_escape"
+	KindUnknown         ErrorKind = "unknown"
+)
+
+// Error is a source preparation failure with its classified kind.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorKindOf returns the kind of a source preparation error, or
+// KindUnknown if it was not classified.
+func ErrorKindOf(err error) ErrorKind {
+	var srcErr *Error
+	if errors.As(err, &srcErr) {
+		return srcErr.Kind
+	}
+	return KindUnknown
+}
+
+var (
+	// gitAuthRe matches git's messages for missing or rejected credentials.
+	// Hosts report inaccessible private repositories as not found.
+	gitAuthRe = regexp.MustCompile(`(?i)(authentication failed|could not read (username|password)|terminal prompts disabled|permission denied \(publickey|invalid username or password|repository .* not found|returned error: 40[13])`)
+	// gitNetworkRe matches git's messages for connection-level failures.
+	gitNetworkRe = regexp.MustCompile(`(?i)(could not resolve host|failed to connect|connection (refused|reset|timed out)|operation timed out|network is unreachable|ssl|gnutls|early eof|rpc failed|unexpected disconnect)`)
+)
+
+// classifyGitOutput returns the kind of failure described by git's output,
+// or KindUnknown.
+func classifyGitOutput(output string) ErrorKind {
+	switch {
+	case gitAuthRe.MatchString(output):
+		return KindAuthFailed
+	case refNotFoundRe.MatchString(output):
+		return KindRefNotFound
+	case gitNetworkRe.MatchString(output):
+		return KindNetworkError
+	default:
+		return KindUnknown
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// useLocal copies an existing directory (e.g. a mounted volume) into a
+// temporary directory and runs from the copy, so the files terraform and
+// the runner generate (backend override, tfvars, plans, .terraform) never
+// touch the operator's tree. Any .terraform directory is left behind.
+func useLocal(logger *slog.Logger, src config.SourceConfig) (*Result, error) {
+	if src.LocalPath == "" {
+		return nil, fmt.Errorf("local source requires a path")
+	}
+
+	localRoot, err := filepath.Abs(src.LocalPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local path: %w", err)
+	}
+	info, err := os.Stat(localRoot)
+	if err != nil {
+		return nil, fmt.Errorf("local path %s: %w", src.LocalPath, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("local path %s is not a directory", src.LocalPath)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "butler-runner-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+	root := filepath.Join(tmpDir, "source")
+
+	start := time.Now()
+	if err := copyTree(localRoot, root); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("copying local path: %w", err)
+	}
+	metrics := Metrics{Duration: time.Since(start), Bytes: dirSize(root)}
+
+	workDir, err := resolveWorkDir(root, src.WorkingDirectory)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	logger.Info("source prepared",
+		"localPath", localRoot,
+		"workDir", workDir,
+		"duration", metrics.Duration,
+		"bytes", metrics.Bytes,
+	)
+	return &Result{WorkDir: workDir, Metrics: metrics, root: root, tmpDir: tmpDir}, nil
+}
+
+// copyTree copies the directory src to dest, preserving file modes and
+// symlinks and skipping .terraform directories.
+func copyTree(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case d.IsDir():
+			if d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			return writeFile(target, f, info.Mode().Perm())
+		default:
+			return nil // sockets, devices, and pipes are not source files
+		}
+	})
+}
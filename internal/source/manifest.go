@@ -0,0 +1,93 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestEntry is one file in a working directory manifest.
+type ManifestEntry struct {
+	Path   string // slash-separated, relative to the working directory
+	SHA256 string // hex digest of the file contents
+}
+
+// manifestSkipDirs are directories left out of the manifest: terraform's
+// own data and version control metadata are not part of the executed code.
+var manifestSkipDirs = map[string]bool{".terraform": true, ".git": true}
+
+// manifestSkipSuffixes are local state files, which hold secrets in plain
+// text.
+var manifestSkipSuffixes = []string{".tfstate", ".tfstate.backup"}
+
+// Manifest lists the regular files under dir with their SHA-256 digests,
+// sorted by path. Terraform data, version control metadata and state files
+// are excluded. Symlinks to regular files are hashed by their target.
+func Manifest(dir string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && manifestSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skipManifestFile(d.Name()) {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{Path: filepath.ToSlash(rel), SHA256: sum})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, err
+}
+
+func skipManifestFile(name string) bool {
+	for _, suffix := range manifestSkipSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tf":                       "resource \"null_resource\" \"a\" {}\n",
+		"modules/vpc/main.tf":           "",
+		".terraform/providers/p":        "binary",
+		".git/HEAD":                     "ref: refs/heads/main\n",
+		"terraform.tfstate":             "{\"secret\": true}",
+		"terraform.tfstate.backup":      "{}",
+		"modules/vpc/variables.tf.json": "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Manifest(dir)
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	want := []ManifestEntry{
+		{Path: "main.tf", SHA256: "5b5fb2a2980475fb2f62c598c6a2a5e9fd02e8bdada3fa785204c88561b8c8f8"},
+		{Path: "modules/vpc/main.tf", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{Path: "modules/vpc/variables.tf.json", SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected manifest:\n got %+v\nwant %+v", got, want)
+	}
+}
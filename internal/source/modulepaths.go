@@ -0,0 +1,149 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// localModuleSourceRe matches module source arguments that are local paths.
+// Terraform only treats sources starting with ./ or ../ as local, and
+// other blocks with a source argument (required_providers) never use them.
+var localModuleSourceRe = regexp.MustCompile(`(?m)^\s*source\s*=\s*"(\.\.?/[^"]*)"`)
+
+// CheckModulePaths verifies that workDir and every local module it
+// references, directly or through other local modules, resolve to paths
+// inside root once symlinks are followed. Terraform would otherwise read
+// configuration from outside the prepared source.
+func CheckModulePaths(root, workDir string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("resolving source root: %w", err)
+	}
+	if err := checkWithin(realRoot, workDir, "working directory"); err != nil {
+		return err
+	}
+
+	visited := map[string]bool{}
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil || visited[real] {
+			// A missing module directory is terraform's error to report.
+			return nil
+		}
+		visited[real] = true
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+		if err != nil {
+			return err
+		}
+		jsonFiles, err := filepath.Glob(filepath.Join(dir, "*.tf.json"))
+		if err != nil {
+			return err
+		}
+		for _, file := range append(files, jsonFiles...) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", file, err)
+			}
+			var sources []string
+			if strings.HasSuffix(file, ".json") {
+				sources = jsonModuleSources(data)
+			} else {
+				for _, m := range localModuleSourceRe.FindAllStringSubmatch(string(data), -1) {
+					sources = append(sources, m[1])
+				}
+			}
+			for _, src := range sources {
+				moduleDir := filepath.Join(dir, src)
+				rel, _ := filepath.Rel(root, file)
+				if err := checkWithin(realRoot, moduleDir, fmt.Sprintf("module source %q in %s", src, rel)); err != nil {
+					return err
+				}
+				if err := visit(moduleDir); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return visit(workDir)
+}
+
+// jsonModuleSources returns the local module sources in a .tf.json file.
+// A file that does not parse is terraform's error to report.
+func jsonModuleSources(data []byte) []string {
+	var doc struct {
+		Module json.RawMessage `json:"module"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Module == nil {
+		return nil
+	}
+	var blocks interface{}
+	if err := json.Unmarshal(doc.Module, &blocks); err != nil {
+		return nil
+	}
+
+	// Blocks may be an object keyed by module name, or arrays of those,
+	// so collect every source argument found at any depth.
+	var sources []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if src, ok := child.(string); ok && k == "source" {
+					if strings.HasPrefix(src, "./") || strings.HasPrefix(src, "../") {
+						sources = append(sources, src)
+					}
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(blocks)
+	return sources
+}
+
+// resolvePath follows symlinks in path. When path does not exist, the
+// longest prefix that does is resolved and the rest appended, so a
+// missing module under a symlinked root is compared like an existing one.
+func resolvePath(path string) string {
+	path, _ = filepath.Abs(path)
+	var rest []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{real}, rest...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// checkWithin returns a KindModuleEscape error if path, after following
+// symlinks, is not realRoot or below it.
+func checkWithin(realRoot, path, what string) error {
+	real := resolvePath(path)
+	rel, err := filepath.Rel(realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &Error{
+			Kind: KindModuleEscape,
+			Err:  fmt.Errorf("%s resolves to %s, outside the source root", what, real),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+// writeModule writes main.tf in dir calling a module at source.
+func writeModule(t *testing.T, dir, source string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tf := "module \"m\" {\n  source = \"" + source + "\"\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte(tf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckModulePaths(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "repo")
+	outside := filepath.Join(base, "outside")
+	if err := os.MkdirAll(outside, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("within root", func(t *testing.T) {
+		workDir := filepath.Join(root, "envs", "prod")
+		writeModule(t, workDir, "../../modules/vpc")
+		writeModule(t, filepath.Join(root, "modules", "vpc"), "./subnets")
+		if err := CheckModulePaths(root, workDir); err != nil {
+			t.Errorf("expected modules within the root to pass, got %v", err)
+		}
+	})
+
+	t.Run("parent escape", func(t *testing.T) {
+		workDir := filepath.Join(root, "escape")
+		writeModule(t, workDir, "../../outside")
+		err := CheckModulePaths(root, workDir)
+		if ErrorKindOf(err) != KindModuleEscape {
+			t.Errorf("expected %s for ../../outside, got %v", KindModuleEscape, err)
+		}
+	})
+
+	t.Run("nested escape", func(t *testing.T) {
+		workDir := filepath.Join(root, "nested")
+		writeModule(t, workDir, "./inner")
+		writeModule(t, filepath.Join(workDir, "inner"), "../../../outside")
+		if err := CheckModulePaths(root, workDir); ErrorKindOf(err) != KindModuleEscape {
+			t.Errorf("expected escape through a nested module to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("symlink escape", func(t *testing.T) {
+		workDir := filepath.Join(root, "linked")
+		writeModule(t, workDir, "./vendor")
+		if err := os.Symlink(outside, filepath.Join(workDir, "vendor")); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckModulePaths(root, workDir); ErrorKindOf(err) != KindModuleEscape {
+			t.Errorf("expected symlinked module outside the root to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("missing module under symlinked root", func(t *testing.T) {
+		link := filepath.Join(base, "link")
+		if err := os.Symlink(root, link); err != nil {
+			t.Fatal(err)
+		}
+		workDir := filepath.Join(link, "missing")
+		writeModule(t, workDir, "./not-downloaded/vpc")
+		if err := CheckModulePaths(link, workDir); err != nil {
+			t.Errorf("expected a missing module inside the root to pass, got %v", err)
+		}
+	})
+
+	t.Run("json escape", func(t *testing.T) {
+		workDir := filepath.Join(root, "json")
+		if err := os.MkdirAll(workDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		tf := `{"module": {"m": [{"source": "../../outside"}]}}`
+		if err := os.WriteFile(filepath.Join(workDir, "main.tf.json"), []byte(tf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckModulePaths(root, workDir); ErrorKindOf(err) != KindModuleEscape {
+			t.Errorf("expected escape in a .tf.json file to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestPrepareRejectsModuleEscape(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "repo")
+	writeModule(t, filepath.Join(root, "stack"), "../../outside")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	src := config.SourceConfig{Type: "local", LocalPath: root, WorkingDirectory: "stack"}
+	if _, err := Prepare(context.Background(), logger, src); ErrorKindOf(err) != KindModuleEscape {
+		t.Errorf("expected %s, got %v", KindModuleEscape, err)
+	}
+
+	src.AllowModuleEscape = true
+	if _, err := Prepare(context.Background(), logger, src); err != nil {
+		t.Errorf("expected AllowModuleEscape to skip the check, got %v", err)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/butlerdotdev/butler-runner/internal/config"
 )
@@ -97,10 +100,19 @@ func writeGenericBackend(f *os.File, backendType string, cfg map[string]interfac
 	_, _ = fmt.Fprintf(f, "}\n")
 }
 
-// hclValue formats a Go value as an HCL literal. Strings are quoted,
-// booleans and numbers are written unquoted.
+// hclValue formats a Go value as an HCL literal for a backend attribute.
+// Strings are quoted, booleans and numbers are written unquoted, lists become
+// tuples and maps become objects, recursively.
 func hclValue(v interface{}) string {
+	return hclValueIndent(v, "    ")
+}
+
+// hclValueIndent formats v for an attribute whose line is indented by
+// indent, so multi-line objects line up with the enclosing block.
+func hclValueIndent(v interface{}, indent string) string {
 	switch val := v.(type) {
+	case nil:
+		return "null"
 	case bool:
 		return fmt.Sprintf("%t", val)
 	case float64:
@@ -109,10 +121,80 @@ func hclValue(v interface{}) string {
 		if val == float64(int64(val)) {
 			return fmt.Sprintf("%d", int64(val))
 		}
-		return fmt.Sprintf("%g", val)
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
 	case string:
-		return fmt.Sprintf("%q", val)
+		return hclString(val)
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			items[i] = hclValueIndent(item, indent)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		if len(val) == 0 {
+			return "{}"
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		inner := indent + "  "
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s = %s\n", inner, hclKey(k), hclValueIndent(val[k], inner))
+		}
+		b.WriteString(indent + "}")
+		return b.String()
 	default:
-		return fmt.Sprintf("%q", fmt.Sprintf("%v", val))
+		return hclString(fmt.Sprintf("%v", val))
+	}
+}
+
+// hclIdentRe matches object keys that may be written without quotes.
+var hclIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// hclKey formats an object key, quoting it unless it is a valid identifier.
+func hclKey(k string) string {
+	if hclIdentRe.MatchString(k) {
+		return k
+	}
+	return hclString(k)
+}
+
+// hclString quotes s as an HCL string literal. Unlike Go's %q it only uses
+// escapes HCL understands, and it escapes "${" and "%{" so the value is not
+// read as a template.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
 	}
+	b.WriteByte('"')
+	return b.String()
 }
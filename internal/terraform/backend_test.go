@@ -0,0 +1,93 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/butlerdotdev/butler-runner/internal/config"
+)
+
+func TestHCLValue(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"bool", true, "true"},
+		{"integer", float64(3), "3"},
+		{"float", 1.5, "1.5"},
+		{"nil", nil, "null"},
+		{"string", "state/prod.tfstate", `"state/prod.tfstate"`},
+		{"quotes and backslashes", `C:\tf "prod"`, `"C:\\tf \"prod\""`},
+		{"control characters", "a\nb\tc\x01", `"a\nb\tc\u0001"`},
+		{"template sequences", "${var.x} %{if}", `"$${var.x} %%{if}"`},
+		{"empty list", []interface{}{}, "[]"},
+		{"list", []interface{}{float64(409), float64(429), "x"}, `[409, 429, "x"]`},
+		{"empty map", map[string]interface{}{}, "{}"},
+		{
+			"map",
+			map[string]interface{}{"team": "platform", "app.kubernetes.io/name": "butler"},
+			"{\n      \"app.kubernetes.io/name\" = \"butler\"\n      team = \"platform\"\n    }",
+		},
+		{
+			"nested",
+			map[string]interface{}{
+				"labels": map[string]interface{}{"env": "prod"},
+				"codes":  []interface{}{float64(500), float64(502)},
+			},
+			"{\n      codes = [500, 502]\n      labels = {\n        env = \"prod\"\n      }\n    }",
+		},
+		{
+			"list of maps",
+			[]interface{}{map[string]interface{}{"a": true}},
+			"[{\n      a = true\n    }]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hclValue(tt.in); got != tt.want {
+				t.Errorf("hclValue(%#v)\ngot:  %s\nwant: %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGenericBackendNestedValues(t *testing.T) {
+	workDir := t.TempDir()
+	err := WriteBackendOverride(workDir, &config.StateBackendConfig{
+		Type: "kubernetes",
+		Config: map[string]interface{}{
+			"secret_suffix": "vpc",
+			"labels":        map[string]interface{}{"team": "platform"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteBackendOverride: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workDir, "backend.tf"))
+	if err != nil {
+		t.Fatalf("reading backend.tf: %v", err)
+	}
+	want := `terraform {
+  backend "kubernetes" {
+    labels = {
+      team = "platform"
+    }
+    secret_suffix = "vpc"
+  }
+}
+`
+	if got := string(data); got != want {
+		t.Errorf("unexpected backend.tf:\n%s", got)
+	}
+	if strings.Contains(string(data), "map[") {
+		t.Error("backend.tf contains a Go-formatted map")
+	}
+}
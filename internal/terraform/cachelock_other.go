@@ -0,0 +1,18 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !unix
+
+package terraform
+
+import "os"
+
+// Advisory file locks are not implemented on this platform, so downloads
+// are not serialized across processes.
+func tryLockFile(*os.File, bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
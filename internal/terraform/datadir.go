@@ -0,0 +1,126 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DataDirParts are the entries of a terraform data dir that can be cleaned
+// between runs: installed modules, installed providers, the saved backend
+// configuration, and the selected workspace.
+var DataDirParts = map[string]string{
+	"modules":   "modules",
+	"providers": "providers",
+	"backend":   "terraform.tfstate",
+	"workspace": "environment",
+}
+
+// dataDirLockSuffix names the lock a run holds on its data dir, beside it.
+const dataDirLockSuffix = ".lock"
+
+// SetDataDir points terraform at a persistent data dir (TF_DATA_DIR) under
+// dir, shared by runs of the same module: key identifies the module, and
+// each key gets a subdirectory of its own. Before each init the named parts
+// of it (see DataDirParts) are removed, so stale metadata such as old
+// modules can be dropped while providers are kept. The saved backend
+// configuration is always removed, since it may hold credentials and name
+// another backend. An empty dir uses terraform's default .terraform in the
+// working directory; a relative dir is resolved against it. Runs must hold
+// Lock while using it.
+func (e *Executor) SetDataDir(dir, key string, clean []string) error {
+	for _, part := range clean {
+		if _, ok := DataDirParts[part]; !ok {
+			names := make([]string, 0, len(DataDirParts))
+			for name := range DataDirParts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown data dir part %q (supported: %s)", part, strings.Join(names, ", "))
+		}
+	}
+	if dir == "" && len(clean) > 0 {
+		return fmt.Errorf("cleaning the data dir requires a data dir")
+	}
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(e.workingDir, dir)
+		}
+		sum := sha256.Sum256([]byte(key))
+		dir = filepath.Join(dir, hex.EncodeToString(sum[:8]))
+	}
+	e.dataDir = dir
+	e.dataDirClean = clean
+	return nil
+}
+
+// Lock takes the locks a run holds on directories shared with other runs,
+// waiting for them to be free: the data dir, exclusively, and the plugin
+// cache, shared (see cacheLockFile). A plugin cache low on disk is pruned
+// first. The returned function removes the saved backend configuration
+// and releases the locks.
+func (e *Executor) Lock(ctx context.Context) (func(), error) {
+	unlockData := func() {}
+	if e.dataDir != "" {
+		if err := os.MkdirAll(e.dataDir, 0o700); err != nil {
+			return nil, fmt.Errorf("creating data dir: %w", err)
+		}
+		unlock, err := lockCache(ctx, e.logger, e.dataDir+dataDirLockSuffix)
+		if err != nil {
+			return nil, err
+		}
+		unlockData = func() {
+			if err := os.Remove(filepath.Join(e.dataDir, DataDirParts["backend"])); err != nil && !os.IsNotExist(err) {
+				e.logger.Warn("removing saved backend configuration", "error", err)
+			}
+			unlock()
+		}
+	}
+	unlockCache, err := e.lockPluginCache(ctx)
+	if err != nil {
+		unlockData()
+		return nil, err
+	}
+	return func() {
+		unlockCache()
+		unlockData()
+	}, nil
+}
+
+// terraformDataDir returns the data dir terraform uses: the configured one,
+// or .terraform in the working directory.
+func (e *Executor) terraformDataDir() string {
+	if e.dataDir != "" {
+		return e.dataDir
+	}
+	return filepath.Join(e.workingDir, ".terraform")
+}
+
+// cleanDataDir removes the configured parts of the data dir, and always
+// the saved backend configuration.
+func (e *Executor) cleanDataDir() error {
+	if e.dataDir == "" {
+		return nil
+	}
+	parts := e.dataDirClean
+	if !slices.Contains(parts, "backend") {
+		parts = append([]string{"backend"}, parts...)
+	}
+	for _, part := range parts {
+		path := filepath.Join(e.dataDir, DataDirParts[part])
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("cleaning data dir %s: %w", part, err)
+		}
+		e.logger.Info("cleaned terraform data dir", "part", part, "path", path)
+	}
+	return nil
+}
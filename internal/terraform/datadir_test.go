@@ -0,0 +1,126 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitCleansSelectedDataDirParts(t *testing.T) {
+	envLog := filepath.Join(t.TempDir(), "env.log")
+	tfPath, _ := fakeTerraform(t, `echo "$TF_DATA_DIR" > `+envLog)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SetDataDir(t.TempDir(), "module-a", []string{"modules", "workspace"}); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	dataDir := e.dataDir
+
+	for _, dir := range []string{"modules/vpc", "providers/registry.terraform.io/hashicorp/aws"} {
+		if err := os.MkdirAll(filepath.Join(dataDir, dir), 0o755); err != nil {
+			t.Fatalf("creating %s: %v", dir, err)
+		}
+	}
+	for _, file := range []string{"terraform.tfstate", "environment"} {
+		if err := os.WriteFile(filepath.Join(dataDir, file), []byte("{}"), 0o600); err != nil {
+			t.Fatalf("writing %s: %v", file, err)
+		}
+	}
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	// The backend configuration is removed even when not selected.
+	for _, removed := range []string{"modules", "environment", "terraform.tfstate"} {
+		if _, err := os.Stat(filepath.Join(dataDir, removed)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be cleaned, got %v", removed, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "providers/registry.terraform.io/hashicorp/aws")); err != nil {
+		t.Errorf("expected providers to be preserved: %v", err)
+	}
+	got, err := os.ReadFile(envLog)
+	if err != nil {
+		t.Fatalf("reading env log: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != dataDir {
+		t.Errorf("expected TF_DATA_DIR=%s, got %q", dataDir, got)
+	}
+}
+
+func TestDataDirPerModule(t *testing.T) {
+	base := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	dirs := map[string]string{}
+	for _, key := range []string{"module-a", "module-b", "module-a"} {
+		e := NewExecutor("terraform", t.TempDir(), logger)
+		if err := e.SetDataDir(base, key, nil); err != nil {
+			t.Fatalf("SetDataDir failed: %v", err)
+		}
+		if filepath.Dir(e.dataDir) != base {
+			t.Errorf("expected data dir under %s, got %s", base, e.dataDir)
+		}
+		if prev, ok := dirs[key]; ok && prev != e.dataDir {
+			t.Errorf("expected %s to reuse %s, got %s", key, prev, e.dataDir)
+		}
+		dirs[key] = e.dataDir
+	}
+	if dirs["module-a"] == dirs["module-b"] {
+		t.Errorf("expected modules to get separate data dirs, both got %s", dirs["module-a"])
+	}
+}
+
+func TestLockDataDir(t *testing.T) {
+	base := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	first := NewExecutor("terraform", t.TempDir(), logger)
+	second := NewExecutor("terraform", t.TempDir(), logger)
+	for _, e := range []*Executor{first, second} {
+		if err := e.SetDataDir(base, "module-a", nil); err != nil {
+			t.Fatalf("SetDataDir failed: %v", err)
+		}
+	}
+
+	release, err := first.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	backend := filepath.Join(first.dataDir, "terraform.tfstate")
+	if err := os.WriteFile(backend, []byte("{}"), 0o600); err != nil {
+		t.Fatalf("writing backend config: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := second.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the second run to wait for the lock, got %v", err)
+	}
+
+	release()
+	if _, err := os.Stat(backend); !os.IsNotExist(err) {
+		t.Errorf("expected backend config to be removed on release, got %v", err)
+	}
+	release, err = second.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("Lock after release failed: %v", err)
+	}
+	release()
+}
+
+func TestSetDataDirRejectsUnknownPart(t *testing.T) {
+	e := NewExecutor("terraform", t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SetDataDir(t.TempDir(), "module-a", []string{"plugins"}); err == nil || !strings.Contains(err.Error(), "supported: backend, modules, providers, workspace") {
+		t.Errorf("expected unknown part error, got %v", err)
+	}
+	if err := e.SetDataDir("", "module-a", []string{"modules"}); err == nil {
+		t.Error("expected error cleaning without a data dir")
+	}
+}
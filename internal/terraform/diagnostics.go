@@ -0,0 +1,340 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a single error or warning from terraform's -json output.
+type Diagnostic struct {
+	Severity string   `json:"severity"` // "error" or "warning"
+	Summary  string   `json:"summary"`
+	Detail   string   `json:"detail"`
+	Range    *Range   `json:"range,omitempty"`   // source location, if any
+	Snippet  *Snippet `json:"snippet,omitempty"` // source context, if any
+}
+
+// Snippet describes the source a diagnostic refers to.
+type Snippet struct {
+	// Context names the enclosing block, e.g. `output "public_ip"`.
+	Context string `json:"context"`
+}
+
+// Range is the source span a diagnostic refers to.
+type Range struct {
+	Filename string `json:"filename"`
+	Start    Pos    `json:"start"`
+	End      Pos    `json:"end"`
+}
+
+// Pos is a 1-based line and column in a source file.
+type Pos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// parseDiagnostics extracts diagnostics from terraform -json output. It
+// accepts both the single-object form emitted by `validate -json` and the
+// newline-delimited message stream emitted by plan/apply with -json.
+func parseDiagnostics(data []byte) []Diagnostic {
+	var validate struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(data, &validate); err == nil && validate.Diagnostics != nil {
+		return validate.Diagnostics
+	}
+
+	var diags []Diagnostic
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Type       string      `json:"type"`
+			Diagnostic *Diagnostic `json:"diagnostic"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Type == "diagnostic" && msg.Diagnostic != nil {
+			diags = append(diags, *msg.Diagnostic)
+		}
+	}
+	return diags
+}
+
+// countSeverity returns how many diagnostics have the given severity.
+func countSeverity(diags []Diagnostic, severity string) int {
+	n := 0
+	for _, d := range diags {
+		if d.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// warningRe and errorRe match the first line of a warning or error block
+// in terraform's human-readable output, e.g. "│ Warning: Argument is
+// deprecated".
+var (
+	warningRe = regexp.MustCompile(`^[│|]?\s*Warning: (.+)$`)
+	errorRe   = regexp.MustCompile(`^[│|]?\s*Error: (.+)$`)
+)
+
+// sourceContextRe matches the source context line of a diagnostic block,
+// e.g. `on outputs.tf line 3, in output "public_ip":`.
+var sourceContextRe = regexp.MustCompile(`^\s*on (.+) line (\d+)(?:, in (.+))?:$`)
+
+// parseTextWarnings extracts warnings from terraform's human-readable
+// output. The detail is the block's explanation, without source context.
+func parseTextWarnings(output string) []Diagnostic {
+	return parseTextBlocks(output, warningRe, "warning")
+}
+
+// parseTextErrors extracts errors from terraform's human-readable output.
+func parseTextErrors(output string) []Diagnostic {
+	return parseTextBlocks(output, errorRe, "error")
+}
+
+// parseTextBlocks extracts the diagnostic blocks whose first line matches
+// re, giving them severity and the source location of their first "on
+// FILE line N" context line. With -no-color terraform prints blocks without
+// the │ and ╵ box: the summary line is followed by indented source context
+// and then the explanation, each a paragraph of its own. The detail is the
+// first unindented paragraph, so the output that follows the block is not
+// swallowed. Boxed blocks end at ╵.
+func parseTextBlocks(output string, re *regexp.Regexp, severity string) []Diagnostic {
+	var diags []Diagnostic
+	var current *Diagnostic
+	var detail []string
+	boxed := false
+
+	finish := func() {
+		if current != nil {
+			current.Detail = strings.TrimSpace(strings.Join(detail, "\n"))
+			diags = append(diags, *current)
+		}
+		current, detail = nil, nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := re.FindStringSubmatch(line); m != nil {
+			finish()
+			current = &Diagnostic{Severity: severity, Summary: strings.TrimSpace(m[1])}
+			boxed = strings.HasPrefix(line, "│")
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if m := sourceContextRe.FindStringSubmatch(strings.TrimPrefix(line, "│")); m != nil && current.Range == nil {
+			// Human-readable output gives the line but not the columns.
+			n, _ := strconv.Atoi(m[2])
+			current.Range = &Range{Filename: m[1], Start: Pos{Line: n}, End: Pos{Line: n}}
+			if m[3] != "" {
+				current.Snippet = &Snippet{Context: m[3]}
+			}
+		}
+		if boxed {
+			if strings.HasPrefix(line, "╵") {
+				finish()
+				continue
+			}
+			detail = append(detail, strings.TrimSpace(strings.TrimPrefix(line, "│")))
+			continue
+		}
+		switch {
+		case strings.TrimSpace(line) == "":
+			if len(detail) > 0 {
+				finish()
+			}
+		case len(detail) == 0 && strings.HasPrefix(line, "  "):
+			// Source context such as "  on main.tf line 12".
+		default:
+			detail = append(detail, strings.TrimSpace(line))
+		}
+	}
+	finish()
+	return diags
+}
+
+// FilterWarnings drops warnings whose summary contains any of the suppress
+// patterns (case-insensitive). Errors are never suppressed.
+func FilterWarnings(diags []Diagnostic, suppress []string) []Diagnostic {
+	var kept []Diagnostic
+	for _, d := range diags {
+		if d.Severity == "warning" && matchesAny(d.Summary, suppress) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// ErrStrictWarnings is returned when strict warnings are enabled and the
+// plan checked before apply or destroy has unsuppressed warnings.
+var ErrStrictWarnings = errors.New("plan has warnings with strict warnings enabled")
+
+// SetStrictWarnings makes apply and destroy fail with ErrStrictWarnings,
+// before changing anything, if their plan has warnings not matched by
+// suppress (see FilterWarnings). A saved plan is not re-checked: its
+// warnings were reported when it was created.
+func (e *Executor) SetStrictWarnings(strict bool, suppress []string) {
+	e.strictWarnings = strict
+	e.suppressWarnings = suppress
+}
+
+// checkStrictWarnings returns ErrStrictWarnings if strict warnings are
+// enabled and the output of a plan has unsuppressed warnings.
+func (e *Executor) checkStrictWarnings(output string) error {
+	if !e.strictWarnings {
+		return nil
+	}
+	warnings := FilterWarnings(parseTextWarnings(output), e.suppressWarnings)
+	if len(warnings) == 0 {
+		return nil
+	}
+	summaries := make([]string, len(warnings))
+	for i, w := range warnings {
+		summaries[i] = w.Summary
+	}
+	return fmt.Errorf("%w: %s", ErrStrictWarnings, strings.Join(summaries, "; "))
+}
+
+func matchesAny(s string, patterns []string) bool {
+	lower := strings.ToLower(s)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(lower, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// removalRe matches warning text that announces a feature will stop working
+// in a future release.
+var removalRe = regexp.MustCompile(`(?i)(will be removed|removed in a future|no longer (be )?supported|deprecated)`)
+
+// versionRe matches version numbers such as "v1.10" or "2.0.0".
+var versionRe = regexp.MustCompile(`\bv?(\d+\.\d+(?:\.\d+)?)\b`)
+
+// UpgradeBlockers returns the warnings in diags that announce a removal
+// which would break the configuration on targetVersion. Warnings that name
+// no version are assumed to affect any future release. An empty
+// targetVersion matches every removal warning.
+func UpgradeBlockers(diags []Diagnostic, targetVersion string) []Diagnostic {
+	var blockers []Diagnostic
+	for _, d := range diags {
+		if d.Severity != "warning" {
+			continue
+		}
+		text := d.Summary + "\n" + d.Detail
+		if !removalRe.MatchString(text) {
+			continue
+		}
+		if targetVersion != "" {
+			if v := earliestVersion(text); v != "" && compareVersions(v, targetVersion) > 0 {
+				continue
+			}
+		}
+		blockers = append(blockers, d)
+	}
+	return blockers
+}
+
+// earliestVersion returns the lowest version number mentioned in text.
+func earliestVersion(text string) string {
+	var earliest string
+	for _, m := range versionRe.FindAllStringSubmatch(text, -1) {
+		if earliest == "" || compareVersions(m[1], earliest) < 0 {
+			earliest = m[1]
+		}
+	}
+	return earliest
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0, or 1.
+// Missing components are treated as zero.
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// credentialErrorRe matches init errors caused by missing or rejected
+// credentials. With -input=false terraform fails instead of prompting, and
+// the raw errors differ per backend. Providers do not authenticate during
+// init, so these come from the state backend.
+var credentialErrorRe = regexp.MustCompile(`(?i)no valid credential sources|NoCredentialProviders|` +
+	`InvalidAccessKeyId|SignatureDoesNotMatch|ExpiredToken|InvalidClientTokenId|` +
+	`could not find default credentials|Error building ARM Config|AuthorizationFailed|AuthenticationFailed`)
+
+// deniedErrorRe matches generic HTTP auth failures, which only count as
+// backend failures alongside backendContextRe: a private module download can
+// fail the same way.
+var (
+	deniedErrorRe    = regexp.MustCompile(`(?i)\b(401|403)\b|Unauthorized|Forbidden|AccessDenied|Access Denied`)
+	backendContextRe = regexp.MustCompile(`(?i)backend|existing workspaces|loading state|refreshing state|remote state`)
+)
+
+// backendNameRe extracts the backend named in errors such as
+// "error configuring S3 Backend".
+var backendNameRe = regexp.MustCompile(`(?i)\b(s3|gcs|azurerm|http|consul|kubernetes|oss|cos|pg|remote|cloud) backend\b`)
+
+// BackendAuthError reports that terraform init could not authenticate to
+// the state backend.
+type BackendAuthError struct {
+	Backend string // backend type, e.g. "s3"; empty if unknown
+	Err     error
+}
+
+func (e *BackendAuthError) Error() string {
+	backend := e.Backend
+	if backend == "" {
+		backend = "state"
+	}
+	return fmt.Sprintf("%s backend authentication failed: %v", backend, e.Err)
+}
+
+func (e *BackendAuthError) Unwrap() error { return e.Err }
+
+// classifyInitError wraps err in a BackendAuthError when the init output
+// shows a backend credential failure. backendType is the configured backend,
+// if known.
+func classifyInitError(output, backendType string, err error) error {
+	matched := credentialErrorRe.MatchString(output) ||
+		(deniedErrorRe.MatchString(output) && backendContextRe.MatchString(output))
+	if !matched {
+		return err
+	}
+	if backendType == "" {
+		if m := backendNameRe.FindStringSubmatch(output); m != nil {
+			backendType = strings.ToLower(m[1])
+		}
+	}
+	return &BackendAuthError{Backend: backendType, Err: err}
+}
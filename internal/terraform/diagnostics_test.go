@@ -0,0 +1,282 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeBlockers(t *testing.T) {
+	validateJSON := []byte(`{
+		"valid": true,
+		"diagnostics": [
+			{"severity": "warning", "summary": "Deprecated attribute", "detail": "The attribute \"acl\" is deprecated and will be removed in v1.10."},
+			{"severity": "warning", "summary": "Argument is deprecated", "detail": "Use the replacement block instead; this will be removed in version 2.0."},
+			{"severity": "warning", "summary": "Value for undeclared variable", "detail": "The root module does not declare a variable named \"foo\"."},
+			{"severity": "warning", "summary": "Quoted references are no longer supported", "detail": "Remove the quotes."},
+			{"severity": "error", "summary": "Unsupported argument", "detail": "An argument named \"bar\" is not expected here; it will be removed."}
+		]
+	}`)
+
+	diags := parseDiagnostics(validateJSON)
+	if len(diags) != 5 {
+		t.Fatalf("expected 5 diagnostics, got %d", len(diags))
+	}
+
+	all := UpgradeBlockers(diags, "")
+	if len(all) != 3 {
+		t.Errorf("expected 3 removal warnings without a target, got %d", len(all))
+	}
+
+	// Targeting 1.11 excludes the removal scheduled for 2.0.
+	blockers := UpgradeBlockers(diags, "1.11")
+	if len(blockers) != 2 {
+		t.Fatalf("expected 2 blockers for target 1.11, got %d: %+v", len(blockers), blockers)
+	}
+	if blockers[0].Summary != "Deprecated attribute" {
+		t.Errorf("unexpected first blocker: %q", blockers[0].Summary)
+	}
+	if blockers[1].Summary != "Quoted references are no longer supported" {
+		t.Errorf("unexpected second blocker: %q", blockers[1].Summary)
+	}
+}
+
+func TestParseDiagnosticsStream(t *testing.T) {
+	stream := []byte(`{"@level":"info","type":"version","terraform":"1.9.8"}
+{"@level":"warn","type":"diagnostic","diagnostic":{"severity":"warning","summary":"Deprecated","detail":"will be removed"}}
+{"@level":"info","type":"change_summary","changes":{"add":0}}
+`)
+
+	diags := parseDiagnostics(stream)
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d", len(diags))
+	}
+	if diags[0].Severity != "warning" || diags[0].Summary != "Deprecated" {
+		t.Errorf("unexpected diagnostic: %+v", diags[0])
+	}
+}
+
+func TestParseDiagnosticsRange(t *testing.T) {
+	validate := []byte(`{"valid":false,"diagnostics":[
+		{"severity":"error","summary":"Unsupported argument","detail":"An argument named \"nme\" is not expected here.",
+		 "range":{"filename":"main.tf","start":{"line":12,"column":3,"byte":210},"end":{"line":12,"column":6,"byte":213}}},
+		{"severity":"warning","summary":"No range"}
+	]}`)
+	stream := []byte(`{"@level":"error","type":"diagnostic","diagnostic":{"severity":"error","summary":"Invalid reference","range":{"filename":"modules/vpc/outputs.tf","start":{"line":4,"column":11,"byte":60},"end":{"line":4,"column":24,"byte":73}}}}
+`)
+
+	want := Range{Filename: "main.tf", Start: Pos{Line: 12, Column: 3}, End: Pos{Line: 12, Column: 6}}
+	diags := parseDiagnostics(validate)
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(diags))
+	}
+	if diags[0].Range == nil || *diags[0].Range != want {
+		t.Errorf("expected range %+v, got %+v", want, diags[0].Range)
+	}
+	if diags[1].Range != nil {
+		t.Errorf("expected no range, got %+v", diags[1].Range)
+	}
+
+	want = Range{Filename: "modules/vpc/outputs.tf", Start: Pos{Line: 4, Column: 11}, End: Pos{Line: 4, Column: 24}}
+	diags = parseDiagnostics(stream)
+	if len(diags) != 1 || diags[0].Range == nil || *diags[0].Range != want {
+		t.Errorf("expected one diagnostic with range %+v, got %+v", want, diags)
+	}
+}
+
+func TestParseTextErrorsRange(t *testing.T) {
+	plain := `
+Error: Unsupported argument
+
+  on main.tf line 12, in resource "aws_instance" "web":
+  12:   nme = "web"
+
+An argument named "nme" is not expected here.
+`
+	boxed := `╷
+│ Error: Reference to undeclared resource
+│
+│   on modules/vpc/outputs.tf line 4:
+│    4:   value = aws_vpc.man.id
+│
+│ A managed resource "aws_vpc" "man" has not been declared in module.vpc.
+╵
+`
+	unlocated := `
+Error: No configuration files
+
+Apply requires configuration to be present.
+`
+
+	for _, tc := range []struct {
+		name   string
+		output string
+		want   *Range
+	}{
+		{"plain", plain, &Range{Filename: "main.tf", Start: Pos{Line: 12}, End: Pos{Line: 12}}},
+		{"boxed", boxed, &Range{Filename: "modules/vpc/outputs.tf", Start: Pos{Line: 4}, End: Pos{Line: 4}}},
+		{"no source", unlocated, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diags := parseTextErrors(tc.output)
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 error, got %+v", diags)
+			}
+			if got := diags[0].Range; (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Errorf("expected range %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterWarnings(t *testing.T) {
+	output := `
+Terraform will perform the following actions:
+
+Warning: Argument is deprecated
+
+  with aws_s3_bucket.logs,
+  on main.tf line 12, in resource "aws_s3_bucket" "logs":
+  12:   acl = "private"
+
+Use the aws_s3_bucket_acl resource instead
+
+Warning: Value for undeclared variable
+
+The root module does not declare a variable named "extra".
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+`
+
+	warnings := parseTextWarnings(output)
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %d: %+v", len(warnings), warnings)
+	}
+	if warnings[0].Detail != "Use the aws_s3_bucket_acl resource instead" {
+		t.Errorf("expected detail without source context, got %q", warnings[0].Detail)
+	}
+	if warnings[1].Detail != `The root module does not declare a variable named "extra".` {
+		t.Errorf("expected detail to end at the block, got %q", warnings[1].Detail)
+	}
+
+	kept := FilterWarnings(warnings, []string{"argument is DEPRECATED"})
+	if len(kept) != 1 {
+		t.Fatalf("expected 1 warning after suppression, got %d", len(kept))
+	}
+	if kept[0].Summary != "Value for undeclared variable" {
+		t.Errorf("expected unsuppressed warning to pass through, got %q", kept[0].Summary)
+	}
+}
+
+func TestParseBoxedWarnings(t *testing.T) {
+	output := `╷
+│ Warning: Value for undeclared variable
+│
+│ The root module does not declare a variable named "extra".
+╵
+
+Plan: 1 to add, 0 to change, 0 to destroy.
+`
+
+	warnings := parseTextWarnings(output)
+	if len(warnings) != 1 || warnings[0].Detail != `The root module does not declare a variable named "extra".` {
+		t.Errorf("unexpected warnings: %+v", warnings)
+	}
+}
+
+func TestStrictWarningsCheckedBeforeApply(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/butler-guard.tfplan"; printf 'Warning: Argument is deprecated\n\nUse another argument\n' ;;
+  output) echo '{}' ;;
+esac`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetStrictWarnings(true, nil)
+
+	_, err := e.Run(context.Background(), "apply")
+	if !errors.Is(err, ErrStrictWarnings) {
+		t.Fatalf("expected ErrStrictWarnings, got %v", err)
+	}
+	for _, call := range readArgs(t, argsLog) {
+		if strings.HasPrefix(call, "apply") {
+			t.Errorf("apply ran despite plan warnings: %q", call)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workDir, guardPlanFile)); !os.IsNotExist(err) {
+		t.Errorf("expected guard plan to be removed, got %v", err)
+	}
+
+	e.SetStrictWarnings(true, []string{"deprecated"})
+	if _, err := e.Run(context.Background(), "apply"); err != nil {
+		t.Fatalf("expected suppressed warning to allow apply, got %v", err)
+	}
+}
+
+func TestClassifyInitError(t *testing.T) {
+	tests := []struct {
+		name        string
+		stderr      string
+		backendType string
+		wantAuth    bool
+		wantBackend string
+	}{
+		{
+			name: "s3 missing credentials",
+			stderr: `Error: error configuring S3 Backend: no valid credential sources for S3 Backend found.
+
+Please see https://www.terraform.io/docs/language/settings/backends/s3.html
+for more information about providing credentials.`,
+			wantAuth:    true,
+			wantBackend: "s3",
+		},
+		{
+			name:        "gcs default credentials",
+			stderr:      "Error: storage.NewClient() failed: dialing: google: could not find default credentials.",
+			backendType: "gcs",
+			wantAuth:    true,
+			wantBackend: "gcs",
+		},
+		{
+			name:        "http backend forbidden",
+			stderr:      "Error: Failed to get existing workspaces: HTTP remote state endpoint returned 403 Forbidden",
+			backendType: "http",
+			wantAuth:    true,
+			wantBackend: "http",
+		},
+		{
+			name:   "private module download forbidden",
+			stderr: `Error: Failed to download module: could not download "https://example.com/vpc.zip": 403 Forbidden`,
+		},
+		{
+			name:   "unrelated init failure",
+			stderr: "Error: Unsupported Terraform Core version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := errors.New("exit status 1")
+			err := classifyInitError(tt.stderr, tt.backendType, base)
+
+			var authErr *BackendAuthError
+			if got := errors.As(err, &authErr); got != tt.wantAuth {
+				t.Fatalf("expected backend auth = %v, got %v (%v)", tt.wantAuth, got, err)
+			}
+			if !errors.Is(err, base) {
+				t.Error("classified error no longer wraps the original")
+			}
+			if tt.wantAuth && authErr.Backend != tt.wantBackend {
+				t.Errorf("expected backend %q, got %q", tt.wantBackend, authErr.Backend)
+			}
+		})
+	}
+}
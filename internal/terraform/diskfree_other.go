@@ -0,0 +1,14 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !(linux || darwin || freebsd)
+
+package terraform
+
+import "errors"
+
+// Free space is not measured on this platform, so the plugin cache is never
+// pruned.
+func diskFree(string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultActionDurations are rough per-resource durations used when no
+// historical timing is known for a resource type.
+var defaultActionDurations = map[string]time.Duration{
+	"create": 30 * time.Second,
+	"update": 15 * time.Second,
+	"delete": 20 * time.Second,
+}
+
+// applyParallelism mirrors terraform's default -parallelism.
+const applyParallelism = 10
+
+// EstimateApplyDuration estimates how long applying planJSON will take.
+// typeTimings optionally gives historical create durations per resource type
+// (e.g. from Butler), which replace the defaults for that type; updates and
+// deletes are scaled from it by the default ratios. Replacements cost a
+// create plus a delete. Work is spread over terraform's parallelism, but the
+// estimate is never shorter than the slowest single resource.
+func EstimateApplyDuration(planJSON []byte, typeTimings map[string]time.Duration) (time.Duration, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Type   string `json:"type"`
+			Change struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return 0, fmt.Errorf("decoding plan: %w", err)
+	}
+
+	var total, slowest time.Duration
+	for _, rc := range plan.ResourceChanges {
+		var d time.Duration
+		switch strings.Join(rc.Change.Actions, ",") {
+		case "create":
+			d = actionDuration("create", rc.Type, typeTimings)
+		case "update":
+			d = actionDuration("update", rc.Type, typeTimings)
+		case "delete":
+			d = actionDuration("delete", rc.Type, typeTimings)
+		case "delete,create", "create,delete":
+			d = actionDuration("create", rc.Type, typeTimings) + actionDuration("delete", rc.Type, typeTimings)
+		}
+		total += d
+		slowest = max(slowest, d)
+	}
+
+	return max(total/applyParallelism, slowest), nil
+}
+
+// actionDuration returns the expected duration of action on a resource of
+// the given type.
+func actionDuration(action, resourceType string, typeTimings map[string]time.Duration) time.Duration {
+	d := defaultActionDurations[action]
+	if create, ok := typeTimings[resourceType]; ok && create > 0 {
+		return time.Duration(float64(create) * float64(d) / float64(defaultActionDurations["create"]))
+	}
+	return d
+}
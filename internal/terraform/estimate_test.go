@@ -0,0 +1,46 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateApplyDuration(t *testing.T) {
+	plan := []byte(`{
+		"resource_changes": [
+			{"type": "aws_instance", "change": {"actions": ["create"]}},
+			{"type": "aws_instance", "change": {"actions": ["create"]}},
+			{"type": "aws_security_group", "change": {"actions": ["update"]}},
+			{"type": "aws_db_instance", "change": {"actions": ["delete", "create"]}},
+			{"type": "aws_ami", "change": {"actions": ["read"]}},
+			{"type": "aws_vpc", "change": {"actions": ["no-op"]}}
+		]
+	}`)
+
+	// Defaults: 30+30+15+(30+20) = 125s of work over 10 workers, but the
+	// replacement alone takes 50s.
+	got, err := EstimateApplyDuration(plan, nil)
+	if err != nil {
+		t.Fatalf("EstimateApplyDuration: %v", err)
+	}
+	if got != 50*time.Second {
+		t.Errorf("expected 50s, got %s", got)
+	}
+
+	// A slow database (10m to create) dominates the estimate.
+	got, err = EstimateApplyDuration(plan, map[string]time.Duration{"aws_db_instance": 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("EstimateApplyDuration: %v", err)
+	}
+	if want := 10*time.Minute + 400*time.Second; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	got, err = EstimateApplyDuration([]byte(`{"resource_changes": []}`), nil)
+	if err != nil || got != 0 {
+		t.Errorf("expected zero estimate for an empty plan, got %s, %v", got, err)
+	}
+}
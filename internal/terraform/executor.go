@@ -6,7 +6,9 @@ package terraform
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -14,8 +16,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/butlerdotdev/butler-runner/internal/config"
 )
@@ -26,9 +30,19 @@ type RunResult struct {
 	ResourcesToAdd     int
 	ResourcesToChange  int
 	ResourcesToDestroy int
+	ResourcesToReplace int // destroyed and recreated; not counted in add/destroy
+	ResourcesToRead    int // data sources read during the plan
 	PlanJSON           string
 	PlanText           string
+	PlanDigest         string // digest of the saved plan file, see PlanDigest
+	LikelySchemaNoise  bool   // changes look like provider upgrade noise
+	CountMismatch      string // how the plan summary disagrees with the JSON counts
 	Outputs            map[string]interface{}
+	LockFile           string     // .terraform.lock.hcl contents after providers-lock
+	Providers          []Provider // providers installed by init
+	Warnings           []Diagnostic
+	Diagnostics        []Diagnostic // all diagnostics from validate and test
+	TestResults        []TestResult // run blocks completed by test
 }
 
 // Executor runs terraform commands in a working directory.
@@ -38,14 +52,134 @@ type Executor struct {
 	logger     *slog.Logger
 	stdout     io.Writer // optional: tee stdout to this writer
 	stderr     io.Writer // optional: tee stderr to this writer
+	console    io.Writer // where init prints its progress; default os.Stdout
+	planFile   string    // optional: saved plan shared between plan and apply
+	platforms  []string  // platforms to hash in providers-lock, e.g. "linux_amd64"
+	targets    []string  // resource addresses passed as -target
+	varFiles   []string  // extra files passed as -var-file
+	tfvarsFile string    // generated tfvars, passed after varFiles
+
+	destroyPlan        bool   // plan creates a destroy plan for a later destroy run
+	approvedPlanDigest string // apply refuses a saved plan with another digest
+
+	workspace      string // selected workspace; empty = "default"
+	isolate        bool   // run terraform in its own user and mount namespace
+	isolationRoot  string // chroot for isolated runs
+	exitWithParent bool   // interrupt terraform if the runner dies (Linux)
+
+	gracePeriod time.Duration // time between SIGINT and SIGKILL on cancellation
+	initOpts    InitOptions
+	timeout     time.Duration // per-invocation limit; 0 = none
+	lockTimeout time.Duration // -lock-timeout for state-locking commands; 0 = fail fast
+	commands    []string      // command lines run so far, secrets masked
+
+	protectedTypes  []string // resource types that must not be destroyed
+	allowedDestroys []string // addresses exempt from protectedTypes
+	backendType     string   // configured state backend, for error reports
+
+	largePlanThreshold int  // total changes above which a plan is flagged; 0 = off
+	blockLargePlans    bool // fail plans over largePlanThreshold instead of warning
+
+	detectSchemaNoise bool // flag plans that look like provider upgrade noise
+
+	strictWarnings   bool     // apply and destroy fail on plan warnings
+	suppressWarnings []string // warning summaries strictWarnings ignores
+
+	dataDir      string   // TF_DATA_DIR; empty = .terraform in workingDir
+	dataDirClean []string // DataDirParts removed before init
+
+	initUpgraded bool // init was retried with -upgrade, see InitUpgraded
+
+	lockFileChanged bool       // init modified the lock file
+	lockedProviders []Provider // lock file contents after a change
+}
+
+// ErrTimeout is returned when a terraform invocation exceeds the timeout set
+// with SetTimeout.
+var ErrTimeout = errors.New("terraform timed out")
+
+// InitOptions tunes how terraform init downloads providers and modules.
+// Terraform has no direct download concurrency setting; sharing a plugin
+// cache and bounding registry timeouts and retries are the knobs it offers
+// for limiting network use.
+type InitOptions struct {
+	PluginCacheDir   string        // TF_PLUGIN_CACHE_DIR; created if missing
+	RegistryTimeout  time.Duration // TF_REGISTRY_CLIENT_TIMEOUT; 0 = terraform default
+	DiscoveryRetries int           // TF_REGISTRY_DISCOVERY_RETRY; 0 = terraform default
+	// PluginCacheMinFree evicts least-recently-used providers from the
+	// plugin cache in Lock while its filesystem has fewer free bytes;
+	// 0 = never prune.
+	PluginCacheMinFree int64
+	// SkipBackend runs init with -backend=false, for operations that only
+	// read the configuration and should not need backend credentials.
+	SkipBackend bool
+	// StallTimeout fails init with ErrDownloadStalled if it produces no
+	// output for this long while downloading a provider or module; 0 = wait
+	// for the overall timeout.
+	StallTimeout time.Duration
+	// UpgradeOnLockMismatch retries a failed init once with -upgrade when
+	// the lock file has no checksums matching this platform. Off by default
+	// since -upgrade may select newer provider versions.
+	UpgradeOnLockMismatch bool
+}
+
+// NeedsBackend reports whether operation reads or writes state and so
+// needs terraform init to configure the backend.
+func NeedsBackend(operation string) bool {
+	return operation != "validate"
 }
 
+// DefaultGracePeriod is how long terraform gets to stop cleanly after being
+// interrupted before it is killed.
+const DefaultGracePeriod = 30 * time.Second
+
 // NewExecutor creates a new terraform executor.
 func NewExecutor(tfPath, workingDir string, logger *slog.Logger) *Executor {
 	return &Executor{
 		tfPath:     tfPath,
 		workingDir: workingDir,
 		logger:     logger,
+		console:    os.Stdout,
+
+		gracePeriod: DefaultGracePeriod,
+	}
+}
+
+// SetConsole sets where terraform init prints its progress, which is
+// os.Stdout by default.
+func (e *Executor) SetConsole(w io.Writer) {
+	e.console = w
+}
+
+// SetInitOptions sets the download settings applied to terraform init.
+func (e *Executor) SetInitOptions(opts InitOptions) {
+	e.initOpts = opts
+}
+
+// SetBackendType records the configured state backend type so init
+// failures can name it.
+func (e *Executor) SetBackendType(backendType string) {
+	e.backendType = backendType
+}
+
+// SetTimeout limits how long each terraform invocation may run. Zero
+// disables the limit.
+func (e *Executor) SetTimeout(d time.Duration) {
+	e.timeout = d
+}
+
+// SetLockTimeout makes state-locking commands wait up to d for a state lock
+// held by another run, instead of failing immediately. Zero keeps
+// terraform's fail-fast behavior.
+func (e *Executor) SetLockTimeout(d time.Duration) {
+	e.lockTimeout = d
+}
+
+// SetGracePeriod sets how long terraform may take to stop after SIGINT when
+// the run is cancelled. Non-positive values keep the default.
+func (e *Executor) SetGracePeriod(d time.Duration) {
+	if d > 0 {
+		e.gracePeriod = d
 	}
 }
 
@@ -55,11 +189,162 @@ func (e *Executor) SetLogWriters(stdout, stderr io.Writer) {
 	e.stderr = stderr
 }
 
+// SetPlanFile enables saved-plan mode: plan writes its plan to path and
+// apply executes exactly that plan instead of re-planning. A relative path
+// is resolved against the working directory.
+func (e *Executor) SetPlanFile(path string) {
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(e.workingDir, path)
+	}
+	e.planFile = path
+}
+
+// SetDestroyPlan makes plan create a destroy plan (plan -destroy). With a
+// plan file set, a later destroy run then applies exactly that plan.
+func (e *Executor) SetDestroyPlan(destroy bool) {
+	e.destroyPlan = destroy
+}
+
+// SetLockPlatforms sets the platforms the providers-lock operation records
+// hashes for. When empty, terraform locks only the current platform.
+func (e *Executor) SetLockPlatforms(platforms []string) {
+	e.platforms = platforms
+}
+
+// SetVarFiles adds -var-file arguments to plan, apply, destroy, and
+// refresh. Relative paths are resolved against the working directory. It
+// fails, listing every missing file, if any does not exist.
+func (e *Executor) SetVarFiles(files []string) error {
+	var valid, missing []string
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(e.workingDir, f)
+		}
+		if info, err := os.Stat(f); err != nil || info.IsDir() {
+			missing = append(missing, f)
+			continue
+		}
+		valid = append(valid, f)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("var files not found: %s", strings.Join(missing, ", "))
+	}
+	e.varFiles = valid
+	return nil
+}
+
+// SetTfvarsFile records the generated tfvars file, which is passed after
+// any var files so its values take precedence.
+func (e *Executor) SetTfvarsFile(path string) {
+	e.tfvarsFile = path
+}
+
+// SetTargets limits plan, apply, and destroy to the given resource
+// addresses. Empty entries are skipped; entries that look like flags are
+// rejected so a target cannot inject arbitrary arguments.
+func (e *Executor) SetTargets(targets []string) error {
+	var valid []string
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if strings.HasPrefix(t, "-") {
+			return fmt.Errorf("invalid target %q: must be a resource address", t)
+		}
+		valid = append(valid, t)
+	}
+	e.targets = valid
+	return nil
+}
+
+// SetExitWithParent makes the kernel interrupt terraform if the runner
+// process dies, rather than leaving it running orphaned. Linux only; a
+// no-op elsewhere.
+func (e *Executor) SetExitWithParent(enabled bool) {
+	e.exitWithParent = enabled
+}
+
+// SetIsolation runs terraform in a new user and mount namespace, chrooted
+// into root, so mounts it makes are invisible to the host and it only sees
+// what the operator placed in root. The operator must prepare root with the
+// working directory, plugin cache, and CA certificates bind-mounted at their
+// host paths; a namespace alone restricts nothing, so root is required.
+// Isolation is only supported on Linux.
+func (e *Executor) SetIsolation(enabled bool, root string) error {
+	if !enabled {
+		e.isolate = false
+		e.isolationRoot = ""
+		return nil
+	}
+	if !isolationSupported {
+		return fmt.Errorf("process isolation is only supported on Linux")
+	}
+	if root == "" {
+		return fmt.Errorf("process isolation requires an isolation root")
+	}
+	if _, err := os.Stat(filepath.Join(root, e.workingDir)); err != nil {
+		return fmt.Errorf("working directory is not mounted in isolation root %s: %w", root, err)
+	}
+	e.isolate = true
+	e.isolationRoot = root
+	return nil
+}
+
 // Init runs terraform init.
 func (e *Executor) Init(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, e.tfPath, "init", "-input=false", "-no-color")
-	cmd.Dir = e.workingDir
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	return e.checkTimeout(ctx, e.init(ctx))
+}
+
+func (e *Executor) init(ctx context.Context) error {
+	if err := e.cleanDataDir(); err != nil {
+		return err
+	}
+	env, err := e.initEnv()
+	if err != nil {
+		return err
+	}
+	args := []string{"init", "-input=false", "-no-color"}
+	if e.initOpts.SkipBackend {
+		args = append(args, "-backend=false")
+	}
+
+	lockBefore := lockFileDigest(e.workingDir)
+	output, err := e.runInit(ctx, args, env)
+	if err != nil && e.initOpts.UpgradeOnLockMismatch && lockMismatchRe.MatchString(output) {
+		e.logger.Warn("lock file checksums do not match this platform, retrying init with -upgrade")
+		e.initUpgraded = true
+		_, err = e.runInit(ctx, append(args, "-upgrade"), env)
+	}
+	if err != nil {
+		return err
+	}
+	e.recordLockFileChange(lockBefore)
+	if dir := e.initOpts.PluginCacheDir; dir != "" {
+		markPluginCacheUse(filepath.Join(e.terraformDataDir(), "providers"), dir)
+	}
+	return nil
+}
+
+// runInit runs one terraform init with args and the extra env, returning
+// its stderr for classification.
+func (e *Executor) runInit(ctx context.Context, args, env []string) (string, error) {
+	var stall *lineWatcher
+	if t := e.initOpts.StallTimeout; t > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		stall = newStallWatcher(t, func() { cancel(ErrDownloadStalled) })
+		defer stall.Stop()
+	}
+	cmd := e.newCmd(ctx, args...)
+	cmd.Env = append(cmd.Env, env...)
 
 	var stderr bytes.Buffer
 	if e.stderr != nil {
@@ -67,50 +352,212 @@ func (e *Executor) Init(ctx context.Context) error {
 	} else {
 		cmd.Stderr = &stderr
 	}
+	stdout := []io.Writer{e.console}
 	if e.stdout != nil {
-		cmd.Stdout = io.MultiWriter(os.Stdout, e.stdout)
-	} else {
-		cmd.Stdout = os.Stdout
+		stdout = append(stdout, e.stdout)
+	}
+	if stall != nil {
+		stdout = append(stdout, stall)
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(context.Cause(ctx), ErrDownloadStalled) {
+			return stderr.String(), fmt.Errorf("terraform init: %w: no progress for %s", ErrDownloadStalled, e.initOpts.StallTimeout)
+		}
+		return stderr.String(), classifyInitError(stderr.String(), e.backendType,
+			fmt.Errorf("terraform init failed: %s: %w", stderr.String(), err))
+	}
+	return stderr.String(), nil
+}
+
+// initEnv returns the environment variables carrying the init options,
+// creating the plugin cache directory terraform expects to exist.
+func (e *Executor) initEnv() ([]string, error) {
+	var env []string
+	if dir := e.initOpts.PluginCacheDir; dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating plugin cache dir: %w", err)
+		}
+		env = append(env, "TF_PLUGIN_CACHE_DIR="+dir)
+	}
+	if t := e.initOpts.RegistryTimeout; t > 0 {
+		secs := int((t + time.Second - 1) / time.Second)
+		env = append(env, "TF_REGISTRY_CLIENT_TIMEOUT="+strconv.Itoa(secs))
+	}
+	if n := e.initOpts.DiscoveryRetries; n > 0 {
+		env = append(env, "TF_REGISTRY_DISCOVERY_RETRY="+strconv.Itoa(n))
+	}
+	return env, nil
+}
+
+// PullState writes the current workspace's raw state to path, readable only
+// by the owner. The caller is responsible for securely deleting it.
+func (e *Executor) PullState(ctx context.Context, path string) error {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating state file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var stderr bytes.Buffer
+	cmd := e.newCmd(ctx, "state", "pull")
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return e.checkTimeout(ctx, fmt.Errorf("terraform state pull: %s: %w", stderr.String(), err))
 	}
+	return f.Close()
+}
+
+// StateResourceCount returns the number of managed resources tracked in the
+// current workspace's state, as listed by terraform state list. An empty or
+// missing state counts as zero.
+func (e *Executor) StateResourceCount(ctx context.Context) (int, error) {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
 
+	var stdout, stderr bytes.Buffer
+	cmd := e.newCmd(ctx, "state", "list")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("terraform init failed: %s: %w", stderr.String(), err)
+		if strings.Contains(stderr.String(), "No state file was found") {
+			return 0, nil
+		}
+		return 0, e.checkTimeout(ctx, fmt.Errorf("terraform state list: %s: %w", stderr.String(), err))
+	}
+	return countStateResources(stdout.String()), nil
+}
+
+// countStateResources counts the managed resource addresses in state list
+// output. Data sources are read on every run, not managed, so they are not
+// counted.
+func countStateResources(output string) int {
+	n := 0
+	for _, line := range strings.Split(output, "\n") {
+		if addr := strings.TrimSpace(line); addr != "" && !isDataAddress(addr) {
+			n++
+		}
+	}
+	return n
+}
+
+// isDataAddress reports whether a resource address, such as
+// module.vpc["a.b"].data.aws_ami.ubuntu, names a data source.
+func isDataAddress(addr string) bool {
+	for strings.HasPrefix(addr, "module.") {
+		// Skip the module call, whose instance key may contain dots.
+		rest := strings.TrimPrefix(addr, "module.")
+		depth := 0
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			switch r {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+			return r == '.' && depth == 0
+		})
+		if end < 0 {
+			return false
+		}
+		addr = rest[end+1:]
 	}
+	return strings.HasPrefix(addr, "data.")
+}
+
+// SelectWorkspace switches to the named workspace, creating it if it does
+// not exist yet. It must be called after Init. The executor only records the
+// workspace once terraform has switched to it.
+func (e *Executor) SelectWorkspace(ctx context.Context, name string) error {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	return e.checkTimeout(ctx, e.selectWorkspace(ctx, name))
+}
+
+func (e *Executor) selectWorkspace(ctx context.Context, name string) error {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid workspace name %q", name)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := e.command(ctx, &stdout, &stderr, "workspace", "select", name).Run()
+	if err != nil {
+		if !strings.Contains(stderr.String()+stdout.String(), "doesn't exist") {
+			return fmt.Errorf("terraform workspace select %s: %s: %w", name, stderr.String(), err)
+		}
+		stdout.Reset()
+		stderr.Reset()
+		if err := e.command(ctx, &stdout, &stderr, "workspace", "new", name).Run(); err != nil {
+			return fmt.Errorf("terraform workspace new %s: %s: %w", name, stderr.String(), err)
+		}
+	}
+
+	e.workspace = name
 	return nil
 }
 
-// Run executes the given terraform operation (plan, apply, destroy).
+// Workspace returns the active workspace.
+func (e *Executor) Workspace() string {
+	if e.workspace == "" {
+		return "default"
+	}
+	return e.workspace
+}
+
+// Operations lists the operations supported by Run.
+var Operations = []string{"init", "plan", "apply", "destroy", "refresh", "validate", "test", "output", "providers-lock"}
+
+// Run executes the given terraform operation (see Operations).
 func (e *Executor) Run(ctx context.Context, operation string) (*RunResult, error) {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+	result, err := e.run(ctx, operation)
+	return result, e.checkTimeout(ctx, err)
+}
+
+func (e *Executor) run(ctx context.Context, operation string) (*RunResult, error) {
 	switch operation {
+	case "init":
+		return e.initOnly()
 	case "plan":
 		return e.plan(ctx)
 	case "apply":
 		return e.apply(ctx)
 	case "destroy":
 		return e.destroy(ctx)
+	case "refresh":
+		return e.refresh(ctx)
+	case "validate":
+		return e.validate(ctx)
+	case "test":
+		return e.test(ctx)
+	case "output":
+		return e.output(ctx)
+	case "providers-lock":
+		return e.providersLock(ctx)
 	default:
-		return nil, fmt.Errorf("unsupported operation: %s", operation)
+		return nil, fmt.Errorf("unsupported operation %q (supported: %s)", operation, strings.Join(Operations, ", "))
 	}
 }
 
 func (e *Executor) plan(ctx context.Context) (*RunResult, error) {
-	planFile := filepath.Join(e.workingDir, "tfplan")
+	planFile := e.planFile
+	if planFile == "" {
+		planFile = filepath.Join(e.workingDir, "tfplan")
+	}
 
-	cmd := exec.CommandContext(ctx, e.tfPath, "plan", "-input=false", "-no-color", "-out="+planFile)
-	cmd.Dir = e.workingDir
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+	args := e.planArgs(planFile)
+	if e.destroyPlan {
+		args = append(args, "-destroy")
+	}
 
 	var stdout, stderr bytes.Buffer
-	if e.stdout != nil {
-		cmd.Stdout = io.MultiWriter(&stdout, e.stdout)
-	} else {
-		cmd.Stdout = &stdout
-	}
-	if e.stderr != nil {
-		cmd.Stderr = io.MultiWriter(&stderr, e.stderr)
-	} else {
-		cmd.Stderr = &stderr
-	}
+	cmd := e.command(ctx, &stdout, &stderr, args...)
 
 	err := cmd.Run()
 	exitCode := 0
@@ -127,42 +574,65 @@ func (e *Executor) plan(ctx context.Context) (*RunResult, error) {
 	result := &RunResult{
 		ExitCode: exitCode,
 		PlanText: stdout.String(),
+		Warnings: parseTextWarnings(stdout.String() + stderr.String()),
 	}
 
 	// Get plan JSON
 	if _, statErr := os.Stat(planFile); statErr == nil {
-		showCmd := exec.CommandContext(ctx, e.tfPath, "show", "-json", planFile)
-		showCmd.Dir = e.workingDir
+		showCmd := e.newCmd(ctx, "show", "-json", planFile)
 		var showOut bytes.Buffer
 		showCmd.Stdout = &showOut
 		if showErr := showCmd.Run(); showErr == nil {
 			result.PlanJSON = showOut.String()
 			e.parseResourceCounts(result)
+			if mismatch := planCountMismatch(result.PlanText, result); mismatch != "" {
+				e.logger.Warn("plan resource counts disagree", "detail", mismatch)
+				result.CountMismatch = mismatch
+			}
+			result.Warnings = append(result.Warnings, e.protectionWarnings(result.PlanJSON)...)
+			e.checkSchemaNoise(result)
 		}
 	}
 
 	if err != nil {
 		return result, fmt.Errorf("terraform plan: %s: %w", stderr.String(), err)
 	}
+	if err := e.checkLargePlan(result, planFile); err != nil {
+		return result, err
+	}
+	if e.planFile != "" {
+		digest, err := PlanDigest(planFile)
+		if err != nil {
+			return result, fmt.Errorf("computing plan digest: %w", err)
+		}
+		result.PlanDigest = digest
+	}
 	return result, nil
 }
 
 func (e *Executor) apply(ctx context.Context) (*RunResult, error) {
-	cmd := exec.CommandContext(ctx, e.tfPath, "apply", "-input=false", "-no-color", "-auto-approve")
-	cmd.Dir = e.workingDir
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
-
-	var stdout, stderr bytes.Buffer
-	if e.stdout != nil {
-		cmd.Stdout = io.MultiWriter(&stdout, e.stdout)
-	} else {
-		cmd.Stdout = &stdout
+	planFile := e.planFile
+	if planFile != "" {
+		if _, err := os.Stat(planFile); err != nil {
+			return nil, fmt.Errorf("saved plan %s not found; run plan first: %w", planFile, err)
+		}
 	}
-	if e.stderr != nil {
-		cmd.Stderr = io.MultiWriter(&stderr, e.stderr)
-	} else {
-		cmd.Stderr = &stderr
+	if err := e.verifyPlanDigest(planFile); err != nil {
+		return &RunResult{ExitCode: 1}, err
 	}
+	if e.checksPlans() {
+		checked, err := e.guardPlan(ctx, planFile, false)
+		if err != nil {
+			return &RunResult{ExitCode: 1}, err
+		}
+		if checked != planFile {
+			defer func() { _ = os.Remove(checked) }()
+		}
+		planFile = checked
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, &stdout, &stderr, e.applyPlanArgs(planFile)...)
 
 	err := cmd.Run()
 	exitCode := 0
@@ -174,44 +644,60 @@ func (e *Executor) apply(ctx context.Context) (*RunResult, error) {
 
 	result := &RunResult{
 		ExitCode: exitCode,
+		Warnings: parseTextWarnings(stdout.String() + stderr.String()),
 	}
 	parseSummaryCounts(stdout.String(), result)
 
 	// Get outputs
-	outputCmd := exec.CommandContext(ctx, e.tfPath, "output", "-json")
-	outputCmd.Dir = e.workingDir
-	var outputBuf bytes.Buffer
-	outputCmd.Stdout = &outputBuf
-	if outputErr := outputCmd.Run(); outputErr == nil {
-		var outputs map[string]interface{}
-		if jsonErr := json.Unmarshal(outputBuf.Bytes(), &outputs); jsonErr == nil {
-			result.Outputs = outputs
-		}
+	if outputs, outputErr := e.collectOutputs(ctx); outputErr == nil {
+		result.Outputs = outputs
 	}
 
 	if err != nil {
+		if e.planFile != "" && strings.Contains(stderr.String(), "Saved plan is stale") {
+			return result, fmt.Errorf("saved plan %s is stale: state changed since it was created, re-run plan: %w", e.planFile, err)
+		}
+		if errs := parseTextErrors(stderr.String()); onlyOutputErrors(errs) {
+			result.Diagnostics = errs
+			if !summaryRe.MatchString(stdout.String()) {
+				parseProgressCounts(stdout.String(), result)
+			}
+			return result, fmt.Errorf("terraform apply: %w: %s", ErrOutputErrors, errs[0].Summary)
+		}
 		return result, fmt.Errorf("terraform apply: %s: %w", stderr.String(), err)
 	}
 	return result, nil
 }
 
+// destroy destroys the workspace's resources. In saved-plan mode it applies
+// the destroy plan written by an earlier plan run (see SetDestroyPlan), so
+// exactly the reviewed destruction happens; a saved plan that would create
+// or update anything is refused.
 func (e *Executor) destroy(ctx context.Context) (*RunResult, error) {
-	cmd := exec.CommandContext(ctx, e.tfPath, "destroy", "-input=false", "-no-color", "-auto-approve")
-	cmd.Dir = e.workingDir
-	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
-
-	var stdout, stderr bytes.Buffer
-	if e.stdout != nil {
-		cmd.Stdout = io.MultiWriter(&stdout, e.stdout)
-	} else {
-		cmd.Stdout = &stdout
+	args := e.destroyArgs()
+	if err := e.verifyPlanDigest(e.planFile); err != nil {
+		return &RunResult{ExitCode: 1}, err
 	}
-	if e.stderr != nil {
-		cmd.Stderr = io.MultiWriter(&stderr, e.stderr)
-	} else {
-		cmd.Stderr = &stderr
+	if e.planFile != "" {
+		if _, err := os.Stat(e.planFile); err != nil {
+			return nil, fmt.Errorf("saved destroy plan %s not found; run plan with a destroy plan first: %w", e.planFile, err)
+		}
+		if _, err := e.guardPlan(ctx, e.planFile, true); err != nil {
+			return &RunResult{ExitCode: 1}, err
+		}
+		args = e.applyPlanArgs(e.planFile)
+	} else if e.checksPlans() {
+		checked, err := e.guardPlan(ctx, "", true)
+		if err != nil {
+			return &RunResult{ExitCode: 1}, err
+		}
+		defer func() { _ = os.Remove(checked) }()
+		args = e.applyPlanArgs(checked)
 	}
 
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, &stdout, &stderr, args...)
+
 	err := cmd.Run()
 	exitCode := 0
 	if err != nil {
@@ -222,15 +708,430 @@ func (e *Executor) destroy(ctx context.Context) (*RunResult, error) {
 
 	result := &RunResult{
 		ExitCode: exitCode,
+		Warnings: parseTextWarnings(stdout.String() + stderr.String()),
 	}
 	parseSummaryCounts(stdout.String(), result)
 
 	if err != nil {
+		if e.planFile != "" && strings.Contains(stderr.String(), "Saved plan is stale") {
+			return result, fmt.Errorf("saved plan %s is stale: state changed since it was created, re-run plan: %w", e.planFile, err)
+		}
 		return result, fmt.Errorf("terraform destroy: %s: %w", stderr.String(), err)
 	}
 	return result, nil
 }
 
+// refresh updates state to match real infrastructure without changing it.
+// This is the modern equivalent of the deprecated `terraform refresh`.
+func (e *Executor) refresh(ctx context.Context) (*RunResult, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, &stdout, &stderr, e.refreshArgs()...)
+
+	err := cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	result := &RunResult{
+		ExitCode: exitCode,
+		Warnings: parseTextWarnings(stdout.String() + stderr.String()),
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("terraform refresh: %s: %w", stderr.String(), err)
+	}
+	return result, nil
+}
+
+// validate checks the configuration and reports its diagnostics. The run
+// fails if any diagnostic is an error.
+func (e *Executor) validate(ctx context.Context) (*RunResult, error) {
+	diags, exitCode, err := e.validateDiagnostics(ctx)
+	if err != nil {
+		return &RunResult{ExitCode: exitCode}, err
+	}
+
+	result := &RunResult{ExitCode: exitCode, Diagnostics: diags}
+	for _, d := range diags {
+		if d.Severity == "warning" {
+			result.Warnings = append(result.Warnings, d)
+		}
+	}
+
+	if errs := countSeverity(diags, "error"); errs > 0 {
+		if result.ExitCode == 0 {
+			result.ExitCode = 1
+		}
+		return result, fmt.Errorf("terraform validate: configuration has %d error(s)", errs)
+	}
+	return result, nil
+}
+
+// validateDiagnostics runs terraform validate -json and returns its
+// diagnostics along with the exit code.
+func (e *Executor) validateDiagnostics(ctx context.Context) ([]Diagnostic, int, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := e.newCmd(ctx, validateArgs()...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// validate exits non-zero when the config has errors but still prints
+	// its diagnostics, so only fail if nothing parseable came back.
+	err := cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		if stdout.Len() == 0 {
+			return nil, exitCode, fmt.Errorf("terraform validate: %s: %w", stderr.String(), err)
+		}
+	}
+	return parseDiagnostics(stdout.Bytes()), exitCode, nil
+}
+
+// output collects the current root module outputs without changing anything.
+func (e *Executor) output(ctx context.Context) (*RunResult, error) {
+	outputs, err := e.collectOutputs(ctx)
+	if err != nil {
+		return &RunResult{ExitCode: 1}, err
+	}
+	return &RunResult{Outputs: outputs}, nil
+}
+
+// collectOutputs runs terraform output -json.
+func (e *Executor) collectOutputs(ctx context.Context) (map[string]interface{}, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := e.newCmd(ctx, "output", "-json")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("terraform output: %s: %w", stderr.String(), err)
+	}
+
+	var outputs map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
+		return nil, fmt.Errorf("decoding outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+func (e *Executor) refreshArgs() []string {
+	args := []string{"apply", "-refresh-only", "-input=false", "-no-color", "-auto-approve"}
+	args = append(args, e.lockArgs()...)
+	args = append(args, e.varFileArgs()...)
+	return append(args, e.targetArgs()...)
+}
+
+func validateArgs() []string {
+	return []string{"validate", "-json", "-no-color"}
+}
+
+func (e *Executor) planArgs(planFile string) []string {
+	args := []string{"plan", "-input=false", "-no-color", "-out=" + planFile}
+	args = append(args, e.lockArgs()...)
+	args = append(args, e.varFileArgs()...)
+	return append(args, e.targetArgs()...)
+}
+
+func (e *Executor) applyArgs() []string {
+	return e.applyPlanArgs(e.planFile)
+}
+
+// applyPlanArgs builds apply arguments for planFile, or for a fresh plan
+// when planFile is empty.
+func (e *Executor) applyPlanArgs(planFile string) []string {
+	args := []string{"apply", "-input=false", "-no-color", "-auto-approve"}
+	args = append(args, e.lockArgs()...)
+	if planFile != "" {
+		// A saved plan already carries its variables and targets;
+		// terraform rejects -var-file and -target alongside a plan file.
+		return append(args, planFile)
+	}
+	args = append(args, e.varFileArgs()...)
+	return append(args, e.targetArgs()...)
+}
+
+func (e *Executor) destroyArgs() []string {
+	args := []string{"destroy", "-input=false", "-no-color", "-auto-approve"}
+	args = append(args, e.lockArgs()...)
+	args = append(args, e.varFileArgs()...)
+	return append(args, e.targetArgs()...)
+}
+
+// lockArgs returns the -lock-timeout flag, if a lock timeout is set.
+func (e *Executor) lockArgs() []string {
+	if e.lockTimeout <= 0 {
+		return nil
+	}
+	secs := int((e.lockTimeout + time.Second - 1) / time.Second)
+	return []string{"-lock-timeout=" + strconv.Itoa(secs) + "s"}
+}
+
+// varFileArgs expands the configured var files into -var-file flags.
+// Command-line var files override terraform.tfvars.json, so the generated
+// tfvars file is repeated last to keep the Butler-supplied values winning.
+func (e *Executor) varFileArgs() []string {
+	if len(e.varFiles) == 0 {
+		return nil
+	}
+	args := make([]string, 0, len(e.varFiles)+1)
+	for _, f := range e.varFiles {
+		args = append(args, "-var-file="+f)
+	}
+	if e.tfvarsFile != "" {
+		args = append(args, "-var-file="+e.tfvarsFile)
+	}
+	return args
+}
+
+// targetArgs expands the configured targets into -target flags.
+func (e *Executor) targetArgs() []string {
+	args := make([]string, 0, len(e.targets))
+	for _, t := range e.targets {
+		args = append(args, "-target="+t)
+	}
+	return args
+}
+
+func (e *Executor) providersLock(ctx context.Context) (*RunResult, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, &stdout, &stderr, providersLockArgs(e.platforms)...)
+
+	err := cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		return &RunResult{ExitCode: exitCode}, fmt.Errorf("terraform providers lock: %s: %w", stderr.String(), err)
+	}
+
+	lockFile, err := os.ReadFile(filepath.Join(e.workingDir, lockFileName))
+	if err != nil {
+		return &RunResult{ExitCode: exitCode}, fmt.Errorf("reading lock file: %w", err)
+	}
+	return &RunResult{ExitCode: exitCode, LockFile: string(lockFile)}, nil
+}
+
+// initOnly reports the providers installed by Init, which has already run;
+// it runs no further terraform commands.
+func (e *Executor) initOnly() (*RunResult, error) {
+	lockFile, err := os.ReadFile(filepath.Join(e.workingDir, lockFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return &RunResult{ExitCode: 1}, fmt.Errorf("reading lock file: %w", err)
+	}
+	return &RunResult{Providers: lockedProviders(string(lockFile))}, nil
+}
+
+// Provider is a provider recorded in the dependency lock file.
+type Provider struct {
+	Address string // e.g. "registry.terraform.io/hashicorp/aws"
+	Version string
+	Hashes  []string // e.g. "h1:..."; only set for lock file changes
+}
+
+var (
+	lockProviderRe = regexp.MustCompile(`(?m)^provider "([^"]+)" \{`)
+	lockVersionRe  = regexp.MustCompile(`(?m)^\s*version\s*=\s*"([^"]+)"`)
+	lockHashesRe   = regexp.MustCompile(`(?s)hashes\s*=\s*\[(.*?)\]`)
+	lockHashRe     = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// lockedProviders lists the providers in a .terraform.lock.hcl file.
+func lockedProviders(lockFile string) []Provider {
+	return parseLockFile(lockFile, false)
+}
+
+// parseLockFile lists the providers in a .terraform.lock.hcl file, with
+// their recorded hashes if withHashes is set.
+func parseLockFile(lockFile string, withHashes bool) []Provider {
+	var providers []Provider
+	matches := lockProviderRe.FindAllStringSubmatchIndex(lockFile, -1)
+	for i, m := range matches {
+		end := len(lockFile)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		p := Provider{Address: lockFile[m[2]:m[3]]}
+		block := lockFile[m[1]:end]
+		if v := lockVersionRe.FindStringSubmatch(block); v != nil {
+			p.Version = v[1]
+		}
+		if h := lockHashesRe.FindStringSubmatch(block); withHashes && h != nil {
+			for _, hash := range lockHashRe.FindAllStringSubmatch(h[1], -1) {
+				p.Hashes = append(p.Hashes, hash[1])
+			}
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// providersLockArgs builds the providers lock arguments, with one -platform
+// flag per platform.
+func providersLockArgs(platforms []string) []string {
+	args := []string{"providers", "lock"}
+	for _, p := range platforms {
+		if p == "" {
+			continue
+		}
+		args = append(args, "-platform="+p)
+	}
+	return args
+}
+
+// Commands returns the terraform command lines run so far, in order, with
+// secret-bearing argument values masked.
+func (e *Executor) Commands() []string {
+	return append([]string(nil), e.commands...)
+}
+
+// maskedFlags are flags whose values may carry secrets.
+var maskedFlags = []string{"-var", "-backend-config"}
+
+// commandLine renders a command for reporting, masking the values of
+// secret-bearing flags, whether given as -var=value or as -var value. For
+// -var, the variable name is kept.
+func commandLine(name string, args []string) string {
+	parts := []string{name}
+	for i, arg := range args {
+		if i > 0 && slices.Contains(maskedFlags, args[i-1]) {
+			parts = append(parts, maskValue(args[i-1], arg))
+			continue
+		}
+		parts = append(parts, maskArg(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func maskArg(arg string) string {
+	for _, flag := range maskedFlags {
+		if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+			return flag + "=" + maskValue(flag, value)
+		}
+	}
+	return arg
+}
+
+// maskValue masks the value given to flag.
+func maskValue(flag, value string) string {
+	// -backend-config=path.hcl names a file; only key=value pairs are secret.
+	key, _, isPair := strings.Cut(value, "=")
+	if !isPair {
+		if flag == "-var" {
+			return "***"
+		}
+		return value
+	}
+	return key + "=***"
+}
+
+// withTimeout bounds a single terraform invocation by the configured
+// timeout. Cancellation of the parent context still applies, so whichever
+// comes first stops terraform.
+func (e *Executor) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, e.timeout)
+}
+
+// checkTimeout marks err as a timeout if ctx's deadline expired while the
+// command ran, so callers can tell it apart from a plain non-zero exit.
+func (e *Executor) checkTimeout(ctx context.Context, err error) error {
+	if err != nil && e.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %w", ErrTimeout, e.timeout, err)
+	}
+	return err
+}
+
+// tfCmd is a terraform command. Its Run stops the pending kill of the
+// process group once terraform has been waited for, since the group ID may
+// then be reused.
+type tfCmd struct {
+	*exec.Cmd
+	killTimer *time.Timer // set by Cancel
+}
+
+// Run starts the command and waits for it to finish.
+func (c *tfCmd) Run() error {
+	err := c.Cmd.Run()
+	// Wait does not return until Cancel has, so killTimer is settled.
+	if c.killTimer != nil {
+		c.killTimer.Stop()
+	}
+	return err
+}
+
+// newCmd builds a terraform command that runs in the working directory with
+// the automation environment and any configured process isolation.
+func (e *Executor) newCmd(ctx context.Context, args ...string) *tfCmd {
+	e.commands = append(e.commands, commandLine(filepath.Base(e.tfPath), args))
+	cmd := &tfCmd{Cmd: exec.CommandContext(ctx, e.tfPath, args...)}
+	cmd.Dir = e.workingDir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1")
+	if e.dataDir != "" {
+		cmd.Env = append(cmd.Env, "TF_DATA_DIR="+e.dataDir)
+	}
+	if e.isolate {
+		cmd.SysProcAttr = isolationAttr(e.isolationRoot)
+	}
+	if e.exitWithParent {
+		cmd.SysProcAttr = withParentDeathSignal(cmd.SysProcAttr)
+	}
+	cmd.SysProcAttr = withProcessGroup(cmd.SysProcAttr)
+	// On cancellation, interrupt terraform so it can finish the current
+	// resource and release the state lock; it is killed only if it is still
+	// running once the grace period has passed. Signals go to the whole
+	// process group so provider plugins are not left running.
+	cmd.Cancel = func() error {
+		e.logger.Info("interrupting terraform", "gracePeriod", e.gracePeriod)
+		if err := signalGroup(cmd.Process, os.Interrupt); err != nil {
+			// Interrupts are unsupported on some platforms.
+			return signalGroup(cmd.Process, os.Kill)
+		}
+		cmd.killTimer = time.AfterFunc(e.gracePeriod, func() { _ = signalGroup(cmd.Process, os.Kill) })
+		return nil
+	}
+	cmd.WaitDelay = e.gracePeriod
+	return cmd
+}
+
+// command builds a terraform command in the working directory. Output is
+// captured into stdout/stderr and teed to the configured log writers.
+func (e *Executor) command(ctx context.Context, stdout, stderr *bytes.Buffer, args ...string) *tfCmd {
+	cmd := e.newCmd(ctx, args...)
+	if e.stdout != nil {
+		cmd.Stdout = io.MultiWriter(stdout, e.stdout)
+	} else {
+		cmd.Stdout = stdout
+	}
+	if e.stderr != nil {
+		cmd.Stderr = io.MultiWriter(stderr, e.stderr)
+	} else {
+		cmd.Stderr = stderr
+	}
+	return cmd
+}
+
+// CheckUpgradeBlockers runs terraform validate -json and returns warnings
+// about features that will be removed by targetVersion (empty = any future
+// version).
+func (e *Executor) CheckUpgradeBlockers(ctx context.Context, targetVersion string) ([]Diagnostic, error) {
+	ctx, cancel := e.withTimeout(ctx)
+	defer cancel()
+
+	diags, _, err := e.validateDiagnostics(ctx)
+	if err != nil {
+		return nil, e.checkTimeout(ctx, err)
+	}
+	return UpgradeBlockers(diags, targetVersion), nil
+}
+
 func (e *Executor) parseResourceCounts(result *RunResult) {
 	if result.PlanJSON == "" {
 		return
@@ -247,16 +1148,17 @@ func (e *Executor) parseResourceCounts(result *RunResult) {
 	}
 	for _, rc := range plan.ResourceChanges {
 		actions := strings.Join(rc.Change.Actions, ",")
-		switch {
-		case actions == "create":
+		switch actions {
+		case "create":
 			result.ResourcesToAdd++
-		case actions == "update":
+		case "update":
 			result.ResourcesToChange++
-		case actions == "delete":
-			result.ResourcesToDestroy++
-		case strings.Contains(actions, "create") && strings.Contains(actions, "delete"):
+		case "delete":
 			result.ResourcesToDestroy++
-			result.ResourcesToAdd++
+		case "delete,create", "create,delete":
+			result.ResourcesToReplace++
+		case "read":
+			result.ResourcesToRead++
 		}
 	}
 }
@@ -285,17 +1187,72 @@ func WriteTfvars(workDir string, variables map[string]config.Variable, upstreamO
 	return path, nil
 }
 
+// Secure-delete overwrite patterns.
+const (
+	PatternZeros  = "zeros"
+	PatternRandom = "random"
+)
+
+// SecureDeleteOptions controls how SecureDeleteWith overwrites a file.
+type SecureDeleteOptions struct {
+	Passes  int    // number of overwrite passes; <= 0 means 1
+	Pattern string // PatternZeros (default) or PatternRandom
+}
+
+// ValidateSecureDeletePattern rejects patterns SecureDeleteWith does not
+// know, rather than silently overwriting with zeros. Empty means zeros.
+func ValidateSecureDeletePattern(pattern string) error {
+	switch pattern {
+	case "", PatternZeros, PatternRandom:
+		return nil
+	}
+	return fmt.Errorf("unknown secure-delete pattern %q (supported: %s, %s)", pattern, PatternZeros, PatternRandom)
+}
+
 // SecureDelete overwrites a file with zeros before deleting it.
 func SecureDelete(path string) {
+	SecureDeleteWith(path, SecureDeleteOptions{})
+}
+
+// SecureDeleteWith overwrites a file opts.Passes times with opts.Pattern
+// before deleting it. This is best-effort: on journaling, copy-on-write, and
+// flash storage the original blocks may survive an in-place overwrite.
+func SecureDeleteWith(path string, opts SecureDeleteOptions) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return
 	}
-	zeros := make([]byte, info.Size())
-	_ = os.WriteFile(path, zeros, 0o600)
+	passes := opts.Passes
+	if passes <= 0 {
+		passes = 1
+	}
+
+	if f, err := os.OpenFile(path, os.O_WRONLY, 0o600); err == nil {
+		for i := 0; i < passes; i++ {
+			if err := overwritePass(f, info.Size(), opts.Pattern); err != nil {
+				break
+			}
+		}
+		_ = f.Close()
+	}
 	_ = os.Remove(path)
 }
 
+// overwritePass writes size bytes of pattern from the start of f and syncs.
+// It is a variable so tests can observe individual passes.
+var overwritePass = func(f *os.File, size int64, pattern string) error {
+	buf := make([]byte, size)
+	if pattern == PatternRandom {
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+	}
+	if _, err := f.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
 // parseSummaryCounts extracts resource counts from terraform apply/destroy
 // summary lines such as:
 //
@@ -317,5 +1274,46 @@ func parseSummaryCounts(output string, result *RunResult) {
 	}
 }
 
+// planSummaryRe matches the summary line of terraform plan's text output,
+// e.g. "Plan: 1 to import, 2 to add, 0 to change, 1 to destroy.", capturing
+// the counts after the colon.
+var (
+	planSummaryRe = regexp.MustCompile(`(?m)^Plan: (.*)$`)
+	planCountRe   = regexp.MustCompile(`(\d+) to (add|change|destroy)`)
+)
+
+// planCountMismatch cross-checks the JSON-derived counts in result against
+// the plan's text summary. The text summary counts a replacement as both an
+// add and a destroy. It returns a description of any disagreement, or ""
+// if they agree or the text has no summary. The JSON counts stand either
+// way. The disagreement is not a terraform warning, so strict warnings do
+// not fail the run on it.
+func planCountMismatch(planText string, result *RunResult) string {
+	var add, change, destroy int
+	if m := planSummaryRe.FindStringSubmatch(planText); m != nil {
+		for _, c := range planCountRe.FindAllStringSubmatch(m[1], -1) {
+			n, _ := strconv.Atoi(c[1])
+			switch c[2] {
+			case "add":
+				add = n
+			case "change":
+				change = n
+			case "destroy":
+				destroy = n
+			}
+		}
+	} else if !strings.Contains(planText, "No changes.") {
+		return ""
+	}
+
+	jsonAdd := result.ResourcesToAdd + result.ResourcesToReplace
+	jsonDestroy := result.ResourcesToDestroy + result.ResourcesToReplace
+	if add == jsonAdd && change == result.ResourcesToChange && destroy == jsonDestroy {
+		return ""
+	}
+	return fmt.Sprintf("The plan output reports %d to add, %d to change, %d to destroy, but the plan JSON has %d to add, %d to change, %d to destroy (replacements counted as add and destroy). The plan JSON counts are reported.",
+		add, change, destroy, jsonAdd, result.ResourcesToChange, jsonDestroy)
+}
+
 // Variable is an alias for config.Variable.
 type Variable = config.Variable
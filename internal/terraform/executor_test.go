@@ -4,9 +4,15 @@
 package terraform
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestWriteTfvars(t *testing.T) {
@@ -66,6 +72,48 @@ func TestSecureDelete(t *testing.T) {
 	}
 }
 
+func TestSecureDeleteWithMultiplePasses(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "sensitive.json")
+
+	if err := os.WriteFile(path, []byte("secret data"), 0o600); err != nil {
+		t.Fatalf("writing test file: %v", err)
+	}
+
+	var patterns []string
+	orig := overwritePass
+	overwritePass = func(f *os.File, size int64, pattern string) error {
+		patterns = append(patterns, pattern)
+		return orig(f, size, pattern)
+	}
+	defer func() { overwritePass = orig }()
+
+	SecureDeleteWith(path, SecureDeleteOptions{Passes: 3, Pattern: PatternRandom})
+
+	if len(patterns) != 3 {
+		t.Errorf("expected 3 overwrite passes, got %d", len(patterns))
+	}
+	for _, p := range patterns {
+		if p != PatternRandom {
+			t.Errorf("expected pattern %q, got %q", PatternRandom, p)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected file to be deleted")
+	}
+}
+
+func TestValidateSecureDeletePattern(t *testing.T) {
+	for _, p := range []string{"", PatternZeros, PatternRandom} {
+		if err := ValidateSecureDeletePattern(p); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", p, err)
+		}
+	}
+	if err := ValidateSecureDeletePattern("ones"); err == nil {
+		t.Error("expected unknown pattern to be rejected")
+	}
+}
+
 func TestParseResourceCounts(t *testing.T) {
 	e := &Executor{}
 
@@ -76,20 +124,740 @@ func TestParseResourceCounts(t *testing.T) {
 				{"change": {"actions": ["create"]}},
 				{"change": {"actions": ["update"]}},
 				{"change": {"actions": ["delete"]}},
-				{"change": {"actions": ["delete", "create"]}}
+				{"change": {"actions": ["delete", "create"]}},
+				{"change": {"actions": ["create", "delete"]}},
+				{"change": {"actions": ["read"]}},
+				{"change": {"actions": ["read"]}},
+				{"change": {"actions": ["no-op"]}}
 			]
 		}`,
 	}
 
 	e.parseResourceCounts(result)
 
-	if result.ResourcesToAdd != 3 {
-		t.Errorf("expected 3 resources to add, got %d", result.ResourcesToAdd)
+	if result.ResourcesToAdd != 2 {
+		t.Errorf("expected 2 resources to add, got %d", result.ResourcesToAdd)
 	}
 	if result.ResourcesToChange != 1 {
 		t.Errorf("expected 1 resource to change, got %d", result.ResourcesToChange)
 	}
-	if result.ResourcesToDestroy != 2 {
-		t.Errorf("expected 2 resources to destroy, got %d", result.ResourcesToDestroy)
+	if result.ResourcesToDestroy != 1 {
+		t.Errorf("expected 1 resource to destroy, got %d", result.ResourcesToDestroy)
+	}
+	if result.ResourcesToReplace != 2 {
+		t.Errorf("expected 2 resources to replace, got %d", result.ResourcesToReplace)
+	}
+	if result.ResourcesToRead != 2 {
+		t.Errorf("expected 2 resources to read, got %d", result.ResourcesToRead)
+	}
+}
+
+// fakeTerraform writes a shell script standing in for the terraform binary
+// and returns its path along with a log file recording each invocation's
+// arguments, one line per call.
+func fakeTerraform(t *testing.T, script string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsLog := filepath.Join(dir, "args.log")
+	path := filepath.Join(dir, "terraform")
+	content := "#!/bin/sh\necho \"$@\" >> " + argsLog + "\n" + script + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatalf("writing fake terraform: %v", err)
+	}
+	return path, argsLog
+}
+
+// readArgs returns the recorded invocations of a fake terraform binary.
+func readArgs(t *testing.T, argsLog string) []string {
+	t.Helper()
+	data, err := os.ReadFile(argsLog)
+	if err != nil {
+		t.Fatalf("reading args log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestPlanCountMismatch(t *testing.T) {
+	// protectedPlanJSON has 1 change, 2 destroys and 1 replacement, which
+	// terraform's text summary reports as 1 to add and 3 to destroy.
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planJSON, []byte(protectedPlanJSON), 0o600); err != nil {
+		t.Fatalf("writing plan JSON: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	tests := []struct {
+		name     string
+		summary  string
+		mismatch bool
+	}{
+		{"agree", "Plan: 1 to add, 1 to change, 3 to destroy.", false},
+		{"disagree", "Plan: 0 to add, 2 to change, 2 to destroy.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfPath, _ := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/tfplan"; echo '`+tt.summary+`'; exit 2 ;;
+  show) cat `+planJSON+` ;;
+esac`)
+			e := NewExecutor(tfPath, t.TempDir(), logger)
+
+			result, err := e.Run(context.Background(), "plan")
+			if err != nil {
+				t.Fatalf("plan failed: %v", err)
+			}
+			if found := result.CountMismatch != ""; found != tt.mismatch {
+				t.Errorf("mismatch = %v, want %v (%q)", found, tt.mismatch, result.CountMismatch)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("expected the mismatch not to be a warning, got %+v", result.Warnings)
+			}
+			if result.ResourcesToChange != 1 || result.ResourcesToDestroy != 2 || result.ResourcesToReplace != 1 {
+				t.Errorf("expected JSON counts to be kept, got change=%d destroy=%d replace=%d",
+					result.ResourcesToChange, result.ResourcesToDestroy, result.ResourcesToReplace)
+			}
+		})
+	}
+}
+
+func TestApplySavedPlan(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  apply) echo "Apply complete! Resources: 2 added, 0 changed, 0 destroyed." ;;
+  output) echo "{}" ;;
+esac`)
+	workDir := t.TempDir()
+	planFile := filepath.Join(workDir, "saved.tfplan")
+	if err := os.WriteFile(planFile, []byte("plan"), 0o600); err != nil {
+		t.Fatalf("writing plan file: %v", err)
+	}
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetPlanFile("saved.tfplan")
+
+	result, err := e.Run(context.Background(), "apply")
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	calls := readArgs(t, argsLog)
+	if want := "apply -input=false -no-color -auto-approve " + planFile; calls[0] != want {
+		t.Errorf("expected %q, got %q", want, calls[0])
+	}
+	if result.ResourcesToAdd != 2 {
+		t.Errorf("expected 2 resources added, got %d", result.ResourcesToAdd)
+	}
+}
+
+func TestDestroySavedPlan(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/destroy.tfplan"; exit 2 ;;
+  show) echo '{"resource_changes":[{"address":"aws_instance.web","type":"aws_instance","change":{"actions":["delete"]}}]}' ;;
+  apply) echo "Apply complete! Resources: 0 added, 0 changed, 1 destroyed." ;;
+esac`)
+	workDir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	planFile := filepath.Join(workDir, "destroy.tfplan")
+
+	// The reviewed run saves a destroy plan...
+	planner := NewExecutor(tfPath, workDir, logger)
+	planner.SetPlanFile("destroy.tfplan")
+	planner.SetDestroyPlan(true)
+	result, err := planner.Run(context.Background(), "plan")
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if result.ResourcesToDestroy != 1 {
+		t.Errorf("expected 1 resource to destroy, got %d", result.ResourcesToDestroy)
+	}
+
+	// ...and the destroy run applies exactly that plan.
+	destroyer := NewExecutor(tfPath, workDir, logger)
+	destroyer.SetPlanFile("destroy.tfplan")
+	result, err = destroyer.Run(context.Background(), "destroy")
+	if err != nil {
+		t.Fatalf("destroy failed: %v", err)
+	}
+	if result.ResourcesToDestroy != 1 {
+		t.Errorf("expected 1 resource destroyed, got %d", result.ResourcesToDestroy)
+	}
+
+	calls := readArgs(t, argsLog)
+	if want := "plan -input=false -no-color -out=" + planFile + " -destroy"; calls[0] != want {
+		t.Errorf("expected %q, got %q", want, calls[0])
+	}
+	if want := "apply -input=false -no-color -auto-approve " + planFile; calls[len(calls)-1] != want {
+		t.Errorf("expected %q, got %q", want, calls[len(calls)-1])
+	}
+	for _, call := range calls {
+		if strings.HasPrefix(call, "destroy") {
+			t.Errorf("destroy re-planned instead of applying the saved plan: %q", call)
+		}
+	}
+}
+
+func TestDestroyRefusesNonDestroyPlan(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  show) echo '{"resource_changes":[
+    {"address":"aws_instance.old","type":"aws_instance","change":{"actions":["delete"]}},
+    {"address":"aws_instance.web","type":"aws_instance","change":{"actions":["no-op"]}},
+    {"address":"aws_instance.new","type":"aws_instance","change":{"actions":["create"]}}]}' ;;
+esac`)
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "tfplan"), []byte("plan"), 0o600); err != nil {
+		t.Fatalf("writing plan file: %v", err)
+	}
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetPlanFile("tfplan")
+
+	_, err := e.Run(context.Background(), "destroy")
+	if !errors.Is(err, ErrNotDestroyPlan) {
+		t.Fatalf("expected ErrNotDestroyPlan, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "aws_instance.new (create)") || strings.Contains(err.Error(), "aws_instance.web") {
+		t.Errorf("expected error to name only the non-destroy change, got %v", err)
+	}
+	for _, call := range readArgs(t, argsLog) {
+		if strings.HasPrefix(call, "apply") {
+			t.Errorf("applied a plan that is not a destroy plan: %q", call)
+		}
+	}
+}
+
+func TestDestroySavedPlanMissing(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, "")
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetPlanFile("destroy.tfplan")
+
+	if _, err := e.Run(context.Background(), "destroy"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected missing plan error, got %v", err)
+	}
+}
+
+func TestApplyStalePlan(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `
+echo "Error: Saved plan is stale" >&2
+exit 1`)
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "tfplan"), []byte("plan"), 0o600); err != nil {
+		t.Fatalf("writing plan file: %v", err)
+	}
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetPlanFile("tfplan")
+
+	_, err := e.Run(context.Background(), "apply")
+	if err == nil || !strings.Contains(err.Error(), "is stale") {
+		t.Errorf("expected stale plan error, got %v", err)
+	}
+}
+
+func TestProvidersLockPlatforms(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `echo '# lock' > .terraform.lock.hcl`)
+	workDir := t.TempDir()
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetLockPlatforms([]string{"linux_amd64", "", "darwin_arm64"})
+
+	result, err := e.Run(context.Background(), "providers-lock")
+	if err != nil {
+		t.Fatalf("providers-lock failed: %v", err)
+	}
+
+	calls := readArgs(t, argsLog)
+	if want := "providers lock -platform=linux_amd64 -platform=darwin_arm64"; calls[0] != want {
+		t.Errorf("expected %q, got %q", want, calls[0])
+	}
+	if strings.TrimSpace(result.LockFile) != "# lock" {
+		t.Errorf("expected lock file contents to be reported, got %q", result.LockFile)
+	}
+}
+
+func TestInitOnlyOperation(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+if [ "$1" = init ]; then
+  cat > .terraform.lock.hcl <<'EOF'
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "5.31.0"
+  constraints = "~> 5.0"
+  hashes = [
+    "h1:abc=",
+  ]
+}
+
+provider "registry.terraform.io/hashicorp/random" {
+  version = "3.6.0"
+}
+EOF
+fi`)
+	workDir := t.TempDir()
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	result, err := e.Run(context.Background(), "init")
+	if err != nil {
+		t.Fatalf("init operation failed: %v", err)
+	}
+
+	calls := readArgs(t, argsLog)
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "init ") {
+		t.Errorf("expected only terraform init to run, got %q", calls)
+	}
+	want := []Provider{
+		{Address: "registry.terraform.io/hashicorp/aws", Version: "5.31.0"},
+		{Address: "registry.terraform.io/hashicorp/random", Version: "3.6.0"},
+	}
+	if !reflect.DeepEqual(result.Providers, want) {
+		t.Errorf("expected providers %+v, got %+v", want, result.Providers)
+	}
+}
+
+func TestSetTargets(t *testing.T) {
+	e := NewExecutor("terraform", "/work", nil)
+
+	if err := e.SetTargets([]string{"aws_instance.web", "", "  ", "module.vpc.aws_subnet.a[0]"}); err != nil {
+		t.Fatalf("SetTargets failed: %v", err)
+	}
+
+	want := "plan -input=false -no-color -out=/work/tfplan -target=aws_instance.web -target=module.vpc.aws_subnet.a[0]"
+	if got := strings.Join(e.planArgs("/work/tfplan"), " "); got != want {
+		t.Errorf("expected plan args %q, got %q", want, got)
+	}
+	want = "destroy -input=false -no-color -auto-approve -target=aws_instance.web -target=module.vpc.aws_subnet.a[0]"
+	if got := strings.Join(e.destroyArgs(), " "); got != want {
+		t.Errorf("expected destroy args %q, got %q", want, got)
+	}
+
+	// A saved plan already carries its targets.
+	e.SetPlanFile("tfplan")
+	want = "apply -input=false -no-color -auto-approve /work/tfplan"
+	if got := strings.Join(e.applyArgs(), " "); got != want {
+		t.Errorf("expected apply args %q, got %q", want, got)
+	}
+}
+
+func TestSetTargetsRejectsFlags(t *testing.T) {
+	e := NewExecutor("terraform", "/work", nil)
+
+	if err := e.SetTargets([]string{"aws_instance.web", "-destroy"}); err == nil {
+		t.Error("expected error for target starting with '-'")
+	}
+}
+
+func TestSelectWorkspaceCreatesMissing(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+if [ "$2" = "select" ]; then
+  echo "Workspace \"$3\" doesn't exist." >&2
+  exit 1
+fi`)
+
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SelectWorkspace(context.Background(), "staging"); err != nil {
+		t.Fatalf("SelectWorkspace failed: %v", err)
+	}
+
+	calls := readArgs(t, argsLog)
+	want := []string{"workspace select staging", "workspace new staging"}
+	if strings.Join(calls, "|") != strings.Join(want, "|") {
+		t.Errorf("expected calls %q, got %q", want, calls)
+	}
+	if e.Workspace() != "staging" {
+		t.Errorf("expected active workspace staging, got %q", e.Workspace())
+	}
+}
+
+func TestSelectWorkspaceFailureKeepsPrevious(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `
+echo "Error: backend unreachable" >&2
+exit 1`)
+
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SelectWorkspace(context.Background(), "staging"); err == nil {
+		t.Fatal("expected error when workspace select fails")
+	}
+	if e.Workspace() != "default" {
+		t.Errorf("expected workspace to remain default, got %q", e.Workspace())
+	}
+
+	if err := e.SelectWorkspace(context.Background(), "-lock=false"); err == nil {
+		t.Error("expected error for flag-like workspace name")
+	}
+}
+
+func TestRefreshArgs(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, "")
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SetTargets([]string{"aws_instance.web"}); err != nil {
+		t.Fatalf("SetTargets: %v", err)
+	}
+
+	if _, err := e.Run(context.Background(), "refresh"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	calls := readArgs(t, argsLog)
+	if want := "apply -refresh-only -input=false -no-color -auto-approve -target=aws_instance.web"; calls[0] != want {
+		t.Errorf("expected %q, got %q", want, calls[0])
+	}
+}
+
+func TestValidateDiagnostics(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+cat <<'JSON'
+{"valid":false,"error_count":1,"warning_count":1,"diagnostics":[
+{"severity":"error","summary":"Unsupported argument","detail":"An argument named \"foo\" is not expected here."},
+{"severity":"warning","summary":"Deprecated attribute","detail":""}]}
+JSON
+exit 1`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	result, err := e.Run(context.Background(), "validate")
+	if err == nil {
+		t.Fatal("expected validate to fail on error diagnostics")
+	}
+	if calls := readArgs(t, argsLog); calls[0] != "validate -json -no-color" {
+		t.Errorf("unexpected args %q", calls[0])
+	}
+	if result == nil || len(result.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", result)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Summary != "Deprecated attribute" {
+		t.Errorf("unexpected warnings: %+v", result.Warnings)
+	}
+	if result.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", result.ExitCode)
+	}
+}
+
+func TestOutputOperation(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `echo '{"vpc_id":{"value":"vpc-123"}}'`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	result, err := e.Run(context.Background(), "output")
+	if err != nil {
+		t.Fatalf("output failed: %v", err)
+	}
+	if _, ok := result.Outputs["vpc_id"]; !ok {
+		t.Errorf("expected vpc_id output, got %v", result.Outputs)
+	}
+}
+
+func TestUnsupportedOperationListsSupported(t *testing.T) {
+	e := NewExecutor("terraform", t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	_, err := e.Run(context.Background(), "import")
+	if err == nil || !strings.Contains(err.Error(), "refresh") {
+		t.Errorf("expected error listing supported operations, got %v", err)
+	}
+}
+
+func TestStateResourceCount(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+cat <<'EOF_STATE'
+aws_instance.web
+aws_security_group.web
+data.aws_ami.ubuntu
+module.vpc.aws_vpc.this[0]
+module.vpc["eu.west"].data.aws_availability_zones.all
+
+EOF_STATE`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	n, err := e.StateResourceCount(context.Background())
+	if err != nil {
+		t.Fatalf("StateResourceCount: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 resources, got %d", n)
+	}
+	if calls := readArgs(t, argsLog); calls[0] != "state list" {
+		t.Errorf("unexpected args %q", calls[0])
+	}
+}
+
+func TestStateResourceCountNoState(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `
+echo "No state file was found!" >&2
+exit 1`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	n, err := e.StateResourceCount(context.Background())
+	if err != nil || n != 0 {
+		t.Errorf("expected 0 resources and no error, got %d, %v", n, err)
+	}
+}
+
+// waitForFile polls until path exists or the timeout elapses.
+func waitForFile(path string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelInterruptsBeforeKill(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, _ := fakeTerraform(t, `
+trap 'echo interrupted > interrupted' INT
+touch ready
+sleep 30 &
+wait
+sleep 30 &
+wait`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetGracePeriod(200 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForFile(filepath.Join(workDir, "ready"), 5*time.Second)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := e.Run(ctx, "plan")
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("expected cancelled plan to fail")
+	}
+	if _, statErr := os.Stat(filepath.Join(workDir, "interrupted")); statErr != nil {
+		t.Error("expected terraform to receive SIGINT before being killed")
+	}
+	if elapsed > 10*time.Second {
+		t.Errorf("expected terraform to be killed after the grace period, took %s", elapsed)
+	}
+}
+
+func TestCancelExitsCleanlyWithinGracePeriod(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, _ := fakeTerraform(t, `
+trap 'kill $!; exit 1' INT
+touch ready
+sleep 30 &
+wait`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetGracePeriod(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForFile(filepath.Join(workDir, "ready"), 5*time.Second)
+		cancel()
+	}()
+
+	start := time.Now()
+	if _, err := e.Run(ctx, "plan"); err == nil {
+		t.Fatal("expected cancelled plan to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Second {
+		t.Errorf("expected terraform to stop on SIGINT without waiting out the grace period, took %s", elapsed)
+	}
+}
+
+func TestInitOptionsEnv(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, _ := fakeTerraform(t, `env > init.env`)
+	cacheDir := filepath.Join(t.TempDir(), "plugins")
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetInitOptions(InitOptions{
+		PluginCacheDir:   cacheDir,
+		RegistryTimeout:  90 * time.Second,
+		DiscoveryRetries: 3,
+	})
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(workDir, "init.env"))
+	if err != nil {
+		t.Fatalf("reading init env: %v", err)
+	}
+	env := string(data)
+	for _, want := range []string{
+		"TF_PLUGIN_CACHE_DIR=" + cacheDir,
+		"TF_REGISTRY_CLIENT_TIMEOUT=90",
+		"TF_REGISTRY_DISCOVERY_RETRY=3",
+	} {
+		if !strings.Contains(env, want+"\n") {
+			t.Errorf("expected %s in init environment", want)
+		}
+	}
+	if _, err := os.Stat(cacheDir); err != nil {
+		t.Errorf("expected plugin cache dir to be created: %v", err)
+	}
+}
+
+func TestInitSkipsBackendForValidate(t *testing.T) {
+	tests := []struct {
+		operation   string
+		skipBackend bool
+	}{
+		{"validate", true},
+		{"plan", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			tfPath, argsLog := fakeTerraform(t, "")
+			e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+			e.SetInitOptions(InitOptions{SkipBackend: !NeedsBackend(tt.operation)})
+
+			if err := e.Init(context.Background()); err != nil {
+				t.Fatalf("init failed: %v", err)
+			}
+			args := readArgs(t, argsLog)
+			if len(args) != 1 {
+				t.Fatalf("expected one terraform call, got %v", args)
+			}
+			if got := strings.Contains(args[0], "-backend=false"); got != tt.skipBackend {
+				t.Errorf("init args %q: -backend=false present = %v, want %v", args[0], got, tt.skipBackend)
+			}
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `
+sleep 30 &
+wait`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetTimeout(200 * time.Millisecond)
+	e.SetGracePeriod(100 * time.Millisecond)
+
+	start := time.Now()
+	_, err := e.Run(context.Background(), "plan")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the deadline to stop terraform, took %s", elapsed)
+	}
+}
+
+func TestRunFailureIsNotTimeout(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `exit 1`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetTimeout(time.Minute)
+
+	_, err := e.Run(context.Background(), "plan")
+	if err == nil || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected an ordinary failure, got %v", err)
+	}
+}
+
+func TestCommandsRecorded(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, "")
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	if err := e.SetTargets([]string{"aws_instance.web"}); err != nil {
+		t.Fatalf("SetTargets: %v", err)
+	}
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if _, err := e.Run(context.Background(), "refresh"); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	want := []string{
+		"terraform init -input=false -no-color",
+		"terraform apply -refresh-only -input=false -no-color -auto-approve -target=aws_instance.web",
+	}
+	got := e.Commands()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected commands:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestCommandLineMasksSecrets(t *testing.T) {
+	got := commandLine("terraform", []string{
+		"init",
+		"-backend-config=token=s3cr3t",
+		"-backend-config=backend.hcl",
+		"-var=db_password=hunter2",
+		"-target=aws_db_instance.main",
+	})
+	want := "terraform init -backend-config=token=*** -backend-config=backend.hcl -var=db_password=*** -target=aws_db_instance.main"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "s3cr3t") {
+		t.Error("command line leaks a secret")
+	}
+}
+
+func TestCommandsMaskSeparateFlagValues(t *testing.T) {
+	e := NewExecutor("terraform", t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.newCmd(context.Background(), "init", "-backend-config", "token=s3cr3t", "-backend-config", "backend.hcl")
+	e.newCmd(context.Background(), "plan", "-var", "db_password=hunter2", "-target=aws_db_instance.main")
+
+	want := []string{
+		"terraform init -backend-config token=*** -backend-config backend.hcl",
+		"terraform plan -var db_password=*** -target=aws_db_instance.main",
+	}
+	got := e.Commands()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected commands:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestVarFileArgs(t *testing.T) {
+	workDir := t.TempDir()
+	for _, name := range []string{"extra.tfvars", "terraform.tfvars.json"} {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte("{}"), 0o600); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	operator := filepath.Join(t.TempDir(), "operator.tfvars")
+	if err := os.WriteFile(operator, []byte(""), 0o600); err != nil {
+		t.Fatalf("writing operator var file: %v", err)
+	}
+
+	e := NewExecutor("terraform", workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetTfvarsFile(filepath.Join(workDir, "terraform.tfvars.json"))
+	if err := e.SetVarFiles([]string{"extra.tfvars", "", operator}); err != nil {
+		t.Fatalf("SetVarFiles: %v", err)
+	}
+	if err := e.SetTargets([]string{"aws_instance.web"}); err != nil {
+		t.Fatalf("SetTargets: %v", err)
+	}
+
+	// The generated tfvars comes last so it overrides the var files.
+	want := "plan -input=false -no-color -out=tfplan" +
+		" -var-file=" + filepath.Join(workDir, "extra.tfvars") +
+		" -var-file=" + operator +
+		" -var-file=" + filepath.Join(workDir, "terraform.tfvars.json") +
+		" -target=aws_instance.web"
+	if got := strings.Join(e.planArgs("tfplan"), " "); got != want {
+		t.Errorf("plan args:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	e.SetPlanFile("tfplan")
+	if got := strings.Join(e.applyArgs(), " "); strings.Contains(got, "-var-file") {
+		t.Errorf("expected no -var-file with a saved plan, got %s", got)
+	}
+}
+
+func TestSetVarFilesMissing(t *testing.T) {
+	workDir := t.TempDir()
+	e := NewExecutor("terraform", workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	err := e.SetVarFiles([]string{"missing-a.tfvars", "missing-b.tfvars"})
+	if err == nil {
+		t.Fatal("expected error for missing var files")
+	}
+	for _, name := range []string{"missing-a.tfvars", "missing-b.tfvars"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error to list %s, got %v", name, err)
+		}
 	}
 }
@@ -0,0 +1,58 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrDownloadStalled is returned when terraform init stops making progress
+// while installing providers or modules (see InitOptions.StallTimeout). The
+// mirror or registry is usually at fault, so the run is worth retrying.
+var ErrDownloadStalled = errors.New("provider download stalled")
+
+// installingProviderCode is the message_code of the -json init event
+// announcing a provider download.
+const installingProviderCode = "installing_provider_message"
+
+// downloadMessages are the prefixes of human-readable init output lines
+// announcing a provider or module download, for terraform versions whose
+// init does not support -json. Module downloads are also announced this
+// way in -json events, which have no message code for them.
+var downloadMessages = []string{"- Installing ", "Downloading "}
+
+// newStallWatcher returns a watcher of terraform init output that calls
+// onStall, once, if init announces a download and then produces nothing
+// more for the timeout. Every line counts as progress. It reads the
+// init_output events of init -json (terraform 1.9 and later, enabled with
+// TF_CLI_ARGS_init) and falls back to the human-readable output.
+func newStallWatcher(timeout time.Duration, onStall func()) *lineWatcher {
+	w := &lineWatcher{delay: timeout, starts: isDownloadMessage}
+	w.onQuiet = func() {
+		w.stop()
+		onStall()
+	}
+	return w
+}
+
+func isDownloadMessage(line string) bool {
+	if strings.HasPrefix(line, "{") {
+		var event struct {
+			Message string `json:"@message"`
+			Code    string `json:"message_code"`
+		}
+		if json.Unmarshal([]byte(line), &event) == nil {
+			return event.Code == installingProviderCode || strings.HasPrefix(event.Message, "Downloading ")
+		}
+	}
+	for _, prefix := range downloadMessages {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
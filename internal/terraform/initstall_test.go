@@ -0,0 +1,94 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Event lines as emitted by terraform init -json.
+const (
+	initProvidersEvent = `{"@level":"info","@message":"Initializing provider plugins...","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:03.101234Z","message_code":"initializing_provider_plugin_message","type":"init_output"}`
+	findingAWSEvent    = `{"@level":"info","@message":"hashicorp/aws: Finding matching versions...","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:03.221234Z","message_code":"finding_matching_version_message","type":"init_output"}`
+	installingAWSEvent = `{"@level":"info","@message":"Installing provider version: hashicorp/aws v5.31.0...","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:03.401234Z","message_code":"installing_provider_message","type":"init_output"}`
+	installedAWSEvent  = `{"@level":"info","@message":"Installed provider version: hashicorp/aws v5.31.0 (signed by HashiCorp)","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:09.801234Z","message_code":"provider_installed_message","type":"init_output"}`
+	initSuccessEvent   = `{"@level":"info","@message":"Terraform has been successfully initialized!","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:10.001234Z","message_code":"output_init_success_message","type":"init_output"}`
+)
+
+func TestStallWatcher(t *testing.T) {
+	t.Run("progressing", func(t *testing.T) {
+		var stalled atomic.Bool
+		w := newStallWatcher(80*time.Millisecond, func() { stalled.Store(true) })
+		defer w.Stop()
+
+		for _, event := range []string{
+			initProvidersEvent,
+			findingAWSEvent,
+			installingAWSEvent,
+			installedAWSEvent,
+			initSuccessEvent,
+		} {
+			_, _ = w.Write([]byte(event + "\n"))
+			time.Sleep(30 * time.Millisecond)
+		}
+		time.Sleep(150 * time.Millisecond)
+		if stalled.Load() {
+			t.Error("expected no stall while downloads progress")
+		}
+	})
+
+	t.Run("stalled", func(t *testing.T) {
+		fired := make(chan struct{})
+		w := newStallWatcher(80*time.Millisecond, func() { close(fired) })
+		defer w.Stop()
+
+		_, _ = w.Write([]byte(initProvidersEvent + "\n" + findingAWSEvent + "\n"))
+		_, _ = w.Write([]byte(installingAWSEvent + "\n"))
+		select {
+		case <-fired:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a stall once the download stopped progressing")
+		}
+	})
+
+	t.Run("human output", func(t *testing.T) {
+		fired := make(chan struct{})
+		w := newStallWatcher(80*time.Millisecond, func() { close(fired) })
+		defer w.Stop()
+
+		_, _ = w.Write([]byte("Initializing provider plugins...\n- Installing hashicorp/aws v5.31.0...\n"))
+		select {
+		case <-fired:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a stall once the download stopped progressing")
+		}
+	})
+}
+
+func TestInitFailsOnStalledDownload(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `
+cat <<'EOF'
+`+initProvidersEvent+`
+`+installingAWSEvent+`
+EOF
+exec sleep 30`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetGracePeriod(100 * time.Millisecond)
+	e.SetInitOptions(InitOptions{StallTimeout: 200 * time.Millisecond})
+
+	start := time.Now()
+	err := e.Init(context.Background())
+	if !errors.Is(err, ErrDownloadStalled) {
+		t.Fatalf("expected ErrDownloadStalled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected init to fail soon after stalling, took %s", elapsed)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package terraform
+
+import (
+	"os"
+	"syscall"
+)
+
+const isolationSupported = true
+
+// isolationAttr places the child in a new user and mount namespace, mapping
+// the runner's uid/gid so file ownership in the working directory is
+// unchanged. Owning the user namespace lets an unprivileged runner chroot.
+func isolationAttr(root string) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1},
+		},
+		Chroot: root,
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package terraform
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// isolationRoot returns a root with workDir present at its host path.
+func isolationRoot(t *testing.T, workDir string) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, workDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestIsolationSetsNamespaceFlags(t *testing.T) {
+	workDir := t.TempDir()
+	root := isolationRoot(t, workDir)
+	e := NewExecutor("terraform", workDir, nil)
+	if err := e.SetIsolation(true, root); err != nil {
+		t.Fatalf("SetIsolation failed: %v", err)
+	}
+
+	cmd := e.newCmd(context.Background(), "plan")
+	if cmd.SysProcAttr == nil {
+		t.Fatal("expected SysProcAttr to be set on isolated command")
+	}
+	want := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS)
+	if cmd.SysProcAttr.Cloneflags&want != want {
+		t.Errorf("expected clone flags %#x, got %#x", want, cmd.SysProcAttr.Cloneflags)
+	}
+	if len(cmd.SysProcAttr.UidMappings) != 1 || len(cmd.SysProcAttr.GidMappings) != 1 {
+		t.Error("expected uid and gid mappings for the user namespace")
+	}
+	if cmd.SysProcAttr.Chroot != root {
+		t.Errorf("expected chroot %s, got %q", root, cmd.SysProcAttr.Chroot)
+	}
+
+	// Without isolation the child inherits the runner's namespaces.
+	if err := e.SetIsolation(false, ""); err != nil {
+		t.Fatalf("SetIsolation failed: %v", err)
+	}
+	if cmd := e.newCmd(context.Background(), "plan"); cmd.SysProcAttr.Cloneflags != 0 || cmd.SysProcAttr.Chroot != "" {
+		t.Errorf("expected no namespaces or chroot without isolation, got %+v", cmd.SysProcAttr)
+	}
+	if e.isolationRoot != "" {
+		t.Errorf("expected disabling isolation to clear the root, got %q", e.isolationRoot)
+	}
+}
+
+func TestIsolationRequiresRoot(t *testing.T) {
+	e := NewExecutor("terraform", t.TempDir(), nil)
+	if err := e.SetIsolation(true, ""); err == nil {
+		t.Error("expected error when isolating without a root")
+	}
+}
+
+func TestIsolationRootMustContainWorkDir(t *testing.T) {
+	e := NewExecutor("terraform", "/does/not/exist", nil)
+	if err := e.SetIsolation(true, t.TempDir()); err == nil {
+		t.Error("expected error when working directory is missing from isolation root")
+	}
+}
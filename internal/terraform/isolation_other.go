@@ -0,0 +1,14 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package terraform
+
+import "syscall"
+
+const isolationSupported = false
+
+func isolationAttr(string) *syscall.SysProcAttr {
+	return nil
+}
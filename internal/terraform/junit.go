@@ -0,0 +1,139 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the result of a test or validate operation to path
+// as JUnit XML. For test, each run block is a testcase grouped by test file;
+// for validate, each diagnostic is a testcase that fails if it is an error,
+// and a configuration without diagnostics is a single passing testcase.
+func WriteJUnitReport(path, operation string, result *RunResult) error {
+	var report junitTestSuites
+	switch operation {
+	case "test":
+		report.Suites = testSuites(result.TestResults)
+	case "validate":
+		report.Suites = []junitTestSuite{validateSuite(result.Diagnostics)}
+	default:
+		return fmt.Errorf("JUnit reports are not supported for operation %q", operation)
+	}
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding JUnit report: %w", err)
+	}
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing JUnit report: %w", err)
+	}
+	return nil
+}
+
+// testSuites groups test results into one suite per test file, in the order
+// the files were first seen.
+func testSuites(results []TestResult) []junitTestSuite {
+	var suites []junitTestSuite
+	index := make(map[string]int)
+	for _, r := range results {
+		i, ok := index[r.File]
+		if !ok {
+			i = len(suites)
+			index[r.File] = i
+			suites = append(suites, junitTestSuite{Name: r.File})
+		}
+		s := &suites[i]
+		tc := junitTestCase{Name: r.Run, ClassName: r.File}
+		detail := diagnosticsText(r.Diagnostics)
+		switch r.Status {
+		case "fail":
+			tc.Failure = &junitMessage{Message: "run failed", Body: detail}
+			s.Failures++
+		case "error":
+			tc.Error = &junitMessage{Message: "run errored", Body: detail}
+			s.Errors++
+		case "skip":
+			tc.Skipped = &junitMessage{}
+			s.Skipped++
+		default:
+			tc.SystemOut = detail
+		}
+		s.Tests++
+		s.Cases = append(s.Cases, tc)
+	}
+	return suites
+}
+
+func validateSuite(diags []Diagnostic) junitTestSuite {
+	suite := junitTestSuite{Name: "validate"}
+	for _, d := range diags {
+		tc := junitTestCase{Name: d.Summary, ClassName: "validate"}
+		if d.Severity == "error" {
+			tc.Failure = &junitMessage{Message: d.Summary, Body: d.Detail}
+			suite.Failures++
+		} else {
+			tc.SystemOut = d.Severity + ": " + d.Detail
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	if suite.Tests == 0 {
+		suite.Tests = 1
+		suite.Cases = []junitTestCase{{Name: "configuration is valid", ClassName: "validate"}}
+	}
+	return suite
+}
+
+// diagnosticsText renders diagnostics as plain text for a testcase body.
+func diagnosticsText(diags []Diagnostic) string {
+	var b strings.Builder
+	for _, d := range diags {
+		fmt.Fprintf(&b, "%s: %s\n", d.Severity, d.Summary)
+		if d.Detail != "" {
+			fmt.Fprintf(&b, "%s\n", d.Detail)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"encoding/xml"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJUnitReportForTest(t *testing.T) {
+	tfPath, _ := fakeTerraform(t, `cat <<'EOF'
+{"@level":"info","@message":"main.tftest.hcl... in progress","type":"test_file","test_file":{"path":"main.tftest.hcl","progress":"starting"}}
+{"@level":"info","@message":"  \"create\"... pass","@testfile":"main.tftest.hcl","@testrun":"create","type":"test_run","test_run":{"path":"main.tftest.hcl","run":"create","progress":"complete","status":"pass"}}
+{"@level":"error","@message":"Error: Test assertion failed","@testfile":"main.tftest.hcl","@testrun":"tags","type":"diagnostic","diagnostic":{"severity":"error","summary":"Test assertion failed","detail":"bucket must be tagged"}}
+{"@level":"info","@message":"  \"tags\"... fail","@testfile":"main.tftest.hcl","@testrun":"tags","type":"test_run","test_run":{"path":"main.tftest.hcl","run":"tags","progress":"complete","status":"fail"}}
+{"@level":"info","@message":"  \"naming\"... pass","@testfile":"tests/naming.tftest.hcl","@testrun":"naming","type":"test_run","test_run":{"path":"tests/naming.tftest.hcl","run":"naming","progress":"complete","status":"pass"}}
+EOF
+exit 1`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	result, err := e.Run(context.Background(), "test")
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 run(s) failed") {
+		t.Fatalf("expected a failed test run, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := WriteJUnitReport(path, "test", result); err != nil {
+		t.Fatalf("WriteJUnitReport: %v", err)
+	}
+	report := readJUnit(t, path)
+	if report.Tests != 3 || report.Failures != 1 || report.Errors != 0 {
+		t.Errorf("expected 3 tests with 1 failure, got %d tests, %d failures, %d errors", report.Tests, report.Failures, report.Errors)
+	}
+	if len(report.Suites) != 2 || report.Suites[0].Name != "main.tftest.hcl" || report.Suites[1].Name != "tests/naming.tftest.hcl" {
+		t.Fatalf("expected one suite per test file, got %+v", report.Suites)
+	}
+	failed := report.Suites[0].Cases[1]
+	if failed.Name != "tags" || failed.Failure == nil || !strings.Contains(failed.Failure.Body, "bucket must be tagged") {
+		t.Errorf("expected tags to fail with the assertion detail, got %+v", failed)
+	}
+	if report.Suites[0].Cases[0].Failure != nil {
+		t.Errorf("expected create to pass")
+	}
+}
+
+func TestJUnitReportForValidate(t *testing.T) {
+	result := &RunResult{Diagnostics: []Diagnostic{
+		{Severity: "error", Summary: "Unsupported argument", Detail: `An argument named "foo" is not expected here.`},
+		{Severity: "warning", Summary: "Deprecated attribute", Detail: "Use bar instead."},
+	}}
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := WriteJUnitReport(path, "validate", result); err != nil {
+		t.Fatalf("WriteJUnitReport: %v", err)
+	}
+	report := readJUnit(t, path)
+	if report.Tests != 2 || report.Failures != 1 {
+		t.Errorf("expected 2 tests with 1 failure, got %d tests, %d failures", report.Tests, report.Failures)
+	}
+
+	if err := WriteJUnitReport(path, "validate", &RunResult{}); err != nil {
+		t.Fatalf("WriteJUnitReport: %v", err)
+	}
+	report = readJUnit(t, path)
+	if report.Tests != 1 || report.Failures != 0 {
+		t.Errorf("expected a single passing test for a valid configuration, got %+v", report)
+	}
+
+	if err := WriteJUnitReport(path, "plan", &RunResult{}); err == nil {
+		t.Error("expected an error for an operation without test results")
+	}
+}
+
+func readJUnit(t *testing.T, path string) junitTestSuites {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading report: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "<?xml") {
+		t.Errorf("expected an XML declaration, got %q", data)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report is not well-formed XML: %v", err)
+	}
+	return report
+}
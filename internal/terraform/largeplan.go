@@ -0,0 +1,56 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLargePlan is returned when a plan changes more resources than the
+// configured threshold and large plans are blocked.
+var ErrLargePlan = errors.New("plan exceeds large plan threshold")
+
+// SetLargePlanLimit flags plans whose total number of resource changes
+// (adds, changes, destroys and replacements) exceeds threshold. If block is
+// set such plans fail instead, and apply and destroy check their plan before
+// applying it. A threshold of 0 disables the check.
+func (e *Executor) SetLargePlanLimit(threshold int, block bool) {
+	e.largePlanThreshold = threshold
+	e.blockLargePlans = block
+}
+
+// blocksLargePlans reports whether plans over the threshold are rejected.
+func (e *Executor) blocksLargePlans() bool {
+	return e.blockLargePlans && e.largePlanThreshold > 0
+}
+
+// totalChanges returns the number of resources a plan changes.
+func (r *RunResult) totalChanges() int {
+	return r.ResourcesToAdd + r.ResourcesToChange + r.ResourcesToDestroy + r.ResourcesToReplace
+}
+
+// checkLargePlan warns about, or with blocking enabled rejects, a plan
+// exceeding the large plan threshold. A rejected plan file is removed so it
+// cannot be applied.
+func (e *Executor) checkLargePlan(result *RunResult, planFile string) error {
+	total := result.totalChanges()
+	if e.largePlanThreshold <= 0 || total <= e.largePlanThreshold {
+		return nil
+	}
+	detail := fmt.Sprintf("%d resource changes (%d to add, %d to change, %d to destroy, %d to replace) exceed the threshold of %d.",
+		total, result.ResourcesToAdd, result.ResourcesToChange, result.ResourcesToDestroy, result.ResourcesToReplace, e.largePlanThreshold)
+	if e.blockLargePlans {
+		_ = os.Remove(planFile)
+		result.ExitCode = 1
+		return fmt.Errorf("%w: %s", ErrLargePlan, detail)
+	}
+	result.Warnings = append(result.Warnings, Diagnostic{
+		Severity: "warning",
+		Summary:  "Plan exceeds large plan threshold",
+		Detail:   detail,
+	})
+	return nil
+}
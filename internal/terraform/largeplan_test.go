@@ -0,0 +1,109 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanFlagsLargePlan(t *testing.T) {
+	// protectedPlanJSON has 1 change, 2 destroys and 1 replacement.
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planJSON, []byte(protectedPlanJSON), 0o600); err != nil {
+		t.Fatalf("writing plan JSON: %v", err)
+	}
+	script := `
+case "$1" in
+  plan) touch "$PWD/tfplan"; exit 2 ;;
+  show) cat ` + planJSON + ` ;;
+esac`
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	t.Run("warn", func(t *testing.T) {
+		workDir := t.TempDir()
+		tfPath, _ := fakeTerraform(t, script)
+		e := NewExecutor(tfPath, workDir, logger)
+		e.SetLargePlanLimit(3, false)
+
+		result, err := e.Run(context.Background(), "plan")
+		if err != nil {
+			t.Fatalf("plan failed: %v", err)
+		}
+		var found bool
+		for _, w := range result.Warnings {
+			if w.Summary == "Plan exceeds large plan threshold" {
+				found = true
+				if !strings.Contains(w.Detail, "4 resource changes") || !strings.Contains(w.Detail, "threshold of 3") {
+					t.Errorf("unexpected warning detail: %s", w.Detail)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected large plan warning, got %+v", result.Warnings)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		workDir := t.TempDir()
+		tfPath, _ := fakeTerraform(t, script)
+		e := NewExecutor(tfPath, workDir, logger)
+		e.SetLargePlanLimit(3, true)
+
+		result, err := e.Run(context.Background(), "plan")
+		if !errors.Is(err, ErrLargePlan) {
+			t.Fatalf("expected ErrLargePlan, got %v", err)
+		}
+		if result == nil || result.ExitCode != 1 || result.ResourcesToDestroy != 2 {
+			t.Errorf("expected failed result with counts, got %+v", result)
+		}
+		if _, err := os.Stat(filepath.Join(workDir, "tfplan")); !os.IsNotExist(err) {
+			t.Errorf("expected blocked plan file to be removed")
+		}
+	})
+
+	t.Run("under threshold", func(t *testing.T) {
+		workDir := t.TempDir()
+		tfPath, _ := fakeTerraform(t, script)
+		e := NewExecutor(tfPath, workDir, logger)
+		e.SetLargePlanLimit(4, true)
+
+		if _, err := e.Run(context.Background(), "plan"); err != nil {
+			t.Errorf("expected plan at the threshold to pass, got %v", err)
+		}
+	})
+}
+
+func TestApplyBlockedByLargePlan(t *testing.T) {
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planJSON, []byte(protectedPlanJSON), 0o600); err != nil {
+		t.Fatalf("writing plan JSON: %v", err)
+	}
+	workDir := t.TempDir()
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/butler-guard.tfplan"; exit 2 ;;
+  show) cat `+planJSON+` ;;
+esac`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetLargePlanLimit(3, true)
+
+	if _, err := e.Run(context.Background(), "apply"); !errors.Is(err, ErrLargePlan) {
+		t.Fatalf("expected ErrLargePlan, got %v", err)
+	}
+	for _, call := range readArgs(t, argsLog) {
+		if strings.HasPrefix(call, "apply") {
+			t.Errorf("apply ran despite a large plan: %q", call)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workDir, guardPlanFile)); !os.IsNotExist(err) {
+		t.Errorf("expected blocked guard plan to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lineWatcher watches terraform output for a line that starts a timer,
+// and calls onQuiet if nothing more is written before it fires. Every
+// other non-empty line cancels the timer and is passed to onLine. It
+// implements io.Writer. Callbacks run with mu held.
+type lineWatcher struct {
+	delay   time.Duration
+	starts  func(line string) bool
+	onQuiet func()
+	onLine  func() // optional
+
+	mu      sync.Mutex
+	partial []byte
+	timer   *time.Timer
+	armed   int // incremented to invalidate a pending timer
+	stopped bool
+}
+
+// Write implements io.Writer, inspecting each complete line.
+func (w *lineWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+		w.observe(line)
+	}
+	return len(p), nil
+}
+
+// Stop cancels any pending timer; output is ignored afterwards.
+func (w *lineWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stop()
+}
+
+// stop is Stop with w.mu held. It reports whether this call stopped the
+// watcher.
+func (w *lineWatcher) stop() bool {
+	if w.stopped {
+		return false
+	}
+	w.stopped = true
+	w.disarm()
+	return true
+}
+
+// observe handles one output line; w.mu is held.
+func (w *lineWatcher) observe(line string) {
+	if w.stopped || line == "" {
+		return
+	}
+	w.disarm()
+	if !w.starts(line) {
+		if w.onLine != nil {
+			w.onLine()
+		}
+		return
+	}
+	armed := w.armed
+	w.timer = time.AfterFunc(w.delay, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.armed != armed || w.stopped {
+			return
+		}
+		w.onQuiet()
+	})
+}
+
+// disarm cancels a pending timer; w.mu is held.
+func (w *lineWatcher) disarm() {
+	w.armed++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
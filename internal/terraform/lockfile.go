@@ -0,0 +1,43 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+)
+
+// lockFileName is terraform's dependency lock file in the working directory.
+const lockFileName = ".terraform.lock.hcl"
+
+// lockFileDigest returns the SHA-256 of the lock file in dir, or nil if
+// there is none.
+func lockFileDigest(dir string) []byte {
+	data, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// recordLockFileChange compares the lock file against its digest from
+// before init and, if init changed it, records the providers it now locks.
+func (e *Executor) recordLockFileChange(before []byte) {
+	after := lockFileDigest(e.workingDir)
+	if string(after) == string(before) {
+		return
+	}
+	e.lockFileChanged = true
+	data, _ := os.ReadFile(filepath.Join(e.workingDir, lockFileName))
+	e.lockedProviders = parseLockFile(string(data), true)
+	e.logger.Info("init changed the dependency lock file", "providers", len(e.lockedProviders))
+}
+
+// LockFileChanged reports whether init modified .terraform.lock.hcl, e.g.
+// by adding hashes, and if so the providers and hashes it now records.
+func (e *Executor) LockFileChanged() (bool, []Provider) {
+	return e.lockFileChanged, e.lockedProviders
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInitReportsLockFileChange(t *testing.T) {
+	const before = `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.31.0"
+  hashes = [
+    "h1:darwin=",
+  ]
+}
+`
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	t.Run("changed", func(t *testing.T) {
+		workDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(workDir, ".terraform.lock.hcl"), []byte(before), 0o644); err != nil {
+			t.Fatalf("writing lock file: %v", err)
+		}
+		// Init adds the linux hash to the existing entry.
+		tfPath, _ := fakeTerraform(t, `cat > .terraform.lock.hcl <<'EOF'
+provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.31.0"
+  hashes = [
+    "h1:darwin=",
+    "h1:linux=",
+  ]
+}
+EOF`)
+		e := NewExecutor(tfPath, workDir, logger)
+		if err := e.Init(context.Background()); err != nil {
+			t.Fatalf("init failed: %v", err)
+		}
+
+		changed, providers := e.LockFileChanged()
+		if !changed {
+			t.Fatal("expected lock file change to be reported")
+		}
+		want := []Provider{{
+			Address: "registry.terraform.io/hashicorp/aws",
+			Version: "5.31.0",
+			Hashes:  []string{"h1:darwin=", "h1:linux="},
+		}}
+		if !reflect.DeepEqual(providers, want) {
+			t.Errorf("expected providers %+v, got %+v", want, providers)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		workDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(workDir, ".terraform.lock.hcl"), []byte(before), 0o644); err != nil {
+			t.Fatalf("writing lock file: %v", err)
+		}
+		tfPath, _ := fakeTerraform(t, "exit 0")
+		e := NewExecutor(tfPath, workDir, logger)
+		if err := e.Init(context.Background()); err != nil {
+			t.Fatalf("init failed: %v", err)
+		}
+		if changed, _ := e.LockFileChanged(); changed {
+			t.Error("expected no lock file change")
+		}
+	})
+}
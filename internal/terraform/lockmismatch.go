@@ -0,0 +1,17 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import "regexp"
+
+// lockMismatchRe matches the init error terraform reports when a provider
+// package does not match the checksums in .terraform.lock.hcl, typically
+// because the lock file only records hashes for other platforms.
+var lockMismatchRe = regexp.MustCompile(`does(?: not|n't) match any of the checksums (?:previously )?recorded in the dependency lock file`)
+
+// InitUpgraded reports whether init failed on a lock file checksum mismatch
+// and was retried with -upgrade (see InitOptions.UpgradeOnLockMismatch).
+func (e *Executor) InitUpgraded() bool {
+	return e.initUpgraded
+}
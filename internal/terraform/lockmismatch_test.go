@@ -0,0 +1,74 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// lockMismatchScript fails every init without -upgrade with terraform's
+// lock file checksum error.
+const lockMismatchScript = `
+case "$*" in
+  *-upgrade*) exit 0 ;;
+esac
+echo 'Error: Failed to install provider' >&2
+echo 'the local package for registry.terraform.io/hashicorp/aws 5.31.0 doesn'"'"'t match any of the checksums previously recorded in the dependency lock file' >&2
+exit 1`
+
+func TestInitRetriesWithUpgradeOnLockMismatch(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	t.Run("enabled", func(t *testing.T) {
+		tfPath, argsLog := fakeTerraform(t, lockMismatchScript)
+		e := NewExecutor(tfPath, t.TempDir(), logger)
+		e.SetInitOptions(InitOptions{UpgradeOnLockMismatch: true})
+
+		if err := e.Init(context.Background()); err != nil {
+			t.Fatalf("init failed: %v", err)
+		}
+		calls := readArgs(t, argsLog)
+		if len(calls) != 2 {
+			t.Fatalf("expected 2 init calls, got %q", calls)
+		}
+		if strings.Contains(calls[0], "-upgrade") || !strings.HasSuffix(calls[1], "-upgrade") {
+			t.Errorf("expected a plain init then one -upgrade retry, got %q", calls)
+		}
+		if !e.InitUpgraded() {
+			t.Error("expected InitUpgraded to report the retry")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		tfPath, argsLog := fakeTerraform(t, lockMismatchScript)
+		e := NewExecutor(tfPath, t.TempDir(), logger)
+
+		if err := e.Init(context.Background()); err == nil {
+			t.Fatal("expected init to fail")
+		}
+		if calls := readArgs(t, argsLog); len(calls) != 1 {
+			t.Errorf("expected a single init call, got %q", calls)
+		}
+		if e.InitUpgraded() {
+			t.Error("expected no upgrade retry")
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		tfPath, argsLog := fakeTerraform(t, `echo 'Error: Module not installed' >&2; exit 1`)
+		e := NewExecutor(tfPath, t.TempDir(), logger)
+		e.SetInitOptions(InitOptions{UpgradeOnLockMismatch: true})
+
+		if err := e.Init(context.Background()); err == nil {
+			t.Fatal("expected init to fail")
+		}
+		if calls := readArgs(t, argsLog); len(calls) != 1 {
+			t.Errorf("expected a single init call, got %q", calls)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// lockAcquireEvent is the -json event type terraform emits when taking the
+// state lock is slow, i.e. when another run holds it and terraform is
+// retrying within -lock-timeout. An uncontended lock emits no event.
+const lockAcquireEvent = "state_lock_acquire"
+
+// LockWaitWatcher detects terraform waiting for a contended state lock (see
+// SetLockTimeout) from its -json output events, as enabled with
+// TF_CLI_ARGS_plan or TF_CLI_ARGS_apply. It implements io.Writer so it can
+// be teed alongside the log streams; lines that are not -json events are
+// ignored. notify is called with true on a state_lock_acquire event, and
+// with false on the next event, which terraform only emits once it holds
+// the lock. notify runs on a goroutine of its own, so a slow callback never
+// holds up terraform's output.
+type LockWaitWatcher struct {
+	notify func(waiting bool)
+
+	mu      sync.Mutex
+	partial []byte
+	stopped bool
+	waiting bool
+	pending []bool // status changes not yet passed to notify
+
+	wake chan struct{} // signals deliver that pending is not empty
+	done chan struct{} // closed when deliver returns
+}
+
+// NewLockWaitWatcher creates a lock wait watcher. Stop must be called to
+// release it.
+func NewLockWaitWatcher(notify func(waiting bool)) *LockWaitWatcher {
+	w := &LockWaitWatcher{
+		notify: notify,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go w.deliver()
+	return w
+}
+
+// Write implements io.Writer, inspecting each complete line.
+func (w *LockWaitWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := bytes.TrimSpace(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		w.observe(line)
+	}
+	return len(p), nil
+}
+
+// Stop waits for notify to return, so no status change is reported after
+// it. The watcher ignores output afterwards.
+func (w *LockWaitWatcher) Stop() {
+	w.mu.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.wake)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+// observe handles one output line; w.mu is held.
+func (w *LockWaitWatcher) observe(line []byte) {
+	if w.stopped || !bytes.HasPrefix(line, []byte("{")) {
+		return
+	}
+	var event struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(line, &event) != nil || event.Type == "" {
+		return
+	}
+	if waiting := event.Type == lockAcquireEvent; waiting != w.waiting {
+		w.setWaiting(waiting)
+	}
+}
+
+// setWaiting records a status change for deliver; w.mu is held.
+func (w *LockWaitWatcher) setWaiting(waiting bool) {
+	w.waiting = waiting
+	w.pending = append(w.pending, waiting)
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver passes status changes to notify in order, without holding w.mu:
+// notify may report the status over the network.
+func (w *LockWaitWatcher) deliver() {
+	defer close(w.done)
+	for range w.wake {
+		w.mu.Lock()
+		pending := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+		for _, waiting := range pending {
+			w.notify(waiting)
+		}
+	}
+}
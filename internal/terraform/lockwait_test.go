@@ -0,0 +1,108 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Event lines as emitted by terraform plan -json.
+const (
+	lockAcquireLine = `{"@level":"info","@message":"Acquiring state lock. This may take a few moments...","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:04.112345Z","type":"state_lock_acquire"}`
+	refreshLine     = `{"@level":"info","@message":"aws_instance.web: Refreshing state... [id=i-123]","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:41.503112Z","hook":{"resource":{"addr":"aws_instance.web","module":"","resource":"aws_instance.web","implied_provider":"aws","resource_type":"aws_instance","resource_name":"web","resource_key":null},"id_key":"id","id_value":"i-123"},"type":"refresh_start"}`
+	summaryLine     = `{"@level":"info","@message":"Plan: 1 to add, 0 to change, 0 to destroy.","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:42.001234Z","changes":{"add":1,"change":0,"import":0,"remove":0,"operation":"plan"},"type":"change_summary"}`
+	releaseLine     = `{"@level":"info","@message":"Releasing state lock. This may take a few moments...","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:42.104321Z","type":"state_lock_release"}`
+)
+
+func TestLockWaitWatcherTransitions(t *testing.T) {
+	var mu sync.Mutex
+	var statuses []bool
+	w := NewLockWaitWatcher(func(waiting bool) {
+		mu.Lock()
+		statuses = append(statuses, waiting)
+		mu.Unlock()
+	})
+	output := strings.Join([]string{
+		`{"@level":"info","@message":"Terraform 1.9.5","@module":"terraform.ui","@timestamp":"2026-03-02T10:15:03.998765Z","terraform":"1.9.5","type":"version","ui":"1.2"}`,
+		lockAcquireLine,
+		refreshLine,
+		summaryLine,
+		releaseLine,
+	}, "\n") + "\n"
+	// The events arrive split across writes.
+	_, _ = w.Write([]byte(output[:150]))
+	_, _ = w.Write([]byte(output[150:]))
+	w.Stop()
+
+	if want := []bool{true, false}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("expected waiting_for_lock then running, got %v", statuses)
+	}
+}
+
+func TestLockWaitWatcherUncontended(t *testing.T) {
+	var statuses []bool
+	w := NewLockWaitWatcher(func(waiting bool) { statuses = append(statuses, waiting) })
+	// An uncontended lock is taken without a state_lock_acquire event.
+	_, _ = w.Write([]byte(refreshLine + "\n" + summaryLine + "\n" + releaseLine + "\n"))
+	w.Stop()
+	if len(statuses) != 0 {
+		t.Fatalf("expected no status change, got %v", statuses)
+	}
+}
+
+func TestLockWaitWatcherIgnoresHumanOutput(t *testing.T) {
+	var statuses []bool
+	w := NewLockWaitWatcher(func(waiting bool) { statuses = append(statuses, waiting) })
+	_, _ = w.Write([]byte("Acquiring state lock. This may take a few moments...\n\n"))
+	time.Sleep(20 * time.Millisecond)
+	_, _ = w.Write([]byte("No changes. Your infrastructure matches the configuration.\n"))
+	w.Stop()
+	if len(statuses) != 0 {
+		t.Fatalf("expected human output to be ignored, got %v", statuses)
+	}
+}
+
+func TestLockWaitWatcherNotifiesOutsideWrite(t *testing.T) {
+	release := make(chan struct{})
+	notified := make(chan bool, 2)
+	w := NewLockWaitWatcher(func(waiting bool) {
+		notified <- waiting
+		<-release // a status report stuck on the network
+	})
+	defer w.Stop()
+	defer close(release)
+
+	_, _ = w.Write([]byte(lockAcquireLine + "\n"))
+	if waiting := <-notified; !waiting {
+		t.Fatal("expected waiting notification first")
+	}
+
+	wrote := make(chan struct{})
+	go func() {
+		_, _ = w.Write([]byte(summaryLine + "\n"))
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+	case <-time.After(time.Second):
+		t.Fatal("Write blocked on a slow notify")
+	}
+}
+
+func TestLockTimeoutArgs(t *testing.T) {
+	e := NewExecutor("terraform", "/work", nil)
+	e.SetLockTimeout(90 * time.Second)
+
+	if got := strings.Join(e.planArgs("/work/tfplan"), " "); !strings.Contains(got, " -lock-timeout=90s") {
+		t.Errorf("expected plan args to carry the lock timeout, got %q", got)
+	}
+	e.SetPlanFile("tfplan")
+	if got := strings.Join(e.applyArgs(), " "); got != "apply -input=false -no-color -auto-approve -lock-timeout=90s /work/tfplan" {
+		t.Errorf("unexpected apply args %q", got)
+	}
+}
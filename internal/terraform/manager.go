@@ -12,28 +12,59 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
 const defaultVersion = "1.9.8"
 
+// Supported IaC distributions.
+const (
+	DistributionTerraform = "terraform"
+	DistributionOpenTofu  = "opentofu"
+)
+
 // binaryNames is the ordered list of IaC binaries to search on PATH.
 // OpenTofu is preferred since it is CNCF-maintained and properly code-signed.
 var binaryNames = []string{"tofu", "terraform"}
 
-// ResolveVersion returns the path to a terraform/tofu binary for the requested version.
-// It checks both tofu and terraform on PATH, then falls back to downloading.
-func ResolveVersion(ctx context.Context, logger *slog.Logger, version string) (string, error) {
+// Where a resolved binary came from.
+const (
+	ResolvedFromPath   = "path"
+	ResolvedFromCache  = "cache"
+	ResolvedDownloaded = "downloaded"
+)
+
+// Resolution describes the binary ResolveVersion chose.
+type Resolution struct {
+	Path     string
+	Source   string // ResolvedFromPath, ResolvedFromCache, or ResolvedDownloaded
+	CacheDir string // binary cache directory; empty for ResolvedFromPath
+}
+
+// ResolveVersion returns a terraform/tofu binary for the requested version
+// and distribution. It checks PATH first, then falls back to the download
+// cache, downloading if needed. An empty distribution accepts either binary
+// on PATH and downloads HashiCorp Terraform.
+func ResolveVersion(ctx context.Context, logger *slog.Logger, version, distribution string) (Resolution, error) {
 	if version == "" {
 		version = defaultVersion
 	}
 
+	candidates, err := pathCandidates(distribution)
+	if err != nil {
+		return Resolution{}, err
+	}
+	if distribution == "" {
+		distribution = DistributionTerraform
+	}
+
 	// Check if tofu or terraform is on PATH and matches version
-	for _, bin := range binaryNames {
+	for _, bin := range candidates {
 		if path, err := exec.LookPath(bin); err == nil {
 			if installedVersion, err := getInstalledVersion(ctx, path); err == nil {
 				if installedVersion == version {
 					logger.Info("using system binary", "binary", bin, "version", version, "path", path)
-					return path, nil
+					return Resolution{Path: path, Source: ResolvedFromPath}, nil
 				}
 				logger.Info("system binary version mismatch", "binary", bin, "installed", installedVersion, "requested", version)
 			}
@@ -42,32 +73,65 @@ func ResolveVersion(ctx context.Context, logger *slog.Logger, version string) (s
 
 	// If any binary is on PATH regardless of version, use it (local mode convenience).
 	// This allows local testing with whatever version is installed.
-	for _, bin := range binaryNames {
+	for _, bin := range candidates {
 		if path, err := exec.LookPath(bin); err == nil {
 			logger.Info("using system binary (version mismatch accepted)", "binary", bin, "path", path)
-			return path, nil
+			return Resolution{Path: path, Source: ResolvedFromPath}, nil
 		}
 	}
 
-	// Check cache
-	cacheDir := getCacheDir()
-	cachedPath := filepath.Join(cacheDir, version, "terraform")
-	if runtime.GOOS == "windows" {
-		cachedPath += ".exe"
+	return installBinary(ctx, logger, getCacheDir(), distribution, version)
+}
+
+// pathCandidates returns the binaries to look for on PATH for a distribution.
+func pathCandidates(distribution string) ([]string, error) {
+	switch distribution {
+	case "":
+		return binaryNames, nil
+	case DistributionOpenTofu:
+		return []string{"tofu"}, nil
+	case DistributionTerraform:
+		return []string{"terraform"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported distribution: %s", distribution)
 	}
-	if _, err := os.Stat(cachedPath); err == nil {
-		logger.Info("using cached terraform", "version", version, "path", cachedPath)
-		return cachedPath, nil
+}
+
+// binaryName returns the executable name shipped in a distribution's release archive.
+func binaryName(distribution string) string {
+	if distribution == DistributionOpenTofu {
+		return "tofu"
 	}
+	return "terraform"
+}
 
-	// Download
-	logger.Info("downloading terraform", "version", version)
-	if err := downloadTerraform(ctx, version, cacheDir); err != nil {
-		return "", fmt.Errorf("downloading terraform %s: %w", version, err)
+// cachedBinaryPath returns where a downloaded binary lives in the cache.
+// The distribution is part of the path so switching between Terraform and
+// OpenTofu never reuses the wrong binary for the same version string.
+func cachedBinaryPath(cacheDir, distribution, version string) string {
+	return filepath.Join(cacheDir, distribution, version, binaryFileName(distribution))
+}
+
+// binaryFileName is the executable's file name on this platform.
+func binaryFileName(distribution string) string {
+	if runtime.GOOS == "windows" {
+		return binaryName(distribution) + ".exe"
 	}
+	return binaryName(distribution)
+}
 
-	logger.Info("terraform downloaded", "version", version, "path", cachedPath)
-	return cachedPath, nil
+// releaseURL returns the download URL of a distribution's release archive.
+func releaseURL(distribution, version, osName, arch string) string {
+	if distribution == DistributionOpenTofu {
+		return fmt.Sprintf(
+			"https://github.com/opentofu/opentofu/releases/download/v%s/tofu_%s_%s_%s.zip",
+			version, version, osName, arch,
+		)
+	}
+	return fmt.Sprintf(
+		"https://releases.hashicorp.com/terraform/%s/terraform_%s_%s_%s.zip",
+		version, version, osName, arch,
+	)
 }
 
 func getCacheDir() string {
@@ -101,29 +165,129 @@ func getInstalledVersion(ctx context.Context, path string) (string, error) {
 	return "", fmt.Errorf("could not parse version output: %s", string(output))
 }
 
-func downloadTerraform(ctx context.Context, version, cacheDir string) error {
-	osName := runtime.GOOS
-	arch := runtime.GOARCH
+// download fetches a release into a directory; tests replace it.
+var download = downloadBinary
+
+// lockPollInterval is how often a process waiting for another's download
+// retries the cache lock.
+var lockPollInterval = 100 * time.Millisecond
 
-	versionDir := filepath.Join(cacheDir, version)
-	if err := os.MkdirAll(versionDir, 0o755); err != nil {
-		return fmt.Errorf("creating cache dir: %w", err)
+// installBinary resolves the cached binary for version, downloading it first
+// if needed. Runners sharing a cache directory serialize downloads through a
+// lock file, and each download is extracted to a temporary directory and
+// renamed into place, so no process ever sees a partial binary. A cached
+// binary is returned without taking the lock.
+func installBinary(ctx context.Context, logger *slog.Logger, cacheDir, distribution, version string) (Resolution, error) {
+	cachedPath := cachedBinaryPath(cacheDir, distribution, version)
+	cached := Resolution{Path: cachedPath, Source: ResolvedFromCache, CacheDir: cacheDir}
+	if _, err := os.Stat(cachedPath); err == nil {
+		logger.Info("using cached binary", "distribution", distribution, "version", version, "path", cachedPath)
+		return cached, nil
 	}
 
-	url := fmt.Sprintf(
-		"https://releases.hashicorp.com/terraform/%s/terraform_%s_%s_%s.zip",
-		version, version, osName, arch,
-	)
+	versionDir := filepath.Dir(cachedPath)
+	distDir := filepath.Dir(versionDir)
+	if err := os.MkdirAll(distDir, 0o755); err != nil {
+		return Resolution{}, fmt.Errorf("creating cache dir: %w", err)
+	}
+
+	unlock, err := lockCache(ctx, logger, filepath.Join(distDir, version+".lock"))
+	if err != nil {
+		return Resolution{}, err
+	}
+	defer unlock()
+
+	// Another runner may have finished the download while we waited.
+	if _, err := os.Stat(cachedPath); err == nil {
+		logger.Info("using cached binary", "distribution", distribution, "version", version, "path", cachedPath)
+		return cached, nil
+	}
+
+	logger.Info("downloading binary", "distribution", distribution, "version", version)
+	tmpDir, err := os.MkdirTemp(distDir, "."+version+"-")
+	if err != nil {
+		return Resolution{}, fmt.Errorf("creating download dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	if err := download(ctx, distribution, version, tmpDir); err != nil {
+		return Resolution{}, fmt.Errorf("downloading %s %s: %w", distribution, version, err)
+	}
+	// Clear anything left by an interrupted download from an older runner.
+	if err := os.RemoveAll(versionDir); err != nil {
+		return Resolution{}, fmt.Errorf("clearing %s: %w", versionDir, err)
+	}
+	if err := os.Rename(tmpDir, versionDir); err != nil {
+		return Resolution{}, fmt.Errorf("installing %s %s: %w", distribution, version, err)
+	}
+
+	logger.Info("binary downloaded", "distribution", distribution, "version", version, "path", cachedPath)
+	return Resolution{Path: cachedPath, Source: ResolvedDownloaded, CacheDir: cacheDir}, nil
+}
+
+// lockCache takes the exclusive lock at path, waiting until it is free or
+// ctx is done, and returns a function that releases it.
+func lockCache(ctx context.Context, logger *slog.Logger, path string) (func(), error) {
+	return lockFile(ctx, logger, path, false)
+}
+
+// lockCacheShared is lockCache for a shared lock, which any number of
+// runners can hold at once while excluding the exclusive lock.
+func lockCacheShared(ctx context.Context, logger *slog.Logger, path string) (func(), error) {
+	return lockFile(ctx, logger, path, true)
+}
+
+func lockFile(ctx context.Context, logger *slog.Logger, path string, shared bool) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening cache lock: %w", err)
+	}
+
+	waiting := false
+	for {
+		ok, err := tryLockFile(f, shared)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if !waiting {
+			logger.Info("waiting for another runner to release the cache lock", "lock", path)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("waiting for cache lock %s: %w", path, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		_ = f.Close()
+	}, nil
+}
+
+// downloadBinary downloads and extracts a release into dir, leaving the
+// executable binary at the top level.
+func downloadBinary(ctx context.Context, distribution, version, dir string) error {
+	osName := runtime.GOOS
+	arch := runtime.GOARCH
+
+	url := releaseURL(distribution, version, osName, arch)
 
 	// Download zip
-	zipPath := filepath.Join(versionDir, "terraform.zip")
-	cmd := exec.CommandContext(ctx, "curl", "-sSL", "-o", zipPath, url)
+	zipPath := filepath.Join(dir, binaryName(distribution)+".zip")
+	cmd := exec.CommandContext(ctx, "curl", "-fsSL", "-o", zipPath, url)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("downloading %s: %s: %w", url, string(output), err)
 	}
 
 	// Unzip
-	cmd = exec.CommandContext(ctx, "unzip", "-o", "-d", versionDir, zipPath)
+	cmd = exec.CommandContext(ctx, "unzip", "-o", "-d", dir, zipPath)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("unzipping: %s: %w", string(output), err)
 	}
@@ -132,9 +296,9 @@ func downloadTerraform(ctx context.Context, version, cacheDir string) error {
 	_ = os.Remove(zipPath)
 
 	// Make executable
-	tfPath := filepath.Join(versionDir, "terraform")
-	if err := os.Chmod(tfPath, 0o755); err != nil {
-		return fmt.Errorf("chmod terraform: %w", err)
+	binPath := filepath.Join(dir, binaryFileName(distribution))
+	if err := os.Chmod(binPath, 0o755); err != nil {
+		return fmt.Errorf("chmod %s: %w", filepath.Base(binPath), err)
 	}
 
 	return nil
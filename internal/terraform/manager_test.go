@@ -0,0 +1,154 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReleaseURL(t *testing.T) {
+	got := releaseURL(DistributionOpenTofu, "1.8.5", "linux", "amd64")
+	want := "https://github.com/opentofu/opentofu/releases/download/v1.8.5/tofu_1.8.5_linux_amd64.zip"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	got = releaseURL(DistributionTerraform, "1.9.8", "linux", "arm64")
+	want = "https://releases.hashicorp.com/terraform/1.9.8/terraform_1.9.8_linux_arm64.zip"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCachedBinaryPathDisambiguatesDistribution(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	tofu := cachedBinaryPath(cacheDir, DistributionOpenTofu, "1.9.0")
+	tf := cachedBinaryPath(cacheDir, DistributionTerraform, "1.9.0")
+
+	if tofu == tf {
+		t.Fatalf("expected distinct cache paths, both were %q", tofu)
+	}
+	if filepath.Base(filepath.Dir(filepath.Dir(tofu))) != DistributionOpenTofu {
+		t.Errorf("expected opentofu path under %q, got %q", DistributionOpenTofu, tofu)
+	}
+}
+
+func TestPathCandidates(t *testing.T) {
+	bins, err := pathCandidates(DistributionOpenTofu)
+	if err != nil {
+		t.Fatalf("pathCandidates failed: %v", err)
+	}
+	if len(bins) != 1 || bins[0] != "tofu" {
+		t.Errorf("expected [tofu], got %v", bins)
+	}
+
+	if _, err := pathCandidates("pulumi"); err == nil {
+		t.Error("expected error for unsupported distribution")
+	}
+}
+
+func TestInstallBinaryConcurrentDownloads(t *testing.T) {
+	cacheDir := t.TempDir()
+	content := strings.Repeat("terraform-binary-", 4096)
+
+	var downloads atomic.Int32
+	origDownload, origPoll := download, lockPollInterval
+	t.Cleanup(func() { download, lockPollInterval = origDownload, origPoll })
+	lockPollInterval = 5 * time.Millisecond
+	download = func(_ context.Context, distribution, _ string, dir string) error {
+		downloads.Add(1)
+		// Write slowly in pieces so overlapping downloads would interleave.
+		f, err := os.OpenFile(filepath.Join(dir, binaryFileName(distribution)), os.O_CREATE|os.O_WRONLY, 0o755)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		for i := 0; i < len(content); i += 8192 {
+			if _, err := f.WriteString(content[i:min(i+8192, len(content))]); err != nil {
+				return err
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return nil
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	const runners = 8
+	paths := make([]Resolution, runners)
+	errs := make([]error, runners)
+	var wg sync.WaitGroup
+	for i := 0; i < runners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = installBinary(context.Background(), logger, cacheDir, DistributionTerraform, "1.9.8")
+		}(i)
+	}
+	wg.Wait()
+
+	want := cachedBinaryPath(cacheDir, DistributionTerraform, "1.9.8")
+	for i := 0; i < runners; i++ {
+		if errs[i] != nil {
+			t.Fatalf("runner %d: %v", i, errs[i])
+		}
+		if paths[i].Path != want {
+			t.Errorf("runner %d: expected %s, got %s", i, want, paths[i].Path)
+		}
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("expected exactly one download, got %d", n)
+	}
+	data, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatalf("reading binary: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("binary corrupted: got %d bytes, want %d", len(data), len(content))
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(filepath.Dir(want)))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("temporary download dir left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestInstallBinaryReportsResolutionSource(t *testing.T) {
+	cacheDir := t.TempDir()
+	origDownload := download
+	t.Cleanup(func() { download = origDownload })
+	download = func(_ context.Context, distribution, _ string, dir string) error {
+		return os.WriteFile(filepath.Join(dir, binaryFileName(distribution)), []byte("bin"), 0o755)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	first, err := installBinary(context.Background(), logger, cacheDir, DistributionOpenTofu, "1.8.0")
+	if err != nil {
+		t.Fatalf("installBinary: %v", err)
+	}
+	second, err := installBinary(context.Background(), logger, cacheDir, DistributionOpenTofu, "1.8.0")
+	if err != nil {
+		t.Fatalf("installBinary: %v", err)
+	}
+
+	if first.Source != ResolvedDownloaded || second.Source != ResolvedFromCache {
+		t.Errorf("expected downloaded then cache, got %q then %q", first.Source, second.Source)
+	}
+	if first.CacheDir != cacheDir || second.CacheDir != cacheDir {
+		t.Errorf("expected cache dir %s, got %q and %q", cacheDir, first.CacheDir, second.CacheDir)
+	}
+	if first.Path != second.Path {
+		t.Errorf("expected the same binary, got %s and %s", first.Path, second.Path)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrOutputErrors is returned when apply changed resources successfully but
+// failed to evaluate one or more outputs. The result's resource counts
+// reflect what was applied.
+var ErrOutputErrors = errors.New("resources applied but outputs failed to evaluate")
+
+// progressRe matches terraform's per-resource completion lines, e.g.
+// "aws_instance.web: Creation complete after 2s [id=i-123]".
+var progressRe = regexp.MustCompile(`(?m): (Creation|Modifications|Destruction) complete after `)
+
+// parseProgressCounts counts the resources apply reported as created,
+// updated, or destroyed. It is used when apply fails before printing its
+// summary line. A replacement counts as one create and one destroy.
+func parseProgressCounts(output string, result *RunResult) {
+	for _, m := range progressRe.FindAllStringSubmatch(output, -1) {
+		switch m[1] {
+		case "Creation":
+			result.ResourcesToAdd++
+		case "Modifications":
+			result.ResourcesToChange++
+		case "Destruction":
+			result.ResourcesToDestroy++
+		}
+	}
+}
+
+// onlyOutputErrors reports whether diags holds errors and every one of them
+// is in an output block, going by its source context.
+func onlyOutputErrors(diags []Diagnostic) bool {
+	if len(diags) == 0 {
+		return false
+	}
+	for _, d := range diags {
+		if d.Snippet == nil || !strings.HasPrefix(d.Snippet.Context, "output ") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestApplyOutputErrors(t *testing.T) {
+	const progress = `aws_instance.web: Creating...
+aws_instance.web: Creation complete after 2s [id=i-0abc]
+aws_security_group.web: Modifying... [id=sg-123]
+aws_security_group.web: Modifications complete after 1s [id=sg-123]`
+
+	tests := []struct {
+		name       string
+		errorBlock string
+		outputOnly bool
+	}{
+		{
+			name: "output error",
+			errorBlock: `│ Error: Invalid function argument
+│
+│   on outputs.tf line 3, in output "public_ip":
+│    3:   value = element(aws_instance.web.*.public_ip, 5)
+│
+│ Invalid value for "list" parameter: the given list is empty.
+╵`,
+			outputOnly: true,
+		},
+		{
+			name: "plain output error",
+			errorBlock: `Error: Invalid function argument
+
+  on outputs.tf line 3, in output "public_ip":
+   3:   value = element(aws_instance.web.*.public_ip, 5)
+
+Invalid value for "list" parameter: the given list is empty.`,
+			outputOnly: true,
+		},
+		{
+			name: "resource error",
+			errorBlock: `│ Error: creating EC2 Instance: InvalidAMIID.NotFound
+│
+│   with aws_instance.db,
+│   on main.tf line 12, in resource "aws_instance" "db":
+╵`,
+			outputOnly: false,
+		},
+		{
+			name: "plain resource error",
+			errorBlock: `Error: creating EC2 Instance: InvalidAMIID.NotFound
+
+  with aws_instance.db,
+  on main.tf line 12, in resource "aws_instance" "db":
+  12: resource "aws_instance" "db" {
+
+The image id '[ami-123]' does not exist`,
+			outputOnly: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfPath, _ := fakeTerraform(t, `
+case "$1" in
+  apply)
+    cat <<'OUT'
+`+progress+`
+OUT
+    cat >&2 <<'ERR'
+`+tt.errorBlock+`
+ERR
+    exit 1 ;;
+  output) echo '{"vpc_id":{"value":"vpc-1","type":"string","sensitive":false}}' ;;
+esac`)
+			e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+			result, err := e.Run(context.Background(), "apply")
+			if err == nil {
+				t.Fatal("expected apply to fail")
+			}
+			if got := errors.Is(err, ErrOutputErrors); got != tt.outputOnly {
+				t.Fatalf("errors.Is(err, ErrOutputErrors) = %v, want %v (err %v)", got, tt.outputOnly, err)
+			}
+			if !tt.outputOnly {
+				return
+			}
+			if result.ResourcesToAdd != 1 || result.ResourcesToChange != 1 {
+				t.Errorf("expected applied counts 1 added, 1 changed, got %d added, %d changed",
+					result.ResourcesToAdd, result.ResourcesToChange)
+			}
+			if len(result.Diagnostics) != 1 || result.Diagnostics[0].Summary != "Invalid function argument" {
+				t.Errorf("expected the output error diagnostic, got %+v", result.Diagnostics)
+			}
+			if result.Outputs["vpc_id"] == nil {
+				t.Errorf("expected outputs that did evaluate to be collected, got %v", result.Outputs)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package terraform
+
+import "syscall"
+
+// withParentDeathSignal has the kernel interrupt terraform if the runner
+// dies, so an orphaned terraform stops at the next safe point instead of
+// carrying on unsupervised.
+func withParentDeathSignal(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	attr.Pdeathsig = syscall.SIGINT
+	return attr
+}
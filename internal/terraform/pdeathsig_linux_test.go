@@ -0,0 +1,35 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package terraform
+
+import (
+	"context"
+	"syscall"
+	"testing"
+)
+
+func TestExitWithParentSetsDeathSignal(t *testing.T) {
+	workDir := t.TempDir()
+	e := NewExecutor("terraform", workDir, nil)
+	if cmd := e.newCmd(context.Background(), "plan"); cmd.SysProcAttr.Pdeathsig != 0 {
+		t.Errorf("expected no death signal by default, got %v", cmd.SysProcAttr.Pdeathsig)
+	}
+
+	e.SetExitWithParent(true)
+	cmd := e.newCmd(context.Background(), "plan")
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Pdeathsig != syscall.SIGINT {
+		t.Fatalf("expected Pdeathsig SIGINT on the terraform child, got %+v", cmd.SysProcAttr)
+	}
+
+	// The death signal is kept alongside isolation.
+	if err := e.SetIsolation(true, isolationRoot(t, workDir)); err != nil {
+		t.Fatalf("SetIsolation failed: %v", err)
+	}
+	cmd = e.newCmd(context.Background(), "plan")
+	if cmd.SysProcAttr.Pdeathsig != syscall.SIGINT || cmd.SysProcAttr.Cloneflags == 0 {
+		t.Errorf("expected death signal and namespace flags together, got %+v", cmd.SysProcAttr)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !linux
+
+package terraform
+
+import "syscall"
+
+// withParentDeathSignal is a no-op: parent death signals are Linux only.
+func withParentDeathSignal(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	return attr
+}
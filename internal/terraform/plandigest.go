@@ -0,0 +1,61 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrPlanDigestMismatch is returned when a saved plan no longer matches the
+// digest that was approved.
+var ErrPlanDigestMismatch = errors.New("saved plan does not match the approved digest")
+
+// PlanDigest returns the SHA-256 digest of the saved plan file at path, as
+// "sha256:<hex>". It covers the binary plan terraform applies, not its JSON
+// rendering.
+func PlanDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SetApprovedPlanDigest makes apply and destroy refuse a saved plan whose
+// PlanDigest differs from digest, so only the plan that was approved is
+// applied. Apply and destroy without a saved plan fail while a digest is
+// set. Empty disables the check.
+func (e *Executor) SetApprovedPlanDigest(digest string) {
+	e.approvedPlanDigest = digest
+}
+
+// verifyPlanDigest checks planFile against the approved digest, if any.
+// An empty planFile means no saved plan is applied, which never matches.
+func (e *Executor) verifyPlanDigest(planFile string) error {
+	if e.approvedPlanDigest == "" {
+		return nil
+	}
+	if planFile == "" {
+		return fmt.Errorf("%w: no saved plan is applied, approved %s", ErrPlanDigestMismatch, e.approvedPlanDigest)
+	}
+	digest, err := PlanDigest(planFile)
+	if err != nil {
+		return fmt.Errorf("computing digest of saved plan %s: %w", planFile, err)
+	}
+	if digest != e.approvedPlanDigest {
+		return fmt.Errorf("%w: %s has %s, approved %s", ErrPlanDigestMismatch, planFile, digest, e.approvedPlanDigest)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanDigestApproval(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) echo "binary plan" > saved.tfplan; exit 2 ;;
+  show) echo '{}' ;;
+  apply) echo "Apply complete! Resources: 1 added, 0 changed, 0 destroyed." ;;
+  output) echo "{}" ;;
+esac`)
+	workDir := t.TempDir()
+	planFile := filepath.Join(workDir, "saved.tfplan")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	e := NewExecutor(tfPath, workDir, logger)
+	e.SetPlanFile("saved.tfplan")
+	result, err := e.Run(context.Background(), "plan")
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.HasPrefix(result.PlanDigest, "sha256:") {
+		t.Fatalf("expected plan digest to be reported, got %q", result.PlanDigest)
+	}
+
+	// The digest is stable while the plan file is unchanged.
+	again, err := PlanDigest(planFile)
+	if err != nil {
+		t.Fatalf("PlanDigest failed: %v", err)
+	}
+	if again != result.PlanDigest {
+		t.Errorf("digest changed for an unchanged plan: %s then %s", result.PlanDigest, again)
+	}
+
+	e = NewExecutor(tfPath, workDir, logger)
+	e.SetPlanFile("saved.tfplan")
+	e.SetApprovedPlanDigest(result.PlanDigest)
+	if _, err := e.Run(context.Background(), "apply"); err != nil {
+		t.Fatalf("apply of the approved plan failed: %v", err)
+	}
+
+	// Swapping the plan after approval is refused before terraform runs.
+	if err := os.WriteFile(planFile, []byte("tampered plan\n"), 0o600); err != nil {
+		t.Fatalf("rewriting plan file: %v", err)
+	}
+	callsBefore := len(readArgs(t, argsLog))
+	_, err = e.Run(context.Background(), "apply")
+	if !errors.Is(err, ErrPlanDigestMismatch) {
+		t.Fatalf("expected ErrPlanDigestMismatch, got %v", err)
+	}
+	if calls := readArgs(t, argsLog); len(calls) != callsBefore {
+		t.Errorf("expected terraform not to run on mismatch, got %v", calls[callsBefore:])
+	}
+}
+
+func TestApprovedPlanDigestRequiresSavedPlan(t *testing.T) {
+	tfPath, argsLog := fakeTerraform(t, `echo "Apply complete! Resources: 0 added, 0 changed, 0 destroyed."`)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	for _, op := range []string{"apply", "destroy"} {
+		e := NewExecutor(tfPath, t.TempDir(), logger)
+		e.SetApprovedPlanDigest("sha256:abc")
+		if _, err := e.Run(context.Background(), op); !errors.Is(err, ErrPlanDigestMismatch) {
+			t.Errorf("%s: expected ErrPlanDigestMismatch without a saved plan, got %v", op, err)
+		}
+	}
+	if _, err := os.Stat(argsLog); err == nil {
+		t.Errorf("expected terraform not to run, got %v", readArgs(t, argsLog))
+	}
+}
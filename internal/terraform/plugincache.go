@@ -0,0 +1,164 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// freeSpace reports the bytes available to unprivileged users on the
+// filesystem holding path. It is a variable so tests can stub it.
+var freeSpace = diskFree
+
+// cachedProvider is one provider version in the plugin cache, laid out by
+// terraform as <host>/<namespace>/<type>/<version>.
+type cachedProvider struct {
+	dir      string
+	size     int64
+	lastUsed time.Time
+}
+
+// cacheLockFile is the lock on a shared plugin cache. Runs using the cache
+// hold it shared, so pruning, which holds it exclusively, never evicts a
+// provider a run links to.
+const cacheLockFile = ".butler-cache.lock"
+
+// prunePluginCache evicts least-recently-used provider versions from the
+// plugin cache in dir until the filesystem has at least minFree bytes
+// available, or the cache is empty. Last use is the provider directory's
+// modification time, which markPluginCacheUse refreshes after each init.
+// It waits for runs using the cache to finish (see cacheLockFile).
+func prunePluginCache(ctx context.Context, logger *slog.Logger, dir string, minFree int64) error {
+	free, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("checking free space: %w", err)
+	}
+	if free >= minFree {
+		return nil
+	}
+
+	unlock, err := lockCache(ctx, logger, filepath.Join(dir, cacheLockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Another runner may have pruned the cache while we waited.
+	if free, err = freeSpace(dir); err != nil {
+		return fmt.Errorf("checking free space: %w", err)
+	}
+	if free >= minFree {
+		return nil
+	}
+
+	providers, err := listCachedProviders(dir)
+	if err != nil {
+		return fmt.Errorf("listing plugin cache: %w", err)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].lastUsed.Before(providers[j].lastUsed)
+	})
+
+	logger.Info("plugin cache low on disk, evicting providers",
+		"dir", dir, "freeBytes", free, "minFreeBytes", minFree)
+	for _, p := range providers {
+		if free >= minFree {
+			break
+		}
+		if err := os.RemoveAll(p.dir); err != nil {
+			return fmt.Errorf("evicting %s: %w", p.dir, err)
+		}
+		free += p.size
+		logger.Info("evicted cached provider", "dir", p.dir, "bytes", p.size, "lastUsed", p.lastUsed)
+	}
+	return nil
+}
+
+// lockPluginCache prunes the plugin cache if it is low on disk, then takes
+// the shared lock that keeps other runs from pruning it until the returned
+// function is called. Without a plugin cache it does nothing.
+func (e *Executor) lockPluginCache(ctx context.Context) (func(), error) {
+	dir := e.initOpts.PluginCacheDir
+	if dir == "" {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating plugin cache dir: %w", err)
+	}
+	if minFree := e.initOpts.PluginCacheMinFree; minFree > 0 {
+		// A full cache is not fatal; init may still fit.
+		if err := prunePluginCache(ctx, e.logger, dir, minFree); err != nil {
+			e.logger.Warn("failed to prune plugin cache", "dir", dir, "error", err)
+		}
+	}
+	return lockCacheShared(ctx, e.logger, filepath.Join(dir, cacheLockFile))
+}
+
+// listCachedProviders returns every provider version directory in the
+// plugin cache with its total size.
+func listCachedProviders(dir string) ([]cachedProvider, error) {
+	versions, err := filepath.Glob(filepath.Join(dir, "*", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var providers []cachedProvider
+	for _, v := range versions {
+		info, err := os.Stat(v)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		p := cachedProvider{dir: v, lastUsed: info.ModTime()}
+		err = filepath.WalkDir(v, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			p.size += fi.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// markPluginCacheUse refreshes the last-use time of every cached provider
+// version linked from providersDir, the providers directory of a terraform
+// data dir, so pruning evicts the providers that have gone unused the
+// longest.
+func markPluginCacheUse(providersDir, cacheDir string) {
+	cacheDir, err := filepath.EvalSymlinks(cacheDir)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	_ = filepath.WalkDir(providersDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+		// Links point at <version>/<os_arch> inside the cache.
+		version := filepath.Dir(target)
+		if rel, err := filepath.Rel(cacheDir, version); err == nil && !strings.HasPrefix(rel, "..") {
+			_ = os.Chtimes(version, now, now)
+		}
+		return nil
+	})
+}
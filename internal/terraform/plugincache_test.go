@@ -0,0 +1,186 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrunePluginCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := t.TempDir()
+	seed := func(name string, size int, age time.Duration) string {
+		dir := filepath.Join(cache, "registry.terraform.io", "hashicorp", name, "1.0.0")
+		bin := filepath.Join(dir, "linux_amd64", "terraform-provider-"+name)
+		if err := os.MkdirAll(filepath.Dir(bin), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(bin, make([]byte, size), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		used := time.Now().Add(-age)
+		if err := os.Chtimes(dir, used, used); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	oldest := seed("aws", 3000, 3*time.Hour)
+	older := seed("google", 2000, 2*time.Hour)
+	recent := seed("random", 1000, time.Hour)
+
+	// The disk has 500 bytes free plus whatever the cache gives back.
+	usage := func() int64 {
+		providers, err := listCachedProviders(cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var total int64
+		for _, p := range providers {
+			total += p.size
+		}
+		return total
+	}
+	seeded := usage()
+	orig := freeSpace
+	freeSpace = func(string) (int64, error) { return 500 + seeded - usage(), nil }
+	t.Cleanup(func() { freeSpace = orig })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := prunePluginCache(context.Background(), logger, cache, 4000); err != nil {
+		t.Fatalf("prunePluginCache: %v", err)
+	}
+
+	for _, dir := range []string{oldest, older} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be evicted", dir)
+		}
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expected most recently used provider to be kept: %v", err)
+	}
+	if free, _ := freeSpace(cache); free < 4000 {
+		t.Errorf("expected at least 4000 bytes free after pruning, got %d", free)
+	}
+
+	// Enough space: nothing more is evicted.
+	if err := prunePluginCache(context.Background(), logger, cache, 4000); err != nil {
+		t.Fatalf("prunePluginCache: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expected provider to survive when space suffices: %v", err)
+	}
+}
+
+func TestPrunePluginCacheWaitsForLock(t *testing.T) {
+	cache := t.TempDir()
+	dir := filepath.Join(cache, "registry.terraform.io", "hashicorp", "aws", "1.0.0")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	orig := freeSpace
+	freeSpace = func(string) (int64, error) { return 0, nil }
+	t.Cleanup(func() { freeSpace = orig })
+
+	// Another runner is using the same cache.
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	unlock, err := lockCacheShared(context.Background(), logger, filepath.Join(cache, cacheLockFile))
+	if err != nil {
+		t.Fatalf("lockCacheShared: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := prunePluginCache(ctx, logger, cache, 4000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected prune to wait for the lock, got %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("expected nothing evicted without the lock: %v", err)
+	}
+}
+
+func TestMarkPluginCacheUse(t *testing.T) {
+	cache := t.TempDir()
+	version := filepath.Join(cache, "registry.terraform.io", "hashicorp", "null", "3.2.0")
+	if err := os.MkdirAll(filepath.Join(version, "linux_amd64"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(version, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	work := t.TempDir()
+	link := filepath.Join(work, ".terraform", "providers", "registry.terraform.io", "hashicorp", "null", "3.2.0", "linux_amd64")
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(version, "linux_amd64"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	markPluginCacheUse(filepath.Join(work, ".terraform", "providers"), cache)
+
+	info, err := os.Stat(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(old.Add(time.Hour)) {
+		t.Errorf("expected last-use time to be refreshed, got %s", info.ModTime())
+	}
+}
+
+func TestInitMarksPluginCacheUseInDataDir(t *testing.T) {
+	cache := t.TempDir()
+	version := filepath.Join(cache, "registry.terraform.io", "hashicorp", "null", "3.2.0")
+	if err := os.MkdirAll(filepath.Join(version, "linux_amd64"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(version, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tfPath, _ := fakeTerraform(t, `
+link="$TF_DATA_DIR/providers/registry.terraform.io/hashicorp/null/3.2.0"
+mkdir -p "$link"
+ln -s "`+filepath.Join(version, "linux_amd64")+`" "$link/linux_amd64"`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	e.SetInitOptions(InitOptions{PluginCacheDir: cache})
+	if err := e.SetDataDir(t.TempDir(), "module-a", nil); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	unlock, err := e.Lock(context.Background())
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	defer unlock()
+
+	if err := e.Init(context.Background()); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	info, err := os.Stat(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().After(old.Add(time.Hour)) {
+		t.Errorf("expected last-use time to be refreshed through the data dir, got %s", info.ModTime())
+	}
+
+	// The run holds the cache, so pruning waits for it.
+	orig := freeSpace
+	freeSpace = func(string) (int64, error) { return 0, nil }
+	t.Cleanup(func() { freeSpace = orig })
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := prunePluginCache(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), cache, 4000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected prune to wait for the run using the cache, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCancelKillsProcessGroup(t *testing.T) {
+	workDir := t.TempDir()
+	// Background jobs of a non-interactive shell ignore SIGINT, like a
+	// provider plugin that does not stop on interrupt.
+	tfPath, _ := fakeTerraform(t, `
+sleep 30 &
+echo $! > plugin.pid
+touch ready
+wait`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetGracePeriod(100 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForFile(filepath.Join(workDir, "ready"), 5*time.Second)
+		cancel()
+	}()
+	if _, err := e.Run(ctx, "plan"); err == nil {
+		t.Fatal("expected cancelled plan to fail")
+	}
+
+	data, err := os.ReadFile(filepath.Join(workDir, "plugin.pid"))
+	if err != nil {
+		t.Fatalf("reading plugin pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("parsing plugin pid: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatal("expected the plugin process to be killed with terraform")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelStopsKillAfterExit(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, _ := fakeTerraform(t, `
+trap 'exit 1' INT
+touch ready
+while :; do sleep 0.05; done`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetGracePeriod(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForFile(filepath.Join(workDir, "ready"), 5*time.Second)
+		cancel()
+	}()
+	cmd := e.newCmd(ctx, "plan")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected cancelled command to fail")
+	}
+	if cmd.killTimer == nil {
+		t.Fatal("expected cancel to schedule a kill")
+	}
+	if cmd.killTimer.Stop() {
+		t.Error("expected the kill to be stopped once terraform exited")
+	}
+}
+
+// processRunning reports whether pid exists and is not a zombie waiting to
+// be reaped.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
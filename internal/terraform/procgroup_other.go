@@ -0,0 +1,21 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !unix
+
+package terraform
+
+import (
+	"os"
+	"syscall"
+)
+
+// withProcessGroup is a no-op: process groups are Unix only.
+func withProcessGroup(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	return attr
+}
+
+// signalGroup signals only p itself.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
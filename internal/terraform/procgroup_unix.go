@@ -0,0 +1,27 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build unix
+
+package terraform
+
+import (
+	"os"
+	"syscall"
+)
+
+// withProcessGroup starts terraform in a process group of its own, so that
+// signals can reach the provider plugins it starts as well.
+func withProcessGroup(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	attr.Setpgid = true
+	return attr
+}
+
+// signalGroup sends sig to every process in the group led by p, as a
+// terminal does on Ctrl-C.
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return syscall.Kill(-p.Pid, sig.(syscall.Signal))
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrProtectedDestroy is returned when a plan would destroy a resource whose
+// type is protected and whose address has not been explicitly allowed.
+var ErrProtectedDestroy = errors.New("plan destroys protected resources")
+
+// ErrNotDestroyPlan is returned when destroy is given a saved plan that
+// would do more than delete resources.
+var ErrNotDestroyPlan = errors.New("saved plan is not a destroy plan")
+
+// guardPlanFile is the plan written when apply or destroy has to plan before
+// checking it for protected destroys or warnings.
+const guardPlanFile = "butler-guard.tfplan"
+
+// SetDestroyProtection forbids destroying (or replacing) resources of the
+// given types, e.g. "aws_db_instance". Addresses in allowed may still be
+// destroyed. Blank entries are ignored.
+func (e *Executor) SetDestroyProtection(types, allowed []string) {
+	e.protectedTypes = nonBlank(types)
+	e.allowedDestroys = nonBlank(allowed)
+}
+
+// ProtectedDestroys returns the addresses of resources in planJSON that
+// would be destroyed or replaced, have one of the protected types, and are
+// not in allowed.
+func ProtectedDestroys(planJSON []byte, protected, allowed []string) ([]string, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("decoding plan: %w", err)
+	}
+
+	var blocked []string
+	for _, rc := range plan.ResourceChanges {
+		if !slices.Contains(rc.Change.Actions, "delete") {
+			continue
+		}
+		if slices.Contains(protected, rc.Type) && !slices.Contains(allowed, rc.Address) {
+			blocked = append(blocked, rc.Address)
+		}
+	}
+	return blocked, nil
+}
+
+// nonDestroyChanges returns the addresses of resources in planJSON with an
+// action other than delete or no-op, each followed by its actions.
+func nonDestroyChanges(planJSON []byte) ([]string, error) {
+	var plan struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Change  struct {
+				Actions []string `json:"actions"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("decoding plan: %w", err)
+	}
+
+	var changes []string
+	for _, rc := range plan.ResourceChanges {
+		for _, action := range rc.Change.Actions {
+			if action != "delete" && action != "no-op" {
+				changes = append(changes, fmt.Sprintf("%s (%s)", rc.Address, strings.Join(rc.Change.Actions, ",")))
+				break
+			}
+		}
+	}
+	return changes, nil
+}
+
+// protectionWarnings reports protected destroys in a plan as warnings so
+// they surface at plan time, before apply refuses to run.
+func (e *Executor) protectionWarnings(planJSON string) []Diagnostic {
+	if len(e.protectedTypes) == 0 || planJSON == "" {
+		return nil
+	}
+	blocked, err := ProtectedDestroys([]byte(planJSON), e.protectedTypes, e.allowedDestroys)
+	if err != nil {
+		return nil
+	}
+	var diags []Diagnostic
+	for _, addr := range blocked {
+		diags = append(diags, Diagnostic{
+			Severity: "warning",
+			Summary:  "Protected resource would be destroyed",
+			Detail:   fmt.Sprintf("%s has a protected type; apply will be blocked unless it is explicitly allowed.", addr),
+		})
+	}
+	return diags
+}
+
+// checksPlans reports whether apply and destroy must check their plan
+// before applying it.
+func (e *Executor) checksPlans() bool {
+	return len(e.protectedTypes) > 0 || e.strictWarnings || e.blocksLargePlans()
+}
+
+// guardPlan checks a plan for protected destroys and, when large plans are
+// blocked, for its size before it is applied. With destroy set it also
+// checks that the plan only deletes resources. If planFile is empty a plan
+// is created first (a destroy plan when destroy is set) and its warnings
+// are checked too (see SetStrictWarnings); it is removed if a check fails,
+// and otherwise returned for the caller to apply, so that exactly the
+// checked changes are made.
+func (e *Executor) guardPlan(ctx context.Context, planFile string, destroy bool) (checked string, err error) {
+	if planFile == "" {
+		planFile = filepath.Join(e.workingDir, guardPlanFile)
+		defer func() {
+			if err != nil {
+				_ = os.Remove(planFile)
+			}
+		}()
+		args := e.planArgs(planFile)
+		if destroy {
+			args = append(args, "-destroy")
+		}
+		var stdout, stderr bytes.Buffer
+		if err := e.command(ctx, &stdout, &stderr, args...).Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+				return "", fmt.Errorf("terraform plan for pre-apply checks: %s: %w", stderr.String(), err)
+			}
+		}
+		if err := e.checkStrictWarnings(stdout.String() + stderr.String()); err != nil {
+			return "", err
+		}
+	}
+	if len(e.protectedTypes) == 0 && !e.blocksLargePlans() && !destroy {
+		return planFile, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	show := e.newCmd(ctx, "show", "-json", planFile)
+	show.Stdout = &stdout
+	show.Stderr = &stderr
+	if err := show.Run(); err != nil {
+		return "", fmt.Errorf("terraform show %s: %s: %w", planFile, stderr.String(), err)
+	}
+
+	if destroy {
+		changes, err := nonDestroyChanges(stdout.Bytes())
+		if err != nil {
+			return "", err
+		}
+		if len(changes) > 0 {
+			return "", fmt.Errorf("%w: %s", ErrNotDestroyPlan, strings.Join(changes, ", "))
+		}
+	}
+	blocked, err := ProtectedDestroys(stdout.Bytes(), e.protectedTypes, e.allowedDestroys)
+	if err != nil {
+		return "", err
+	}
+	if len(blocked) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrProtectedDestroy, strings.Join(blocked, ", "))
+	}
+	if e.blocksLargePlans() {
+		checked := &RunResult{PlanJSON: stdout.String()}
+		e.parseResourceCounts(checked)
+		if err := e.checkLargePlan(checked, planFile); err != nil {
+			return "", err
+		}
+	}
+	return planFile, nil
+}
+
+// nonBlank returns the trimmed, non-empty entries of values.
+func nonBlank(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
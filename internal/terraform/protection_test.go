@@ -0,0 +1,119 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const protectedPlanJSON = `{
+	"resource_changes": [
+		{"address": "aws_db_instance.main", "type": "aws_db_instance", "change": {"actions": ["delete"]}},
+		{"address": "aws_s3_bucket.logs", "type": "aws_s3_bucket", "change": {"actions": ["delete", "create"]}},
+		{"address": "aws_s3_bucket.assets", "type": "aws_s3_bucket", "change": {"actions": ["update"]}},
+		{"address": "aws_instance.web", "type": "aws_instance", "change": {"actions": ["delete"]}}
+	]
+}`
+
+func TestProtectedDestroys(t *testing.T) {
+	protected := []string{"aws_db_instance", "aws_s3_bucket"}
+
+	blocked, err := ProtectedDestroys([]byte(protectedPlanJSON), protected, nil)
+	if err != nil {
+		t.Fatalf("ProtectedDestroys: %v", err)
+	}
+	if got := strings.Join(blocked, ","); got != "aws_db_instance.main,aws_s3_bucket.logs" {
+		t.Errorf("unexpected blocked resources: %s", got)
+	}
+
+	blocked, err = ProtectedDestroys([]byte(protectedPlanJSON), protected, []string{"aws_s3_bucket.logs"})
+	if err != nil {
+		t.Fatalf("ProtectedDestroys: %v", err)
+	}
+	if got := strings.Join(blocked, ","); got != "aws_db_instance.main" {
+		t.Errorf("expected allowed address to be exempt, got %s", got)
+	}
+}
+
+func TestApplyBlockedByProtectedDestroy(t *testing.T) {
+	workDir := t.TempDir()
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planJSON, []byte(protectedPlanJSON), 0o600); err != nil {
+		t.Fatalf("writing plan JSON: %v", err)
+	}
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/butler-guard.tfplan" ;;
+  show) cat `+planJSON+` ;;
+esac`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetDestroyProtection([]string{"aws_db_instance"}, nil)
+
+	_, err := e.Run(context.Background(), "apply")
+	if !errors.Is(err, ErrProtectedDestroy) {
+		t.Fatalf("expected ErrProtectedDestroy, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "aws_db_instance.main") {
+		t.Errorf("expected error to name the resource, got %v", err)
+	}
+	for _, call := range readArgs(t, argsLog) {
+		if strings.HasPrefix(call, "apply") {
+			t.Errorf("apply ran despite a protected destroy: %q", call)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(workDir, guardPlanFile)); !os.IsNotExist(err) {
+		t.Errorf("expected blocked guard plan to be removed, got %v", err)
+	}
+}
+
+func TestGuardPlanRemovedWhenShowFails(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, _ := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/butler-guard.tfplan" ;;
+  show) echo 'Error: corrupt plan' >&2; exit 1 ;;
+esac`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetDestroyProtection([]string{"aws_db_instance"}, nil)
+
+	if _, err := e.Run(context.Background(), "destroy"); err == nil {
+		t.Fatal("expected destroy to fail when the guard plan cannot be read")
+	}
+	if _, err := os.Stat(filepath.Join(workDir, guardPlanFile)); !os.IsNotExist(err) {
+		t.Errorf("expected guard plan to be removed, got %v", err)
+	}
+}
+
+func TestApplyRunsCheckedPlan(t *testing.T) {
+	workDir := t.TempDir()
+	tfPath, argsLog := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/butler-guard.tfplan" ;;
+  show) echo '{"resource_changes":[{"address":"aws_instance.web","type":"aws_instance","change":{"actions":["delete"]}}]}' ;;
+  output) echo '{}' ;;
+esac`)
+
+	e := NewExecutor(tfPath, workDir, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetDestroyProtection([]string{"aws_db_instance"}, nil)
+
+	if _, err := e.Run(context.Background(), "apply"); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	guard := filepath.Join(workDir, guardPlanFile)
+	calls := readArgs(t, argsLog)
+	if want := "apply -input=false -no-color -auto-approve " + guard; calls[2] != want {
+		t.Errorf("expected %q, got %q", want, calls[2])
+	}
+	if _, err := os.Stat(guard); !os.IsNotExist(err) {
+		t.Error("expected the guard plan to be removed after apply")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// SetDetectSchemaNoise flags plans whose changes look like noise from a
+// provider schema upgrade rather than real drift.
+func (e *Executor) SetDetectSchemaNoise(enabled bool) {
+	e.detectSchemaNoise = enabled
+}
+
+// LikelySchemaNoise reports whether every change in planJSON is an in-place
+// update that only touches computed attributes (known after apply) or
+// attributes that were previously unset and now get a default: a zero
+// value, or any value for an attribute the configuration does not set.
+// After a provider upgrade such plans are usually spurious. A plan with no
+// changes, or with any create, delete or replace, is never noise.
+func LikelySchemaNoise(planJSON []byte) bool {
+	var plan struct {
+		ResourceChanges []struct {
+			ModuleAddress string `json:"module_address"`
+			Mode          string `json:"mode"`
+			Type          string `json:"type"`
+			Name          string `json:"name"`
+			Change        struct {
+				Actions      []string               `json:"actions"`
+				Before       map[string]interface{} `json:"before"`
+				After        map[string]interface{} `json:"after"`
+				AfterUnknown map[string]interface{} `json:"after_unknown"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+		Configuration struct {
+			RootModule configModule `json:"root_module"`
+		} `json:"configuration"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return false
+	}
+	configured := map[string]map[string]json.RawMessage{}
+	plan.Configuration.RootModule.collect("", configured)
+
+	updates := 0
+	for _, rc := range plan.ResourceChanges {
+		switch strings.Join(rc.Change.Actions, ",") {
+		case "no-op", "read":
+			continue
+		case "update":
+		default:
+			return false
+		}
+		updates++
+
+		addr := rc.Type + "." + rc.Name
+		if rc.Mode == "data" {
+			addr = "data." + addr
+		}
+		if m := moduleIndexRe.ReplaceAllString(rc.ModuleAddress, ""); m != "" {
+			addr = m + "." + addr
+		}
+		expressions, haveConfig := configured[addr]
+
+		c := rc.Change
+		keys := map[string]bool{}
+		for _, m := range []map[string]interface{}{c.Before, c.After, c.AfterUnknown} {
+			for k := range m {
+				keys[k] = true
+			}
+		}
+		for k := range keys {
+			if c.AfterUnknown[k] == true {
+				continue // computed
+			}
+			if c.Before[k] == nil {
+				if isZeroValue(c.After[k]) {
+					continue // previously unset, now a zero default
+				}
+				if _, set := expressions[k]; haveConfig && !set {
+					continue // previously unset, defaulted by the provider
+				}
+			}
+			if !reflect.DeepEqual(c.Before[k], c.After[k]) {
+				return false
+			}
+		}
+	}
+	return updates > 0
+}
+
+// moduleIndexRe matches the instance keys in a module address, which the
+// configuration does not have.
+var moduleIndexRe = regexp.MustCompile(`\[[^\]]*\]`)
+
+// configModule is a module in the plan's configuration section.
+type configModule struct {
+	Resources []struct {
+		Address     string                     `json:"address"`
+		Expressions map[string]json.RawMessage `json:"expressions"`
+	} `json:"resources"`
+	ModuleCalls map[string]struct {
+		Module configModule `json:"module"`
+	} `json:"module_calls"`
+}
+
+// collect records the attributes set in each resource's configuration,
+// keyed by its address without instance keys.
+func (m configModule) collect(prefix string, into map[string]map[string]json.RawMessage) {
+	for _, r := range m.Resources {
+		into[prefix+r.Address] = r.Expressions
+	}
+	for name, call := range m.ModuleCalls {
+		call.Module.collect(prefix+"module."+name+".", into)
+	}
+}
+
+// isZeroValue reports whether v is false, zero, empty or null.
+func isZeroValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// checkSchemaNoise marks a plan matching LikelySchemaNoise when detection
+// is enabled. It is not a warning, so strict warnings never fail a run on
+// the heuristic.
+func (e *Executor) checkSchemaNoise(result *RunResult) {
+	if e.detectSchemaNoise && LikelySchemaNoise([]byte(result.PlanJSON)) {
+		result.LikelySchemaNoise = true
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// schemaNoisePlanJSON updates two resources, touching only an attribute
+// known after apply, one that was previously unset and is now a zero value,
+// and one that was previously unset and is not in the configuration.
+const schemaNoisePlanJSON = `{"resource_changes": [
+	{"address": "aws_s3_bucket.logs", "type": "aws_s3_bucket", "name": "logs", "change": {
+		"actions": ["update"],
+		"before": {"bucket": "logs", "arn": "arn:aws:s3:::logs", "object_lock_enabled": null},
+		"after": {"bucket": "logs", "object_lock_enabled": false},
+		"after_unknown": {"arn": true}
+	}},
+	{"address": "aws_iam_role.ci", "type": "aws_iam_role", "name": "ci", "change": {
+		"actions": ["update"],
+		"before": {"name": "ci", "tags": {"team": "infra"}},
+		"after": {"name": "ci", "tags": {"team": "infra"}, "max_session_duration": 3600},
+		"after_unknown": {}
+	}},
+	{"address": "aws_vpc.main", "change": {"actions": ["no-op"], "before": {}, "after": {}}}
+], "configuration": {"root_module": {"resources": [
+	{"address": "aws_iam_role.ci", "expressions": {"name": {"constant_value": "ci"}, "tags": {}}}
+]}}}`
+
+func TestLikelySchemaNoise(t *testing.T) {
+	tests := []struct {
+		name string
+		plan string
+		want bool
+	}{
+		{"computed and defaulted only", schemaNoisePlanJSON, true},
+		{"real update", `{"resource_changes": [{"change": {
+			"actions": ["update"],
+			"before": {"name": "ci", "max_session_duration": 3600},
+			"after": {"name": "ci", "max_session_duration": 7200}
+		}}]}`, false},
+		{"newly configured attribute", `{"resource_changes": [{"type": "aws_iam_role", "name": "ci", "change": {
+			"actions": ["update"],
+			"before": {"name": "ci", "max_session_duration": null},
+			"after": {"name": "ci", "max_session_duration": 7200}
+		}}], "configuration": {"root_module": {"resources": [
+			{"address": "aws_iam_role.ci", "expressions": {"name": {}, "max_session_duration": {}}}
+		]}}}`, false},
+		{"newly set without configuration", `{"resource_changes": [{"type": "aws_iam_role", "name": "ci", "change": {
+			"actions": ["update"],
+			"before": {"name": "ci", "max_session_duration": null},
+			"after": {"name": "ci", "max_session_duration": 7200}
+		}}]}`, false},
+		{"create", `{"resource_changes": [{"change": {"actions": ["create"], "before": null, "after": {"name": "ci"}}}]}`, false},
+		{"no changes", `{"resource_changes": [{"change": {"actions": ["no-op"]}}]}`, false},
+		{"invalid", `not json`, false},
+	}
+	for _, tt := range tests {
+		if got := LikelySchemaNoise([]byte(tt.plan)); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestPlanFlagsSchemaNoise(t *testing.T) {
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planJSON, []byte(schemaNoisePlanJSON), 0o600); err != nil {
+		t.Fatalf("writing plan JSON: %v", err)
+	}
+	tfPath, _ := fakeTerraform(t, `
+case "$1" in
+  plan) touch "$PWD/tfplan"; exit 2 ;;
+  show) cat `+planJSON+` ;;
+esac`)
+	e := NewExecutor(tfPath, t.TempDir(), slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.SetDetectSchemaNoise(true)
+
+	result, err := e.Run(context.Background(), "plan")
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !result.LikelySchemaNoise {
+		t.Error("expected plan to be flagged as likely schema noise")
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("expected the flag not to add warnings, got %+v", result.Warnings)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2026 The Butler Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// TestResult is the outcome of one run block in a terraform test file.
+type TestResult struct {
+	File        string // test file path, e.g. "tests/main.tftest.hcl"
+	Run         string // run block name
+	Status      string // "pass", "fail", "error" or "skip"
+	Diagnostics []Diagnostic
+}
+
+// test runs terraform test and collects the result of each run block.
+func (e *Executor) test(ctx context.Context) (*RunResult, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, &stdout, &stderr, e.testArgs()...)
+
+	err := cmd.Run()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	tests, diags := parseTestOutput(stdout.Bytes())
+	result := &RunResult{ExitCode: exitCode, TestResults: tests, Diagnostics: diags}
+	for _, d := range diags {
+		if d.Severity == "warning" {
+			result.Warnings = append(result.Warnings, d)
+		}
+	}
+
+	failed := 0
+	for _, t := range tests {
+		if t.Status == "fail" || t.Status == "error" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		if result.ExitCode == 0 {
+			result.ExitCode = 1
+		}
+		return result, fmt.Errorf("terraform test: %d of %d run(s) failed", failed, len(tests))
+	}
+	if err != nil {
+		return result, fmt.Errorf("terraform test: %s: %w", stderr.String(), err)
+	}
+	return result, nil
+}
+
+func (e *Executor) testArgs() []string {
+	args := []string{"test", "-no-color", "-json"}
+	return append(args, e.varFileArgs()...)
+}
+
+// parseTestOutput extracts completed run blocks and all diagnostics from
+// the message stream of terraform test -json. Diagnostics raised inside a
+// run block are also attached to that run's result.
+func parseTestOutput(data []byte) ([]TestResult, []Diagnostic) {
+	var tests []TestResult
+	var diags []Diagnostic
+	runDiags := make(map[[2]string][]Diagnostic)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Type       string      `json:"type"`
+			TestFile   string      `json:"@testfile"`
+			TestRun    string      `json:"@testrun"`
+			Diagnostic *Diagnostic `json:"diagnostic"`
+			TestRunMsg *struct {
+				Path     string `json:"path"`
+				Run      string `json:"run"`
+				Progress string `json:"progress"`
+				Status   string `json:"status"`
+			} `json:"test_run"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Type == "diagnostic" && msg.Diagnostic != nil:
+			diags = append(diags, *msg.Diagnostic)
+			if msg.TestRun != "" {
+				key := [2]string{msg.TestFile, msg.TestRun}
+				runDiags[key] = append(runDiags[key], *msg.Diagnostic)
+			}
+		case msg.Type == "test_run" && msg.TestRunMsg != nil && msg.TestRunMsg.Progress == "complete":
+			tests = append(tests, TestResult{
+				File:   msg.TestRunMsg.Path,
+				Run:    msg.TestRunMsg.Run,
+				Status: msg.TestRunMsg.Status,
+			})
+		}
+	}
+	for i := range tests {
+		tests[i].Diagnostics = runDiags[[2]string{tests[i].File, tests[i].Run}]
+	}
+	return tests, diags
+}